@@ -0,0 +1,249 @@
+// Copyright 2014 by caixw, All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package orm
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"strconv"
+)
+
+// 聚合函数，根据当前select语句的条件返回单一的值。
+//
+// ORDER BY和LIMIT部分会被忽略。
+// 指定了GroupBy()时，Count()返回分组的数量，
+// 其它函数先在各个分组中聚合，再对各分组的结果进行聚合：
+//  SELECT SUM(agg0) FROM(SELECT SUM(col) AS agg0 FROM ... GROUP BY ... HAVING ...) tmp
+// 只指定了Distinct()时，Count()返回不重复的记录数量，需要通过Columns()指定列；
+// 其它函数只对col列中不重复的值进行聚合：
+//  SELECT SUM(agg0) FROM(SELECT DISTINCT col AS agg0 FROM ...) tmp
+
+// 返回符合条件的记录数量
+func (s *SQL) Count() (int64, error) {
+	return s.CountContext(context.Background())
+}
+
+// 功能同Count()，但可以通过ctx取消查询。
+func (s *SQL) CountContext(ctx context.Context) (int64, error) {
+	var cnt int64
+	if err := s.aggregate(ctx, "", nil, &cnt); err != nil {
+		return 0, err
+	}
+	return cnt, nil
+}
+
+// 返回col列的总和，没有符合条件的记录时，返回0。
+func (s *SQL) Sum(col string) (float64, error) {
+	return s.SumContext(context.Background(), col)
+}
+
+// 功能同Sum()，但可以通过ctx取消查询。
+func (s *SQL) SumContext(ctx context.Context, col string) (float64, error) {
+	var sum sql.NullFloat64
+	if err := s.aggregate(ctx, col, []string{"SUM"}, &sum); err != nil {
+		return 0, err
+	}
+	return sum.Float64, nil
+}
+
+// 返回col列的平均值，没有符合条件的记录时，返回0。
+func (s *SQL) Avg(col string) (float64, error) {
+	return s.AvgContext(context.Background(), col)
+}
+
+// 功能同Avg()，但可以通过ctx取消查询。
+// 由总和与数量计算得出，以便在分组之后依然能得到正确的平均值。
+func (s *SQL) AvgContext(ctx context.Context, col string) (float64, error) {
+	var sum sql.NullFloat64
+	var cnt sql.NullInt64
+	if err := s.aggregate(ctx, col, []string{"SUM", "COUNT"}, &sum, &cnt); err != nil {
+		return 0, err
+	}
+
+	if cnt.Int64 == 0 {
+		return 0, nil
+	}
+	return sum.Float64 / float64(cnt.Int64), nil
+}
+
+// 获取col列的最大值到v中，v为指针，其类型需要与该列的类型相兼容。
+// 没有符合条件的记录时，返回sql.ErrNoRows，v的值保持不变。
+//  var max int64
+//  err := e.SQL().Table("#user").Max("{age}", &max)
+func (s *SQL) Max(col string, v interface{}) error {
+	return s.MaxContext(context.Background(), col, v)
+}
+
+// 功能同Max()，但可以通过ctx取消查询。
+func (s *SQL) MaxContext(ctx context.Context, col string, v interface{}) error {
+	return s.aggregateValue(ctx, "MAX", col, v)
+}
+
+// 获取col列的最小值到v中，v为指针，其类型需要与该列的类型相兼容。
+// 没有符合条件的记录时，返回sql.ErrNoRows，v的值保持不变。
+func (s *SQL) Min(col string, v interface{}) error {
+	return s.MinContext(context.Background(), col, v)
+}
+
+// 功能同Min()，但可以通过ctx取消查询。
+func (s *SQL) MinContext(ctx context.Context, col string, v interface{}) error {
+	return s.aggregateValue(ctx, "MIN", col, v)
+}
+
+// 执行MAX或是MIN聚合函数，并将结果保存到v中。
+// 同时获取col中非NULL值的数量，以区分没有符合条件的记录和类型转换失败。
+func (s *SQL) aggregateValue(ctx context.Context, fn, col string, v interface{}) error {
+	if s.HasErrors() {
+		return Errors(s.errors)
+	}
+
+	query, err := s.aggregateSQL(col, []string{"COUNT", fn})
+	if err != nil {
+		return err
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, s.aggregateArgs()...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		if err = rows.Err(); err != nil {
+			return err
+		}
+		return sql.ErrNoRows
+	}
+
+	// 先以interface{}获取，确定存在非NULL值之后，再转换到v的类型。
+	var cnt sql.NullInt64
+	var val interface{}
+	if err = rows.Scan(&cnt, &val); err != nil {
+		return err
+	}
+	if cnt.Int64 == 0 {
+		return sql.ErrNoRows
+	}
+	return rows.Scan(&cnt, v)
+}
+
+// 执行作用于col列的聚合函数fns，并将结果依次保存到dest中。
+// fns为空时，表示Count()。
+func (s *SQL) aggregate(ctx context.Context, col string, fns []string, dest ...interface{}) error {
+	if s.HasErrors() {
+		return Errors(s.errors)
+	}
+
+	query, err := s.aggregateSQL(col, fns)
+	if err != nil {
+		return err
+	}
+
+	return s.db.QueryRowContext(ctx, query, s.aggregateArgs()...).Scan(dest...)
+}
+
+// 聚合语句中所有占位符对应的值：where，having。
+func (s *SQL) aggregateArgs() []interface{} {
+	args := make([]interface{}, 0, len(s.condArgs)+len(s.havingArgs))
+	args = append(args, s.condArgs...)
+	return append(args, s.havingArgs...)
+}
+
+// 产生作用于col列的聚合函数fns的select语句，fns为空时表示Count()。
+//
+// 子查询的表别名不使用AS关键字，oracle不支持该写法。
+func (s *SQL) aggregateSQL(col string, fns []string) (string, error) {
+	s.buf.Reset()
+
+	switch {
+	case s.groupBy.Len() == 0 && !s.distinct: // 直接在表上聚合
+		if len(fns) == 0 {
+			s.buf.WriteString("SELECT COUNT(*) FROM ")
+		} else {
+			s.buf.WriteString("SELECT ")
+			s.buf.WriteString(aggregateExprs(fns, col, false))
+			s.buf.WriteString(" FROM ")
+		}
+		s.buf.WriteString(s.tableName)
+		s.buf.WriteString(s.join.String())
+		s.buf.WriteString(s.selectCond())
+	case len(fns) == 0: // 统计查询结果的行数
+		cols := "1 AS agg0"
+		if s.distinct {
+			if len(s.cols) == 0 {
+				return "", errors.New("Count:Distinct()需要通过Columns()指定列")
+			}
+			cols = ""
+		}
+
+		s.buf.WriteString("SELECT COUNT(*) FROM(")
+		if len(cols) == 0 {
+			s.writeSelect()
+		} else {
+			s.writeSelectCols(false, cols)
+		}
+		s.buf.WriteString(") tmp")
+	case s.groupBy.Len() > 0: // 先在各分组中聚合，再聚合各分组的结果
+		inner := aggregateExprs(fns, col, true)
+		s.buf.WriteString("SELECT ")
+		s.buf.WriteString(aggregateOuterExprs(fns))
+		s.buf.WriteString(" FROM(")
+		s.writeSelectCols(false, inner)
+		s.buf.WriteString(") tmp")
+	default: // 只有Distinct()，对col中不重复的值进行聚合
+		if len(col) == 0 {
+			return "", errors.New("aggregate:col不能为空")
+		}
+
+		s.buf.WriteString("SELECT ")
+		s.buf.WriteString(aggregateExprs(fns, "agg0", false))
+		s.buf.WriteString(" FROM(")
+		s.writeSelectCols(true, col+" AS agg0")
+		s.buf.WriteString(") tmp")
+	}
+
+	return s.db.PrepareSQL(s.buf.String()), nil
+}
+
+// 产生以逗号分隔的聚合函数列表：SUM(col),COUNT(col)，
+// alias为true时，各个聚合函数依次以agg0,agg1...作为别名。
+func aggregateExprs(fns []string, col string, alias bool) string {
+	buf := new(bytes.Buffer)
+	for i, fn := range fns {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		buf.WriteString(fn)
+		buf.WriteByte('(')
+		buf.WriteString(col)
+		buf.WriteByte(')')
+		if alias {
+			buf.WriteString(" AS agg")
+			buf.WriteString(strconv.Itoa(i))
+		}
+	}
+	return buf.String()
+}
+
+// 产生聚合各分组结果的表达式，各分组的结果由aggregateExprs()以agg0,agg1...命名。
+// 各分组的COUNT需要求和，其它的函数则保持不变。
+func aggregateOuterExprs(fns []string) string {
+	buf := new(bytes.Buffer)
+	for i, fn := range fns {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		if fn == "COUNT" {
+			fn = "SUM"
+		}
+		buf.WriteString(fn)
+		buf.WriteString("(agg")
+		buf.WriteString(strconv.Itoa(i))
+		buf.WriteByte(')')
+	}
+	return buf.String()
+}
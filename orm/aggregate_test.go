@@ -0,0 +1,111 @@
+// Copyright 2014 by caixw, All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package orm
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/caixw/lib.go/assert"
+)
+
+func TestSQLAggregateSQL(t *testing.T) {
+	a := assert.New(t)
+	db := newDB(a)
+	defer db.close()
+
+	sql := db.SQL().Table("#user").Columns("*").Where("{age}>?", 18).Asc("{id}").Limit(5, 0)
+	query, err := sql.aggregateSQL("", nil)
+	a.NotError(err).StringEqual(query, "SELECT COUNT(*) FROM prefix_user WHERE([age]>?)", style)
+	query, err = sql.aggregateSQL("{age}", []string{"SUM", "COUNT"})
+	a.NotError(err).StringEqual(query, "SELECT SUM([age]),COUNT([age]) FROM prefix_user WHERE([age]>?)", style)
+
+	// GroupBy()
+	sql = db.SQL().Table("#user").Columns("{gid}").GroupBy("{gid}").Having("COUNT(*)>?", 1)
+	query, err = sql.aggregateSQL("", nil)
+	a.NotError(err).StringEqual(query, "SELECT COUNT(*) FROM(SELECT 1 AS agg0 FROM prefix_user GROUP BY [gid] HAVING(COUNT(*)>?)) tmp", style)
+	query, err = sql.aggregateSQL("{age}", []string{"SUM", "COUNT"})
+	a.NotError(err).StringEqual(query, "SELECT SUM(agg0),SUM(agg1) FROM(SELECT SUM([age]) AS agg0,COUNT([age]) AS agg1 FROM prefix_user GROUP BY [gid] HAVING(COUNT(*)>?)) tmp", style)
+
+	// Distinct()
+	sql = db.SQL().Table("#user").Columns("{gid}").Distinct()
+	query, err = sql.aggregateSQL("", nil)
+	a.NotError(err).StringEqual(query, "SELECT COUNT(*) FROM(SELECT DISTINCT [gid] FROM prefix_user) tmp", style)
+	query, err = sql.aggregateSQL("{age}", []string{"MAX"})
+	a.NotError(err).StringEqual(query, "SELECT MAX(agg0) FROM(SELECT DISTINCT [age] AS agg0 FROM prefix_user) tmp", style)
+
+	// Distinct()未指定列
+	_, err = db.SQL().Table("#user").Distinct().aggregateSQL("", nil)
+	a.Error(err)
+}
+
+func TestSQLAggregate(t *testing.T) {
+	a := assert.New(t)
+	e := newUtilDB(a, "aggregate")
+	defer closeUtilDB(a, "aggregate")
+
+	users := []*utilUser{
+		{ID: 1, Name: "u1", Version: 1},
+		{ID: 2, Name: "u1", Version: 2},
+		{ID: 3, Name: "u2", Version: 3},
+		{ID: 4, Name: "u3", Version: 6},
+	}
+	_, err := e.InsertBatch(users, 0)
+	a.NotError(err)
+
+	cnt, err := e.SQL().Table("#user").Count()
+	a.NotError(err).Equal(cnt, 4)
+
+	cnt, err = e.SQL().Table("#user").Where("{version}>?", 2).Count()
+	a.NotError(err).Equal(cnt, 2)
+
+	cnt, err = e.SQL().Table("#user").Columns("{name}").Distinct().Count()
+	a.NotError(err).Equal(cnt, 3)
+
+	cnt, err = e.SQL().Table("#user").Columns("{name}").GroupBy("{name}").Having("COUNT(*)>?", 1).Count()
+	a.NotError(err).Equal(cnt, 1)
+
+	sum, err := e.SQL().Table("#user").Sum("{version}")
+	a.NotError(err).Equal(sum, 12)
+
+	avg, err := e.SQL().Table("#user").Avg("{version}")
+	a.NotError(err).Equal(avg, 3)
+
+	var max int64
+	a.NotError(e.SQL().Table("#user").Max("{version}", &max))
+	a.Equal(max, 6)
+
+	var min int64
+	a.NotError(e.SQL().Table("#user").Where("{name}=?", "u1").Min("{version}", &min))
+	a.Equal(min, 1)
+
+	var name string
+	a.NotError(e.SQL().Table("#user").Max("{name}", &name))
+	a.Equal(name, "u3")
+
+	// 分组之后再聚合：只统计记录数量大于1的分组，即u1
+	sum, err = e.SQL().Table("#user").GroupBy("{name}").Having("COUNT(*)>?", 1).Sum("{version}")
+	a.NotError(err).Equal(sum, 3)
+	avg, err = e.SQL().Table("#user").GroupBy("{name}").Avg("{version}")
+	a.NotError(err).Equal(avg, 3)
+	a.NotError(e.SQL().Table("#user").GroupBy("{name}").Having("COUNT(*)>?", 1).Max("{version}", &max))
+	a.Equal(max, 2)
+
+	// 对不重复的值进行聚合
+	cnt, err = e.SQL().Table("#user").Columns("{name}").Distinct().Count()
+	a.NotError(err).Equal(cnt, 3)
+	avg, err = e.SQL().Table("#user").Where("{id}<?", 3).Distinct().Avg("{name}='u1'")
+	a.NotError(err).Equal(avg, 1)
+
+	// 没有符合条件的记录
+	sum, err = e.SQL().Table("#user").Where("{id}>?", 100).Sum("{version}")
+	a.NotError(err).Equal(sum, 0)
+	avg, err = e.SQL().Table("#user").Where("{id}>?", 100).Avg("{version}")
+	a.NotError(err).Equal(avg, 0)
+	max = 5
+	a.Equal(e.SQL().Table("#user").Where("{id}>?", 100).Max("{version}", &max), sql.ErrNoRows)
+	a.Equal(max, 5)
+	a.Equal(e.SQL().Table("#user").Where("{id}>?", 100).GroupBy("{name}").Max("{version}", &max), sql.ErrNoRows)
+}
@@ -0,0 +1,346 @@
+// Copyright 2014 by caixw, All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package orm
+
+import (
+	"container/list"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/caixw/lib.go/orm/core"
+)
+
+// 查询结果的缓存，通过Engine.SetCache()指定，SQL.Cache()启用。
+//
+// 缓存的内容在返回给调用者之前会被深度复制，调用者可以随意修改查询的结果。
+// 实现者不需要也不应该修改缓存的内容。
+type Cache interface {
+	// 获取键名为key的缓存内容，不存在或是已经过期时，found返回false。
+	Get(key string) (val interface{}, found bool)
+
+	// 缓存val，ttl为缓存的有效时长，
+	// tables为该查询涉及的表名，供Invalidate()使用。
+	Set(key string, val interface{}, ttl time.Duration, tables []string)
+
+	// 清除所有与表table相关的缓存。
+	Invalidate(table string)
+}
+
+type lruItem struct {
+	key     string
+	val     interface{}
+	expires time.Time
+	tables  []string
+}
+
+// 基于内存的LRU缓存。
+type lruCache struct {
+	sync.Mutex
+	size   int
+	list   *list.List                     // 最近使用的在前
+	items  map[string]*list.Element       // 以键名为索引
+	tables map[string]map[string]struct{} // 表名对应的所有键名
+}
+
+// 声明一个基于内存的LRU缓存，最多保存size条记录，
+// 超出时淘汰最久未使用的记录；size小于等于0时不限制数量。
+//  e.SetCache(orm.NewLRUCache(1000))
+func NewLRUCache(size int) Cache {
+	return &lruCache{
+		size:   size,
+		list:   list.New(),
+		items:  map[string]*list.Element{},
+		tables: map[string]map[string]struct{}{},
+	}
+}
+
+// implement Cache.Get()
+func (c *lruCache) Get(key string) (interface{}, bool) {
+	c.Lock()
+	defer c.Unlock()
+
+	elem, found := c.items[key]
+	if !found {
+		return nil, false
+	}
+
+	item := elem.Value.(*lruItem)
+	if time.Now().After(item.expires) {
+		c.remove(elem)
+		return nil, false
+	}
+
+	c.list.MoveToFront(elem)
+	return item.val, true
+}
+
+// implement Cache.Set()
+func (c *lruCache) Set(key string, val interface{}, ttl time.Duration, tables []string) {
+	c.Lock()
+	defer c.Unlock()
+
+	if elem, found := c.items[key]; found {
+		c.remove(elem)
+	}
+
+	c.items[key] = c.list.PushFront(&lruItem{
+		key:     key,
+		val:     val,
+		expires: time.Now().Add(ttl),
+		tables:  tables,
+	})
+	for _, table := range tables {
+		keys, found := c.tables[table]
+		if !found {
+			keys = map[string]struct{}{}
+			c.tables[table] = keys
+		}
+		keys[key] = struct{}{}
+	}
+
+	if c.size > 0 && c.list.Len() > c.size {
+		c.remove(c.list.Back())
+	}
+}
+
+// implement Cache.Invalidate()
+func (c *lruCache) Invalidate(table string) {
+	c.Lock()
+	defer c.Unlock()
+
+	for key := range c.tables[table] {
+		c.remove(c.items[key])
+	}
+}
+
+// 删除elem及其在c.tables中的索引，调用者需要负责加锁。
+func (c *lruCache) remove(elem *list.Element) {
+	item := c.list.Remove(elem).(*lruItem)
+	delete(c.items, item.key)
+
+	for _, table := range item.tables {
+		keys := c.tables[table]
+		delete(keys, item.key)
+		if len(keys) == 0 {
+			delete(c.tables, table)
+		}
+	}
+}
+
+// 指定查询结果的缓存，为nil表示不缓存。
+// 由e派生的实例，比如UsePrimary()和WithPrefix()的返回值，会继承派生时的设置，
+// 所以需要在派生之前调用，也不能在执行语句的同时调用。
+//
+// 多个Engine不应该共用同一个Cache实例，否则相同的语句可能会返回其它数据库中的数据。
+func (e *Engine) SetCache(c Cache) {
+	e.cache = c
+}
+
+// 缓存当前查询语句的结果ttl时长，ttl小于等于0表示不缓存。
+// 需要先通过Engine.SetCache()指定缓存，否则不启用。
+//  e.SQL().Table("#user").Columns("{id}").Cache(time.Minute).FetchColumns("id")
+//
+// 仅对Fetch()、Fetch2Map()、Fetch2Maps()、FetchColumn()和FetchColumns()
+// 及其Context版本有效，以最终的语句和参数作为键名。
+// Fetch()只缓存struct指针和slice指针的查询结果，且v原有的内容会被整个替换成查询的结果，
+// 而不是像未启用缓存时那样，在v原有的内容上填充。
+// 通过Engine和SQL在某个表上执行的Insert、Update和Delete等操作，会清除与该表相关的缓存；
+// 直接执行的SQL语句、子查询和预加载中的表不在此列，需要通过Cache.Invalidate()手动清除。
+// 事务中的查询不使用缓存，事务中的写操作在提交之后才清除缓存。
+// 存在从库时，只有UsePrimary()返回的实例中的查询才使用缓存，从库上的查询不使用缓存。
+func (s *SQL) Cache(ttl time.Duration) *SQL {
+	s.cacheTTL = ttl
+	return s
+}
+
+// 返回当前查询使用的Cache以及缓存的键名，未启用缓存时，返回nil。
+// kind用于区分不同方法返回的不同类型的结果。
+func (s *SQL) cacheKey(kind string, args []interface{}) (Cache, string) {
+	if s.cacheTTL <= 0 || s.HasErrors() {
+		return nil, ""
+	}
+
+	// 从库的数据可能存在同步延迟，不缓存从库上的查询，以免在整个ttl内返回旧数据。
+	e, ok := s.db.(*Engine)
+	if !ok || e.cache == nil || (e.replicas != nil && !e.primaryOnly) {
+		return nil, ""
+	}
+
+	if len(args) == 0 {
+		args = s.selectArgs()
+	}
+	return e.cache, fmt.Sprintf("%s\x00%s\x00%#v", kind, s.selectSQL(), args)
+}
+
+// 若启用了缓存，则优先从缓存中获取结果，否则调用fn获取结果并缓存。
+func (s *SQL) cached(kind string, args []interface{}, fn func() (interface{}, error)) (interface{}, error) {
+	c, key := s.cacheKey(kind, args)
+	if c == nil {
+		return fn()
+	}
+
+	if val, found := c.Get(key); found {
+		return copyInterface(val), nil
+	}
+
+	val, err := fn()
+	if err != nil {
+		return nil, err
+	}
+	c.Set(key, val, s.cacheTTL, s.cacheTables())
+	return copyInterface(val), nil
+}
+
+// 返回当前查询涉及的所有表名
+func (s *SQL) cacheTables() []string {
+	tables := make([]string, 0, len(s.joinTables)+1)
+	tables = append(tables, cacheTableName(s.db, s.tableName))
+	for _, table := range s.joinTables {
+		tables = append(tables, cacheTableName(s.db, table))
+	}
+	return tables
+}
+
+var cacheTableReplacer = strings.NewReplacer("{", "", "}", "")
+
+// 将语句中的表名转换成缓存中使用的表名：去掉别名和引号，并替换表名前缀。
+//  {#user} AS u ==> prefix_user
+func cacheTableName(db core.DB, table string) string {
+	if fields := strings.Fields(table); len(fields) > 0 {
+		table = fields[0]
+	}
+	return db.PrepareSQL(cacheTableReplacer.Replace(table))
+}
+
+// 在对表table执行写操作之后，清除与该表相关的缓存。
+// 事务中的操作，记录在顶层事务中，待提交之后再清除。
+func invalidateCache(db core.DB, table string) {
+	switch inst := db.(type) {
+	case *Engine:
+		if inst.cache != nil {
+			inst.cache.Invalidate(cacheTableName(db, table))
+		}
+	case *Tx:
+		if inst.engine.cache == nil {
+			return
+		}
+
+		root := inst
+		for root.parent != nil {
+			root = root.parent
+		}
+		root.tables = append(root.tables, cacheTableName(db, table))
+	}
+}
+
+// 清除事务中执行过写操作的表的缓存，仅在顶层事务提交之后调用。
+func (t *Tx) invalidateCache() {
+	if t.engine.cache == nil {
+		return
+	}
+
+	for _, table := range t.tables {
+		t.engine.cache.Invalidate(table)
+	}
+}
+
+// 深度复制v的值，以免多个调用者共用同一份数据。
+//
+// 指针、slice、map和struct的可导出字段都会被复制，
+// 相同的指针复制之后依然指向同一个新对象，所以可以包含循环引用。
+func copyValue(v reflect.Value) reflect.Value {
+	return copyValueWith(v, map[copiedPtr]reflect.Value{})
+}
+
+// 功能同copyValue()，但参数和返回值都为interface{}。
+func copyInterface(v interface{}) interface{} {
+	if v == nil {
+		return nil
+	}
+	return copyValue(reflect.ValueOf(v)).Interface()
+}
+
+// 已经复制过的指针，以指针的类型和地址作为键名。
+type copiedPtr struct {
+	t reflect.Type
+	p uintptr
+}
+
+func copyValueWith(v reflect.Value, copied map[copiedPtr]reflect.Value) reflect.Value {
+	ret := reflect.New(v.Type()).Elem()
+
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			break
+		}
+
+		key := copiedPtr{t: v.Type(), p: v.Pointer()}
+		if ptr, found := copied[key]; found {
+			ret.Set(ptr)
+			break
+		}
+		ptr := reflect.New(v.Type().Elem())
+		copied[key] = ptr
+		ptr.Elem().Set(copyValueWith(v.Elem(), copied))
+		ret.Set(ptr)
+	case reflect.Interface:
+		if !v.IsNil() {
+			ret.Set(copyValueWith(v.Elem(), copied))
+		}
+	case reflect.Slice:
+		if v.IsNil() {
+			break
+		}
+
+		ret.Set(reflect.MakeSlice(v.Type(), v.Len(), v.Len()))
+		for i := 0; i < v.Len(); i++ {
+			ret.Index(i).Set(copyValueWith(v.Index(i), copied))
+		}
+	case reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			ret.Index(i).Set(copyValueWith(v.Index(i), copied))
+		}
+	case reflect.Map:
+		if v.IsNil() {
+			break
+		}
+
+		ret.Set(reflect.MakeMapWithSize(v.Type(), v.Len()))
+		for _, key := range v.MapKeys() {
+			ret.SetMapIndex(key, copyValueWith(v.MapIndex(key), copied))
+		}
+	case reflect.Struct:
+		ret.Set(v) // 不可导出的字段只能整体复制
+		for i := 0; i < v.NumField(); i++ {
+			if field := ret.Field(i); field.CanSet() {
+				field.Set(copyValueWith(v.Field(i), copied))
+			}
+		}
+	default:
+		ret.Set(v)
+	}
+
+	return ret
+}
+
+// 返回类型t的唯一名称，包含包的导入路径，
+// 以区分不同包中的同名类型：[]*github.com/caixw/lib.go/orm.utilUser
+func typeName(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.Ptr:
+		return "*" + typeName(t.Elem())
+	case reflect.Slice:
+		return "[]" + typeName(t.Elem())
+	}
+
+	if t.Name() == "" { // 匿名类型
+		return t.String()
+	}
+	return t.PkgPath() + "." + t.Name()
+}
@@ -0,0 +1,197 @@
+// Copyright 2014 by caixw, All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package orm
+
+import (
+	"html/template"
+	"reflect"
+	"testing"
+	texttemplate "text/template"
+	"time"
+
+	"github.com/caixw/lib.go/assert"
+)
+
+func TestLRUCache(t *testing.T) {
+	a := assert.New(t)
+	c := NewLRUCache(2)
+
+	c.Set("k1", 1, time.Minute, []string{"t1"})
+	c.Set("k2", 2, time.Minute, []string{"t1", "t2"})
+	val, found := c.Get("k1")
+	a.True(found).Equal(val, 1)
+
+	// 超出数量，淘汰最久未使用的k2
+	c.Set("k3", 3, time.Minute, []string{"t2"})
+	val, found = c.Get("k2")
+	a.False(found).Nil(val)
+	val, found = c.Get("k3")
+	a.True(found).Equal(val, 3)
+
+	// 按表名清除
+	c.Invalidate("t2")
+	_, found = c.Get("k3")
+	a.False(found)
+	_, found = c.Get("k1")
+	a.True(found)
+
+	// 过期
+	c.Set("k4", 4, time.Millisecond, nil)
+	time.Sleep(5 * time.Millisecond)
+	_, found = c.Get("k4")
+	a.False(found)
+
+	lru := c.(*lruCache)
+	a.Equal(lru.list.Len(), 1).
+		Equal(len(lru.items), 1).
+		Equal(len(lru.tables), 1)
+}
+
+func TestSQLCache(t *testing.T) {
+	a := assert.New(t)
+	e := newUtilDB(a, "cache")
+	defer closeUtilDB(a, "cache")
+	e.SetCache(NewLRUCache(10))
+
+	a.NotError(e.Insert(&utilUser{ID: 1, Name: "u1"}))
+
+	fetchIDs := func() []interface{} {
+		ids, err := e.SQL().Table("#user").Columns("{id}").Asc("{id}").Cache(time.Minute).FetchColumns("id")
+		a.NotError(err)
+		return ids
+	}
+	a.Equal(fetchIDs(), []interface{}{1})
+
+	// 直接执行的语句不会清除缓存
+	_, err := e.Exec(e.PrepareSQL("INSERT INTO #user({id},{name},{version}) VALUES(2,'u2',0)"))
+	a.NotError(err)
+	a.Equal(fetchIDs(), []interface{}{1})
+
+	// 未启用缓存
+	ids, err := e.SQL().Table("#user").Columns("{id}").Asc("{id}").FetchColumns("id")
+	a.NotError(err).Equal(ids, []interface{}{1, 2})
+
+	// Engine.Insert()清除缓存
+	a.NotError(e.Insert(&utilUser{ID: 3, Name: "u3"}))
+	a.Equal(fetchIDs(), []interface{}{1, 2, 3})
+
+	// Fetch
+	fetchUsers := func() []*utilUser {
+		users := []*utilUser{}
+		err := e.SQL().Table("#user").Columns("*").Asc("{id}").Cache(time.Minute).Fetch(&users)
+		a.NotError(err)
+		return users
+	}
+	a.Equal(len(fetchUsers()), 3)
+	a.NotError(e.Delete(&utilUser{ID: 1}))
+	users := fetchUsers()
+	a.Equal(len(users), 2).Equal(users[0].ID, 2)
+
+	// 事务提交之后清除缓存
+	tx, err := e.Begin()
+	a.NotError(err)
+	a.NotError(tx.Update(&utilUser{ID: 2, Name: "u22"}))
+	a.Equal(fetchUsers()[0].Name, "u2")
+	a.NotError(tx.Commit())
+	a.Equal(fetchUsers()[0].Name, "u22")
+}
+
+func TestSQLCacheFetch(t *testing.T) {
+	a := assert.New(t)
+	e := newUtilDB(a, "cache_fetch")
+	defer closeUtilDB(a, "cache_fetch")
+	e.SetCache(NewLRUCache(10))
+
+	a.NotError(e.Insert([]*utilUser{{ID: 1, Name: "u1"}, {ID: 2, Name: "u2"}}))
+
+	// 调用者预先填充的字段不会被缓存
+	u := &utilUser{Version: 5}
+	err := e.SQL().Table("#user").Columns("{id}", "{name}").Where("{id}=?", 1).Cache(time.Minute).Fetch(u)
+	a.NotError(err).Equal(u, &utilUser{ID: 1, Name: "u1"})
+	u = &utilUser{Version: 6}
+	err = e.SQL().Table("#user").Columns("{id}", "{name}").Where("{id}=?", 1).Cache(time.Minute).Fetch(u)
+	a.NotError(err).Equal(u, &utilUser{ID: 1, Name: "u1"})
+
+	// 更长的slice，多余的元素不会被缓存
+	users := []*utilUser{{}, {}, {ID: 100}}
+	err = e.SQL().Table("#user").Columns("*").Asc("{id}").Cache(time.Minute).Fetch(&users)
+	a.NotError(err).Equal(len(users), 2).Equal(users[1].ID, 2)
+	users = []*utilUser{}
+	err = e.SQL().Table("#user").Columns("*").Asc("{id}").Cache(time.Minute).Fetch(&users)
+	a.NotError(err).Equal(len(users), 2).Equal(users[0].ID, 1)
+
+	// 没有符合条件的记录时，v保持不变
+	for i := 0; i < 2; i++ {
+		u = &utilUser{ID: 100}
+		err = e.SQL().Table("#user").Columns("*").Where("{id}=?", 3).Cache(time.Minute).Fetch(u)
+		a.NotError(err).Equal(u.ID, 100)
+	}
+}
+
+func TestSQLCacheCopy(t *testing.T) {
+	a := assert.New(t)
+	e := newUtilDB(a, "cache_copy")
+	defer closeUtilDB(a, "cache_copy")
+	e.SetCache(NewLRUCache(10))
+
+	a.NotError(e.Insert([]*utilUser{{ID: 1, Name: "u1"}, {ID: 2, Name: "u2"}}))
+
+	// 修改返回的结果，不会影响缓存的内容
+	fetchUsers := func() []*utilUser {
+		users := []*utilUser{}
+		err := e.SQL().Table("#user").Columns("*").Asc("{id}").Cache(time.Minute).Fetch(&users)
+		a.NotError(err)
+		return users
+	}
+	users := fetchUsers()
+	users[0].Name = "changed"
+	a.Equal(fetchUsers()[0].Name, "u1")
+	fetchUsers()[0].Name = "changed"
+	a.Equal(fetchUsers()[0].Name, "u1")
+
+	fetchMap := func() map[string]interface{} {
+		m, err := e.SQL().Table("#user").Columns("{name}").Where("{id}=?", 1).Cache(time.Minute).Fetch2Map()
+		a.NotError(err)
+		return m
+	}
+	fetchMap()["name"] = "changed"
+	a.Equal(fetchMap()["name"], "u1")
+}
+
+type cacheNode struct {
+	Name     string
+	Children []*cacheNode
+	Parent   *cacheNode
+	Attrs    map[string]interface{}
+}
+
+func TestCopyValue(t *testing.T) {
+	a := assert.New(t)
+
+	root := &cacheNode{Name: "root", Attrs: map[string]interface{}{"tags": []string{"a"}}}
+	child := &cacheNode{Name: "child", Parent: root}
+	root.Children = []*cacheNode{child, child}
+
+	v := copyValue(reflect.ValueOf(root)).Interface().(*cacheNode)
+	a.True(v != root).Equal(v.Name, "root")
+	a.True(v.Children[0] != child).Equal(v.Children[0].Name, "child")
+	a.True(v.Children[0] == v.Children[1]) // 相同的指针复制之后依然相同
+	a.True(v.Children[0].Parent == v)      // 循环引用
+
+	v.Attrs["tags"].([]string)[0] = "b"
+	a.Equal(root.Attrs["tags"], []string{"a"})
+
+	var nilUsers []*utilUser
+	a.Nil(copyValue(reflect.ValueOf(nilUsers)).Interface())
+	a.Nil(copyInterface(nil))
+}
+
+func TestTypeName(t *testing.T) {
+	a := assert.New(t)
+
+	a.Equal(typeName(reflect.TypeOf([]*utilUser{})), "[]*github.com/caixw/lib.go/orm.utilUser")
+	a.NotEqual(typeName(reflect.TypeOf(template.Template{})), typeName(reflect.TypeOf(texttemplate.Template{})))
+	a.Equal(typeName(reflect.TypeOf(struct{ ID int }{})), "struct { ID int }")
+}
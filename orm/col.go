@@ -0,0 +1,139 @@
+// Copyright 2014 by caixw, All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package orm
+
+import (
+	"errors"
+	"strings"
+)
+
+// 表示表中的一列，值为带引号的列名，比如{name}。
+//
+// 一般由orm/gen根据model生成，而不是手动声明。
+// 通过Col的方法生成查询条件，可以避免直接书写列名所带来的拼写错误：
+//  e.SQL().Table(UserTable).
+//      Columns(UserCols.ID.String(), UserCols.Name.String()).
+//      WhereCond(UserCols.Name.Like("abc%")).
+//      AndCond(UserCols.Age.Gt(18)).
+//      FetchMaps()
+type Col string
+
+// 查询条件，由Col的各个方法生成，通过SQL.AndCond()等方法使用。
+type Cond struct {
+	Expr string        // 条件语句，值以?占位符代替
+	Args []interface{} // 占位符对应的值
+	err  error
+}
+
+// 返回列名
+func (c Col) String() string {
+	return string(c)
+}
+
+func (c Col) cond(op string, arg interface{}) Cond {
+	return Cond{Expr: string(c) + op + "?", Args: []interface{}{arg}}
+}
+
+// col=?
+func (c Col) Eq(v interface{}) Cond {
+	return c.cond("=", v)
+}
+
+// col<>?
+func (c Col) Neq(v interface{}) Cond {
+	return c.cond("<>", v)
+}
+
+// col>?
+func (c Col) Gt(v interface{}) Cond {
+	return c.cond(">", v)
+}
+
+// col>=?
+func (c Col) Gte(v interface{}) Cond {
+	return c.cond(">=", v)
+}
+
+// col<?
+func (c Col) Lt(v interface{}) Cond {
+	return c.cond("<", v)
+}
+
+// col<=?
+func (c Col) Lte(v interface{}) Cond {
+	return c.cond("<=", v)
+}
+
+// col LIKE ?
+func (c Col) Like(pattern string) Cond {
+	return c.cond(" LIKE ", pattern)
+}
+
+// col NOT LIKE ?
+func (c Col) NotLike(pattern string) Cond {
+	return c.cond(" NOT LIKE ", pattern)
+}
+
+// col BETWEEN ? AND ?
+func (c Col) Between(start, end interface{}) Cond {
+	return Cond{Expr: string(c) + " BETWEEN ? AND ?", Args: []interface{}{start, end}}
+}
+
+// col IN(?,?...)
+// 若vals只有一个元素，且为*SQL类型，则产生col IN(SELECT ...)的子查询语句。
+func (c Col) In(vals ...interface{}) Cond {
+	return c.in(" IN(", vals)
+}
+
+// col NOT IN(?,?...)
+func (c Col) NotIn(vals ...interface{}) Cond {
+	return c.in(" NOT IN(", vals)
+}
+
+func (c Col) in(op string, vals []interface{}) Cond {
+	if len(vals) == 0 {
+		return Cond{err: errors.New("in:vals参数不能为空")}
+	}
+
+	placeholder := strings.Repeat("?,", len(vals))
+	return Cond{
+		Expr: string(c) + op + placeholder[:len(placeholder)-1] + ")",
+		Args: vals,
+	}
+}
+
+// col IS NULL
+func (c Col) IsNull() Cond {
+	return Cond{Expr: string(c) + " IS NULL"}
+}
+
+// col IS NOT NULL
+func (c Col) IsNotNull() Cond {
+	return Cond{Expr: string(c) + " IS NOT NULL"}
+}
+
+// SQL.AndCond()的别名
+func (s *SQL) WhereCond(c Cond) *SQL {
+	return s.AndCond(c)
+}
+
+// WHERE ... AND cond
+func (s *SQL) AndCond(c Cond) *SQL {
+	return s.buildCond(0, c)
+}
+
+// WHERE ... OR cond
+func (s *SQL) OrCond(c Cond) *SQL {
+	return s.buildCond(1, c)
+}
+
+func (s *SQL) buildCond(op int, c Cond) *SQL {
+	if c.err != nil {
+		s.errors = append(s.errors, c.err)
+		return s
+	}
+
+	return s.build(op, c.Expr, c.Args...)
+}
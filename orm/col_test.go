@@ -0,0 +1,77 @@
+// Copyright 2014 by caixw, All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package orm
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/caixw/lib.go/assert"
+)
+
+var utilUserCols = struct {
+	ID   Col
+	Name Col
+}{
+	ID:   "{id}",
+	Name: "{name}",
+}
+
+func TestCol(t *testing.T) {
+	a := assert.New(t)
+
+	c := utilUserCols.Name.Eq("abc")
+	a.Equal(c.Expr, "{name}=?").Equal(c.Args, []interface{}{"abc"})
+
+	c = utilUserCols.Name.Like("abc%")
+	a.Equal(c.Expr, "{name} LIKE ?").Equal(c.Args, []interface{}{"abc%"})
+
+	c = utilUserCols.ID.Between(1, 5)
+	a.Equal(c.Expr, "{id} BETWEEN ? AND ?").Equal(c.Args, []interface{}{1, 5})
+
+	c = utilUserCols.ID.In(1, 2, 3)
+	a.Equal(c.Expr, "{id} IN(?,?,?)").Equal(c.Args, []interface{}{1, 2, 3})
+
+	c = utilUserCols.ID.NotIn(1)
+	a.Equal(c.Expr, "{id} NOT IN(?)")
+
+	c = utilUserCols.ID.In()
+	a.Error(c.err)
+
+	c = utilUserCols.Name.IsNotNull()
+	a.Equal(c.Expr, "{name} IS NOT NULL").Equal(len(c.Args), 0)
+}
+
+func TestSQLCond(t *testing.T) {
+	a := assert.New(t)
+	e := newUtilDB(a, "cond")
+	defer closeUtilDB(a, "cond")
+
+	for i := int64(1); i <= 5; i++ {
+		a.NotError(e.Insert(&utilUser{ID: i, Name: "name" + strconv.FormatInt(i, 10)}))
+	}
+
+	ids, err := e.SQL().Table("#user").
+		Columns(utilUserCols.ID.String()).
+		WhereCond(utilUserCols.ID.Gt(1)).
+		AndCond(utilUserCols.Name.Neq("name3")).
+		OrCond(utilUserCols.ID.Eq(1)).
+		Asc(utilUserCols.ID.String()).
+		FetchColumns("id")
+	a.NotError(err).Equal(ids, []interface{}{1, 2, 4, 5})
+
+	// 子查询
+	sub := e.SQL().Table("#user").Columns("{id}").WhereCond(utilUserCols.ID.Lte(2))
+	ids, err = e.SQL().Table("#user").
+		Columns("{id}").
+		WhereCond(utilUserCols.ID.In(sub)).
+		Asc("{id}").
+		FetchColumns("id")
+	a.NotError(err).Equal(ids, []interface{}{1, 2})
+
+	// 错误的条件
+	_, err = e.SQL().Table("#user").Columns("{id}").WhereCond(utilUserCols.ID.In()).FetchColumns("id")
+	a.Error(err)
+}
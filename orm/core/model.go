@@ -5,6 +5,8 @@
 package core
 
 import (
+	"database/sql"
+	"database/sql/driver"
 	"errors"
 	"fmt"
 	"reflect"
@@ -17,6 +19,11 @@ import (
 	"github.com/caixw/lib.go/encoding/tag"
 )
 
+var (
+	scannerType = reflect.TypeOf((*sql.Scanner)(nil)).Elem()
+	valuerType  = reflect.TypeOf((*driver.Valuer)(nil)).Elem()
+)
+
 type conType int
 
 // 预定的约束类型，方便Model中使用。
@@ -45,14 +52,23 @@ func (t conType) String() string {
 	}
 }
 
-// model缓存
-var models = &modelsMap{items: map[reflect.Type]*Model{}}
+// 全局的model缓存，供NewModel()等函数使用。
+var models = NewModels()
 
-type modelsMap struct {
+// Model的缓存容器。
+// 每个orm.Engine都有一个独立的实例，互不影响。
+type Models struct {
 	sync.Mutex
 	items map[reflect.Type]*Model
 }
 
+// 声明一个新的Models实例
+func NewModels() *Models {
+	return &Models{
+		items: map[reflect.Type]*Model{},
+	}
+}
+
 // go本身不支持struct级别的struct tag，所以想要给一个struct
 // 指定struct tag，只能通过一个函数返回一段描述信息。
 type Metaer interface {
@@ -72,17 +88,21 @@ type Model struct {
 	FK            map[string]*ForeignKey // 外键
 	PK            []*Column              // 主键
 	AI            *AutoIncr              // 自增列
+	Version       *Column                // 乐观锁的版本号列
+	SoftDelete    *Column                // 软删除列，保存删除时的时间戳
 	Check         map[string]string      // Check
 	Meta          map[string][]string    // 表级别的元数据，如存储引擎，字符集等。
 
 	constraints map[string]conType // 约束名缓存
 }
 
-// 外键
+// 外键，Cols与RefColNames一一对应，
+// 复合外键包含多个列，只能通过Metaer.Meta()指定。
 type ForeignKey struct {
-	Col                      *Column
-	RefTableName, RefColName string
-	UpdateRule, DeleteRule   string
+	Cols                   []*Column
+	RefTableName           string
+	RefColNames            []string
+	UpdateRule, DeleteRule string
 }
 
 // 自增列
@@ -96,6 +116,7 @@ type Column struct {
 	model *Model
 
 	Name     string // 数据库的字段名
+	GoName   string // Go语言中的字段名
 	Len1     int
 	Len2     int
 	Nullable bool         // 是否可以为NULL
@@ -103,6 +124,14 @@ type Column struct {
 
 	HasDefault bool
 	Default    string // 默认值
+
+	// 通过type()指定的数据库类型，不为空时，
+	// 创建表时直接使用该值，而不是根据GoType推导。
+	SQLType string
+
+	// 是否以JSON格式保存，由json属性指定。
+	// 写入时会被转换成JSON字符串，读取时再转换回原来的类型。
+	JSON bool
 }
 
 // 当前列是否为自增列
@@ -110,6 +139,68 @@ func (c *Column) IsAI() bool {
 	return (c.model.AI != nil) && (c.model.AI.Col == c)
 }
 
+// 当前列的类型是否实现了sql.Scanner接口
+func (c *Column) IsScanner() bool {
+	return c.GoType.Implements(scannerType) || reflect.PtrTo(c.GoType).Implements(scannerType)
+}
+
+// 当前列的类型是否实现了driver.Valuer接口
+func (c *Column) IsValuer() bool {
+	return c.GoType.Implements(valuerType) || reflect.PtrTo(c.GoType).Implements(valuerType)
+}
+
+// 若GoType实现了driver.Valuer接口，返回其零值调用Value()之后的类型，
+// 即该列实际保存到数据库中的值的类型；否则返回nil。
+// 零值的Value()返回nil或是错误时，同样返回nil，比如sql.NullString等类型。
+// GoType为指针时，以其指向的类型的零值调用Value()。
+func (c *Column) DriverType() reflect.Type {
+	if !c.IsValuer() {
+		return nil
+	}
+
+	t := c.GoType
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	valuer, ok := reflect.New(t).Interface().(driver.Valuer)
+	if !ok {
+		return nil
+	}
+
+	val, err := valuer.Value()
+	if err != nil || val == nil {
+		return nil
+	}
+	return reflect.TypeOf(val)
+}
+
+// 将列设置为以JSON格式保存。
+// json
+func (c *Column) setJSON(vals []string) error {
+	if len(vals) != 0 {
+		return fmt.Errorf("[%v]字段的json属性不需要参数:[%v]", c.Name, vals)
+	}
+
+	c.JSON = true
+	return nil
+}
+
+// 从参数中获取Column的SQLType变量。
+// type(DECIMAL(10,2))
+func (c *Column) setSQLType(vals []string) error {
+	if len(vals) == 0 || len(vals[0]) == 0 {
+		return fmt.Errorf("[%v]字段的type属性不能为空", c.Name)
+	}
+
+	// tag包会将括号转换成逗号，DECIMAL(10,2)会被解析成[DECIMAL 10 2]
+	c.SQLType = vals[0]
+	if len(vals) > 1 {
+		c.SQLType += "(" + strings.Join(vals[1:], ",") + ")"
+	}
+	return nil
+}
+
 // 从参数中获取Column的len1和len2变量。
 // len(len1,len2)
 func (c *Column) setLen(vals []string) (err error) {
@@ -147,11 +238,22 @@ func (c *Column) setNullable(vals []string) (err error) {
 	return nil
 }
 
-// 从一个obj声明一个Model实例。
+// 从一个obj声明一个Model实例，并缓存在全局的容器中。
 // obj可以是一个struct实例或是指针。
 func NewModel(obj interface{}) (*Model, error) {
-	models.Lock()
-	defer models.Unlock()
+	return models.New(obj)
+}
+
+// 释放全局容器中所有的Model缓存。
+func FreeModels() {
+	models.Free()
+}
+
+// 从一个obj声明一个Model实例，并缓存在ms中。
+// obj可以是一个struct实例或是指针。
+func (ms *Models) New(obj interface{}) (*Model, error) {
+	ms.Lock()
+	defer ms.Unlock()
 
 	rval := reflect.ValueOf(obj)
 	if rval.Kind() == reflect.Ptr {
@@ -164,7 +266,7 @@ func NewModel(obj interface{}) (*Model, error) {
 	}
 
 	// 是否已经缓存的数组
-	if m, found := models.items[rtype]; found {
+	if m, found := ms.items[rtype]; found {
 		return m, nil
 	}
 
@@ -187,7 +289,7 @@ func NewModel(obj interface{}) (*Model, error) {
 		return nil, err
 	}
 
-	models.items[rtype] = m
+	ms.items[rtype] = m
 	return m, nil
 }
 
@@ -222,7 +324,7 @@ func (m *Model) parseColumn(field reflect.StructField) (err error) {
 
 	// 没有附加的struct tag，直接取得几个关键信息返回。
 	if len(tagTxt) == 0 {
-		m.Cols[field.Name] = &Column{GoType: field.Type, Name: field.Name, model: m}
+		m.Cols[field.Name] = &Column{GoType: field.Type, Name: field.Name, GoName: field.Name, model: m}
 		return nil
 	}
 
@@ -232,7 +334,7 @@ func (m *Model) parseColumn(field reflect.StructField) (err error) {
 		return nil
 	}
 
-	col := &Column{GoType: field.Type, Name: field.Name, model: m}
+	col := &Column{GoType: field.Type, Name: field.Name, GoName: field.Name, model: m}
 	tags := tag.Parse(tagTxt)
 	for k, v := range tags {
 		switch k {
@@ -257,6 +359,14 @@ func (m *Model) parseColumn(field reflect.StructField) (err error) {
 			err = m.setFK(col, v)
 		case "default":
 			err = m.setDefault(col, v)
+		case "version":
+			err = m.setVersion(col, v)
+		case "softdelete":
+			err = m.setSoftDelete(col, v)
+		case "type":
+			err = col.setSQLType(v)
+		case "json":
+			err = col.setJSON(v)
 		default:
 			err = fmt.Errorf("未知的struct tag属性:[%v]", k)
 		}
@@ -284,6 +394,10 @@ func (m *Model) parseMeta(obj interface{}) error {
 
 	for k, v := range tags {
 		switch k {
+		case "fk": // 可能存在多个fk，tags中只保留了最后一个，需要单独解析。
+			if err := m.parseMetaFK(meta.Meta()); err != nil {
+				return err
+			}
 		case "name":
 			if len(v) != 1 {
 				return fmt.Errorf("Meta接口的name属性指定了太多参数：[%v]", v)
@@ -305,6 +419,19 @@ func (m *Model) parseMeta(obj interface{}) error {
 
 			m.constraints[v[0]] = check
 			m.Check[v[0]] = v[1]
+		case "softdelete": // softdelete(colName)
+			if len(v) != 1 {
+				return fmt.Errorf("Meta接口的softdelete属性只能指定一个参数：[%v]", v)
+			}
+
+			col, found := m.Cols[v[0]]
+			if !found {
+				return fmt.Errorf("Meta接口的softdelete属性指定的列[%v]不存在", v[0])
+			}
+
+			if err := m.setSoftDelete(col, nil); err != nil {
+				return err
+			}
 		default:
 			m.Meta[k] = v
 		}
@@ -313,6 +440,47 @@ func (m *Model) parseMeta(obj interface{}) error {
 	return nil
 }
 
+// 解析Meta()中的所有外键，一个外键可以包含多个列，列名之间以空格分隔：
+//  fk(fk_name,col1 col2,refTable,refCol1 refCol2,updateRule,deleteRule)
+func (m *Model) parseMetaFK(meta string) error {
+	for _, part := range strings.Split(meta, ";") {
+		vals, found := tag.Parse(part)["fk"]
+		if !found {
+			continue
+		}
+
+		if len(vals) < 4 {
+			return fmt.Errorf("Meta接口的fk属性的参数不能少于4个，当前值为:[%v]", vals)
+		}
+
+		names := strings.Fields(vals[1])
+		refNames := strings.Fields(vals[3])
+		if len(names) == 0 || len(names) != len(refNames) {
+			return fmt.Errorf("Meta接口的fk属性中，列与引用列的数量不相同:[%v]", vals)
+		}
+
+		cols := make([]*Column, 0, len(names))
+		for _, name := range names {
+			col, found := m.Cols[name]
+			if !found {
+				return fmt.Errorf("Meta接口的fk属性指定的列[%v]不存在", name)
+			}
+			cols = append(cols, col)
+		}
+
+		fkInst := &ForeignKey{
+			Cols:         cols,
+			RefTableName: vals[2],
+			RefColNames:  refNames,
+		}
+		if err := m.addFK(vals[0], fkInst, vals[4:]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 // 通过vals设置字段的default属性
 // default(5)
 func (m *Model) setDefault(col *Column, vals []string) error {
@@ -381,33 +549,37 @@ func (m *Model) setUnique(col *Column, vals []string) error {
 // 通过vals设置字段的foregin key约束
 // fk(fk_name,refTable,refColName,updateRule,deleteRule)
 func (m *Model) setFK(col *Column, vals []string) error {
-	if typ := m.hasConstraint(vals[0], fk); typ != none {
-		return fmt.Errorf("已经存在相同的约束名[%v]，位于[%v]中", vals[0], typ)
-	}
-
 	if len(vals) < 3 {
 		return errors.New("fk参数必须大于3个")
 	}
 
-	if _, found := m.FK[vals[0]]; found {
-		return fmt.Errorf("重复的外键约束名:[%v]", vals[0])
-	}
-
 	fkInst := &ForeignKey{
-		Col:          col,
+		Cols:         []*Column{col},
 		RefTableName: vals[1],
-		RefColName:   vals[2],
+		RefColNames:  []string{vals[2]},
 	}
+	return m.addFK(vals[0], fkInst, vals[3:])
+}
 
-	if len(vals) > 3 { // 存在updateRule
-		fkInst.UpdateRule = vals[3]
+// 添加名为name的外键约束，rules为可选的updateRule和deleteRule。
+func (m *Model) addFK(name string, fkInst *ForeignKey, rules []string) error {
+	if typ := m.hasConstraint(name, fk); typ != none {
+		return fmt.Errorf("已经存在相同的约束名[%v]，位于[%v]中", name, typ)
 	}
-	if len(vals) > 4 { // 存在deleteRule
-		fkInst.DeleteRule = vals[4]
+
+	if _, found := m.FK[name]; found {
+		return fmt.Errorf("重复的外键约束名:[%v]", name)
 	}
 
-	m.constraints[vals[0]] = fk
-	m.FK[vals[0]] = fkInst
+	if len(rules) > 0 { // 存在updateRule
+		fkInst.UpdateRule = rules[0]
+	}
+	if len(rules) > 1 { // 存在deleteRule
+		fkInst.DeleteRule = rules[1]
+	}
+
+	m.constraints[name] = fk
+	m.FK[name] = fkInst
 	return nil
 }
 
@@ -432,6 +604,9 @@ func (m *Model) setAI(col *Column, vals []string) (err error) {
 	case 1:
 		m.AI.Start, err = strconv.Atoi(vals[0])
 	case 2:
+		if m.AI.Start, err = strconv.Atoi(vals[0]); err != nil {
+			return err
+		}
 		m.AI.Step, err = strconv.Atoi(vals[1])
 	default:
 		err = errors.New("AI标签有过多的参数")
@@ -444,6 +619,50 @@ func (m *Model) setAI(col *Column, vals []string) (err error) {
 	return nil
 }
 
+// 通过vals设置Model的版本号列，用于实现乐观锁。
+// version
+func (m *Model) setVersion(col *Column, vals []string) error {
+	if len(vals) != 0 {
+		return fmt.Errorf("[%v]字段的version属性指定了太多的参数:[%v]", col.Name, vals)
+	}
+
+	if m.Version != nil {
+		return fmt.Errorf("已经存在版本号列[%v]", m.Version.Name)
+	}
+
+	switch col.GoType.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+	default:
+		return errors.New("版本号列只能是整数类型")
+	}
+
+	m.Version = col
+	return nil
+}
+
+// 通过vals设置Model的软删除列。该列保存删除时的unix时间戳，
+// 值为0表示未删除。
+// softdelete
+func (m *Model) setSoftDelete(col *Column, vals []string) error {
+	if len(vals) != 0 {
+		return fmt.Errorf("[%v]字段的softdelete属性指定了太多的参数:[%v]", col.Name, vals)
+	}
+
+	if m.SoftDelete != nil {
+		return fmt.Errorf("已经存在软删除列[%v]", m.SoftDelete.Name)
+	}
+
+	switch col.GoType.Kind() {
+	case reflect.Int, reflect.Int32, reflect.Int64, reflect.Uint, reflect.Uint32, reflect.Uint64:
+	default:
+		return errors.New("软删除列只能是int,int32,int64及对应的无符号整数类型")
+	}
+
+	m.SoftDelete = col
+	return nil
+}
+
 // 是否存在指定名称的约束名，name不区分大小写。
 // 若已经存在返回表示该约束类型的常量，否则返回none。
 func (m *Model) hasConstraint(name string, except conType) conType {
@@ -455,10 +674,10 @@ func (m *Model) hasConstraint(name string, except conType) conType {
 	return none
 }
 
-// 释放所有的Model缓存。
-func FreeModels() {
-	models.Lock()
-	defer models.Unlock()
+// 释放ms中所有的Model缓存。
+func (ms *Models) Free() {
+	ms.Lock()
+	defer ms.Unlock()
 
-	models.items = map[reflect.Type]*Model{}
+	ms.items = map[reflect.Type]*Model{}
 }
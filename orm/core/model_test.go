@@ -5,7 +5,10 @@
 package core
 
 import (
+	"database/sql"
+	"database/sql/driver"
 	"fmt"
+	"reflect"
 	"testing"
 
 	"github.com/caixw/lib.go/assert"
@@ -81,7 +84,7 @@ func TestModel(t *testing.T) {
 
 	// cols
 	idCol, found := m.Cols["id"] // 指定名称为小写
-	a.True(found)
+	a.True(found).Equal(idCol.GoName, "Id")
 
 	emailCol, found := m.Cols["Email"] // 未指定别名，与字段名相同
 	a.True(found).True(emailCol.Nullable, "emailCol.Nullable==false")
@@ -103,7 +106,7 @@ func TestModel(t *testing.T) {
 		Equal(usernameCol, index[1])
 
 	// ai
-	a.Equal(m.AI.Col, idCol)
+	a.Equal(m.AI.Col, idCol).Equal(m.AI.Start, 1).Equal(m.AI.Step, 2)
 
 	// 主键应该和自增列相同
 	a.NotNil(m.PK).Equal(m.PK[0], idCol)
@@ -114,9 +117,9 @@ func TestModel(t *testing.T) {
 
 	fk, found := m.FK["fk_name"]
 	a.True(found).
-		Equal(fk.Col, groupCol).
+		Equal(fk.Cols, []*Column{groupCol}).
 		Equal(fk.RefTableName, "table.group").
-		Equal(fk.RefColName, "id").
+		Equal(fk.RefColNames, []string{"id"}).
 		Equal(fk.UpdateRule, "NO ACTION").
 		Equal(fk.DeleteRule, "")
 
@@ -130,3 +133,212 @@ func TestModel(t *testing.T) {
 		"charset": []string{"utf-8"},
 	})
 }
+
+type modelVersion struct {
+	ID      int `orm:"name(id);pk"`
+	Version int `orm:"name(version);version"`
+}
+
+type modelVersions struct {
+	V1 int `orm:"version"`
+	V2 int `orm:"version"`
+}
+
+type modelStringVersion struct {
+	V1 string `orm:"version"`
+}
+
+func TestModelVersion(t *testing.T) {
+	a := assert.New(t)
+
+	m, err := NewModel(&modelVersion{})
+	a.NotError(err).NotNil(m)
+	a.Equal(m.Version, m.Cols["version"])
+
+	// 多个版本号列
+	m, err = NewModel(&modelVersions{})
+	a.Error(err).Nil(m)
+
+	// 非整数类型
+	m, err = NewModel(&modelStringVersion{})
+	a.Error(err).Nil(m)
+
+	// 未指定版本号列
+	m, err = NewModel(&modelGroup{})
+	a.NotError(err).Nil(m.Version)
+}
+
+type modelSoftDelete struct {
+	ID      int   `orm:"name(id);pk"`
+	Deleted int64 `orm:"name(deleted);softdelete"`
+}
+
+func (m *modelSoftDelete) Meta() string {
+	return "name(soft_delete)"
+}
+
+type modelMetaSoftDelete struct {
+	ID      int   `orm:"name(id);pk"`
+	Deleted int64 `orm:"name(deleted)"`
+}
+
+func (m *modelMetaSoftDelete) Meta() string {
+	return "name(meta_soft_delete);softdelete(deleted)"
+}
+
+type modelStringSoftDelete struct {
+	Deleted string `orm:"softdelete"`
+}
+
+func TestModelSoftDelete(t *testing.T) {
+	a := assert.New(t)
+	m, err := NewModel(&modelSoftDelete{})
+	a.NotError(err).NotNil(m)
+	a.Equal(m.SoftDelete, m.Cols["deleted"])
+
+	// 通过Meta()指定
+	m, err = NewModel(&modelMetaSoftDelete{})
+	a.NotError(err).NotNil(m)
+	a.Equal(m.SoftDelete, m.Cols["deleted"])
+
+	// 非整数类型
+	m, err = NewModel(&modelStringSoftDelete{})
+	a.Error(err).Nil(m)
+}
+
+// 实现了driver.Valuer和sql.Scanner接口的类型，以字符串的形式保存。
+type modelStatus int
+
+func (s modelStatus) Value() (driver.Value, error) {
+	return fmt.Sprint(int(s)), nil
+}
+
+func (s *modelStatus) Scan(src interface{}) error {
+	_, err := fmt.Sscan(fmt.Sprint(src), (*int)(s))
+	return err
+}
+
+type modelTypes struct {
+	Price   float64        `orm:"name(price);type(DECIMAL(10,2))"`
+	Status  modelStatus    `orm:"name(status)"`
+	Ptr     *modelStatus   `orm:"name(ptr);nullable"`
+	Name    sql.NullString `orm:"name(name)"`
+	Created int64          `orm:"name(created);type(TIMESTAMP)"`
+}
+
+func TestModelTypes(t *testing.T) {
+	a := assert.New(t)
+	FreeModels()
+	defer FreeModels()
+
+	m, err := NewModel(&modelTypes{})
+	a.NotError(err).NotNil(m)
+
+	a.Equal(m.Cols["price"].SQLType, "DECIMAL(10,2)").
+		Equal(m.Cols["created"].SQLType, "TIMESTAMP").
+		Equal(m.Cols["status"].SQLType, "")
+
+	status := m.Cols["status"]
+	a.True(status.IsValuer()).
+		True(status.IsScanner()).
+		Equal(status.DriverType(), reflect.TypeOf(""))
+
+	// 指针类型
+	ptr := m.Cols["ptr"]
+	a.True(ptr.IsValuer()).
+		True(ptr.IsScanner()).
+		Equal(ptr.DriverType(), reflect.TypeOf(""))
+
+	// 零值的Value()返回nil
+	name := m.Cols["name"]
+	a.True(name.IsValuer()).
+		True(name.IsScanner()).
+		Nil(name.DriverType())
+
+	price := m.Cols["price"]
+	a.False(price.IsValuer()).
+		False(price.IsScanner()).
+		Nil(price.DriverType())
+
+	a.False(m.Cols["price"].JSON)
+
+	// json
+	m, err = NewModel(&struct {
+		Tags []string `orm:"name(tags);json"`
+	}{})
+	a.NotError(err).True(m.Cols["tags"].JSON)
+
+	_, err = NewModel(&struct {
+		Tags []string `orm:"name(tags);json(1)"`
+	}{})
+	a.Error(err)
+
+	// type()不能为空
+	_, err = NewModel(&struct {
+		Price float64 `orm:"type()"`
+	}{})
+	a.Error(err)
+}
+
+type modelMember struct {
+	GroupID int64  `orm:"name(gid);pk"`
+	UserID  int64  `orm:"name(uid);pk"`
+	Type    int    `orm:"name(type)"`
+	Name    string `orm:"name(name)"`
+}
+
+func (m *modelMember) Meta() string {
+	return "name(member);fk(fk_user,uid type,#user,id type,CASCADE,SET NULL);fk(fk_group,gid,#group,id)"
+}
+
+type modelInvalidFK struct {
+	ID int64 `orm:"name(id);pk"`
+}
+
+func (m *modelInvalidFK) Meta() string {
+	return "fk(fk_user,id,#user,id type)"
+}
+
+func TestModelMetaFK(t *testing.T) {
+	a := assert.New(t)
+
+	m, err := NewModel(&modelMember{})
+	a.NotError(err).NotNil(m)
+	a.Equal(m.PK, []*Column{m.Cols["gid"], m.Cols["uid"]})
+	a.Equal(len(m.FK), 2)
+
+	fk, found := m.FK["fk_user"]
+	a.True(found).
+		Equal(fk.Cols, []*Column{m.Cols["uid"], m.Cols["type"]}).
+		Equal(fk.RefTableName, "#user").
+		Equal(fk.RefColNames, []string{"id", "type"}).
+		Equal(fk.UpdateRule, "CASCADE").
+		Equal(fk.DeleteRule, "SET NULL")
+
+	fk, found = m.FK["fk_group"]
+	a.True(found).
+		Equal(fk.Cols, []*Column{m.Cols["gid"]}).
+		Equal(fk.RefColNames, []string{"id"}).
+		Equal(fk.UpdateRule, "")
+
+	// 列与引用列的数量不相同
+	m, err = NewModel(&modelInvalidFK{})
+	a.Error(err).Nil(m)
+}
+
+func TestModelsNew(t *testing.T) {
+	a := assert.New(t)
+	ms1 := NewModels()
+	ms2 := NewModels()
+
+	m1, err := ms1.New(&modelUser{})
+	a.NotError(err).NotNil(m1)
+	a.Equal(1, len(ms1.items)).Equal(0, len(ms2.items))
+
+	m2, err := ms2.New(&modelUser{})
+	a.NotError(err).NotNil(m2)
+	a.True(m1 != m2)
+
+	ms1.Free()
+	a.Equal(0, len(ms1.items)).Equal(1, len(ms2.items))
+}
@@ -5,6 +5,7 @@
 package core
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"sync"
@@ -28,6 +29,11 @@ func NewStmts(d DB) *Stmts {
 // 编译SQL语句成sql.Stmt，并以name为名称缓存。
 // 若该name的缓存已经存在，则返回一个错误信息。
 func (s *Stmts) AddSQL(name, sql string) (*sql.Stmt, error) {
+	return s.AddSQLContext(context.Background(), name, sql)
+}
+
+// 功能同AddSQL()，但预编译过程可以通过ctx取消。
+func (s *Stmts) AddSQLContext(ctx context.Context, name, sql string) (*sql.Stmt, error) {
 	s.Lock()
 	defer s.Unlock()
 
@@ -35,7 +41,7 @@ func (s *Stmts) AddSQL(name, sql string) (*sql.Stmt, error) {
 		return nil, fmt.Errorf("该名称[%v]的stmt已经存在", name)
 	}
 
-	stmt, err := s.db.Prepare(sql)
+	stmt, err := s.db.PrepareContext(ctx, sql)
 	if err != nil {
 		return nil, err
 	}
@@ -48,7 +54,12 @@ func (s *Stmts) AddSQL(name, sql string) (*sql.Stmt, error) {
 // 功能上大致与AddSQL()相同，只是在相同名称已经的sql.Stmt实例
 // 已经存在的情况下，AddSQL()返回错误，而SetSQL()则是替换。
 func (s *Stmts) SetSQL(name, sql string) (*sql.Stmt, error) {
-	stmt, err := s.db.Prepare(sql)
+	return s.SetSQLContext(context.Background(), name, sql)
+}
+
+// 功能同SetSQL()，但预编译过程可以通过ctx取消。
+func (s *Stmts) SetSQLContext(ctx context.Context, name, sql string) (*sql.Stmt, error) {
+	stmt, err := s.db.PrepareContext(ctx, sql)
 	if err != nil {
 		return nil, err
 	}
@@ -88,6 +99,14 @@ func (s *Stmts) Get(name string) (stmt *sql.Stmt, found bool) {
 	return
 }
 
+// 返回缓存的sql.Stmt数量。
+func (s *Stmts) Len() int {
+	s.Lock()
+	defer s.Unlock()
+
+	return len(s.items)
+}
+
 // 清除所有的缓存。
 func (s *Stmts) Clear() {
 	s.free()
@@ -7,6 +7,7 @@
 package core
 
 import (
+	"context"
 	"database/sql"
 	"os"
 	"testing"
@@ -43,7 +44,7 @@ func TestStmtsAddSet(t *testing.T) {
 
 	// 修改同名的sql
 	s.Set("sql1", sqlStmt)
-	a.Equal(3, len(s.items))
+	a.Equal(3, len(s.items)).Equal(3, s.Len())
 
 	// 查找存在的stmt
 	stmt, found := s.Get("sql1")
@@ -55,7 +56,7 @@ func TestStmtsAddSet(t *testing.T) {
 
 	// 释放所有的缓存
 	s.Clear()
-	a.Empty(s.items)
+	a.Empty(s.items).Equal(0, s.Len())
 	stmt, found = s.Get("sql1")
 	a.False(found).Nil(stmt)
 
@@ -143,6 +144,38 @@ func TestStmtsAddSetSQL(t *testing.T) {
 	a.Nil(s.items)
 }
 
+func TestStmtsAddSetSQLContext(t *testing.T) {
+	a := assert.New(t)
+
+	db, err := newFakeDB()
+	a.NotError(err).NotNil(db)
+	defer db.close()
+
+	s := NewStmts(db)
+	a.NotNil(s)
+
+	sql := "SELECT * FROM sqlite_master WHERE 1"
+	stmt, err := s.AddSQLContext(context.Background(), "sql1", sql)
+	a.NotError(err).
+		NotNil(stmt).
+		Equal(1, len(s.items))
+
+	// 已经取消的ctx，不会添加任何内容
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	stmt, err = s.AddSQLContext(ctx, "sql2", sql)
+	a.Error(err).
+		Nil(stmt).
+		Equal(1, len(s.items))
+
+	stmt, err = s.SetSQLContext(ctx, "sql1", sql)
+	a.Error(err).
+		Nil(stmt).
+		Equal(1, len(s.items))
+
+	s.Close()
+}
+
 // fakeDB
 type fakeDB struct {
 	db *sql.DB
@@ -173,10 +206,18 @@ func (f *fakeDB) Prepare(str string) (*sql.Stmt, error) {
 	return f.db.Prepare(str)
 }
 
+func (f *fakeDB) PrepareContext(ctx context.Context, str string) (*sql.Stmt, error) {
+	return f.db.PrepareContext(ctx, str)
+}
+
 func (f *fakeDB) GetStmts() *Stmts {
 	return nil
 }
 
+func (f *fakeDB) GetModels() *Models {
+	return nil
+}
+
 func (f *fakeDB) PrepareSQL(sql string) string {
 	return ""
 }
@@ -196,3 +237,15 @@ func (f *fakeDB) Query(sql string, args ...interface{}) (*sql.Rows, error) {
 func (f *fakeDB) QueryRow(sql string, args ...interface{}) *sql.Row {
 	return nil
 }
+
+func (f *fakeDB) ExecContext(ctx context.Context, sql string, args ...interface{}) (sql.Result, error) {
+	return nil, nil
+}
+
+func (f *fakeDB) QueryContext(ctx context.Context, sql string, args ...interface{}) (*sql.Rows, error) {
+	return nil, nil
+}
+
+func (f *fakeDB) QueryRowContext(ctx context.Context, sql string, args ...interface{}) *sql.Row {
+	return nil
+}
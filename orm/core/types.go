@@ -5,9 +5,17 @@
 package core
 
 import (
+	"context"
 	"database/sql"
 )
 
+// 保存点的操作类型，供Dialect.SavepointSQL()使用。
+const (
+	SavepointBegin    = iota // 创建保存点
+	SavepointRelease         // 释放保存点
+	SavepointRollback        // 回滚到保存点
+)
+
 // 通用但又没有统一标准的数据库功能接口。
 //
 // 有可能一个Dialect实例会被多个其它实例引用，
@@ -19,6 +27,18 @@ type Dialect interface {
 	// 是否支持返回LastInsertId()特性
 	SupportLastInsertId() bool
 
+	// 单条SQL语句中允许使用的占位符的最大数量
+	MaxPlaceholders() int
+
+	// 单条INSERT语句的VALUES中允许插入的最大行数，小于等于0表示不限制；
+	// 为1表示不支持多行VALUES，批量插入时只能逐行插入。
+	MaxInsertRows() int
+
+	// 将语句中的?占位符替换成数据库驱动所支持的形式，比如oracle的:1和sql server的@p1，
+	// 引号中的?不会被替换。驱动支持?占位符时，原样返回。
+	// 替换之后的语句不再包含?占位符，所以多次调用不会改变结果。
+	ReplacePlaceholders(sql string) string
+
 	// 从dataSourceName变量中获取数据库的名称
 	GetDBName(dataSourceName string) string
 
@@ -27,10 +47,28 @@ type Dialect interface {
 	// 返回的是对应数据库的limit语句以及语句中占位符对应的值
 	LimitSQL(limit int, offset ...int) (sql string, args []interface{})
 
+	// 生成INSERT语句中处理冲突的子句，附加在INSERT语句之后。
+	// conflictCols为判断冲突的列，一般为主键或是唯一索引；
+	// updateCols为发生冲突时需要更新的列，为空表示冲突时不做任何操作。
+	// 数据库不支持该操作时，返回空字符串。
+	OnConflictSQL(conflictCols, updateCols []string) string
+
+	// 生成保存点相关的语句，action的值可以是SavepointBegin，
+	// SavepointRelease或是SavepointRollback。
+	// 数据库不支持该操作时，返回空字符串，比如部分数据库没有释放保存点的语句。
+	SavepointSQL(action int, name string) string
+
+	// 数据库中是否存在名为table的表，table为已经替换了表名前缀的表名。
+	HasTable(db DB, table string) (bool, error)
+
 	// 根据一个Model创建或是更新表。
 	// 表的创建虽然语法上大致上相同，但细节部分却又不一样，
 	// 干脆整个过程完全交给Dialect去完成。
 	CreateTable(db DB, m *Model) error
+
+	// 与CreateTable()相同，但只返回需要执行的DDL语句，而不实际执行。
+	// 会根据数据库中表的当前状态，返回创建或是更新表的语句。
+	CreateTableSQL(db DB, m *Model) ([]string, error)
 }
 
 // 操作数据库的接口，用于统一普通数据库操作和事务操作。
@@ -41,10 +79,14 @@ type DB interface {
 	// 获取Stmts实例
 	GetStmts() *Stmts
 
+	// 获取Model的缓存容器
+	GetModels() *Models
+
 	// 预处理SQL语句，包括：
 	// 替换sql语句中的{}符号为Dialect.QuoteStr中的值；
 	// 替换sql语句中表名前缀占位符为真实的表名前缀。
 	// 若这些都不存在，则直接返回原字符串。
+	// ?占位符由Dialect.ReplacePlaceholders()在执行语句时替换，不在此处理。
 	PrepareSQL(sql string) string
 
 	// 返回Dialect接口
@@ -61,4 +103,16 @@ type DB interface {
 
 	// 相当于sql.DB.Prepare()
 	Prepare(sql string) (*sql.Stmt, error)
+
+	// 相当于sql.DB.ExecContext()
+	ExecContext(ctx context.Context, sql string, args ...interface{}) (sql.Result, error)
+
+	// 相当于sql.DB.QueryContext()
+	QueryContext(ctx context.Context, sql string, args ...interface{}) (*sql.Rows, error)
+
+	// 相当于sql.DB.QueryRowContext()
+	QueryRowContext(ctx context.Context, sql string, args ...interface{}) *sql.Row
+
+	// 相当于sql.DB.PrepareContext()
+	PrepareContext(ctx context.Context, sql string) (*sql.Stmt, error)
 }
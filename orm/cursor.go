@@ -0,0 +1,120 @@
+// Copyright 2014 by caixw, All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package orm
+
+import (
+	"context"
+	"database/sql"
+	"reflect"
+
+	"github.com/caixw/lib.go/orm/core"
+	"github.com/caixw/lib.go/orm/fetch"
+)
+
+// 逐行读取查询结果的游标，由SQL.Cursor()返回。
+// 每次只会解析一条记录，适合处理大量的数据。
+//  cur, err := e.SQL().Table("#user").Columns("*").Cursor()
+//  defer cur.Close()
+//  for cur.Next() {
+//      u := &User{}
+//      if err := cur.Scan(u); err != nil {
+//          return err
+//      }
+//  }
+//  return cur.Err()
+type Cursor struct {
+	db   core.DB
+	rows *sql.Rows
+	cols []string // rows.Columns()的返回值
+}
+
+// 执行当前select语句，并返回读取结果的游标。
+func (s *SQL) Cursor(args ...interface{}) (*Cursor, error) {
+	return s.CursorContext(context.Background(), args...)
+}
+
+// 功能同Cursor()，但可以通过ctx取消查询。
+func (s *SQL) CursorContext(ctx context.Context, args ...interface{}) (*Cursor, error) {
+	rows, err := s.QueryContext(ctx, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	cols, err := rows.Columns()
+	if err != nil {
+		rows.Close()
+		return nil, err
+	}
+
+	return &Cursor{db: s.db, rows: rows, cols: cols}, nil
+}
+
+// 将游标移到下一条记录，没有更多的记录或是发生错误时返回false，
+// 具体的错误信息可以通过Err()获取。
+func (c *Cursor) Next() bool {
+	return c.rows.Next()
+}
+
+// 将当前记录导出到v中，v只能为struct指针。
+// 字段的对应关系与orm/fetch.Obj()相同，若v实现了AfterFetcher接口，也会被调用。
+func (c *Cursor) Scan(v interface{}) error {
+	if err := fetch.RowColumns(v, c.cols, c.rows); err != nil {
+		return err
+	}
+
+	if h, ok := v.(AfterFetcher); ok {
+		return h.AfterFetch(c.db)
+	}
+	return nil
+}
+
+// 返回遍历过程中发生的错误
+func (c *Cursor) Err() error {
+	return c.rows.Err()
+}
+
+// 关闭游标
+func (c *Cursor) Close() error {
+	return c.rows.Close()
+}
+
+// 逐条遍历当前select语句查询到的记录。
+//
+// v为struct指针，每次读取记录之前会被重置为零值，再导出当前记录，
+// 之后调用fn。fn返回错误时，会中止遍历并返回该错误。
+//  u := &User{}
+//  err := e.SQL().Table("#user").Columns("*").Iterate(u, func() error {
+//      return w.Write(u)
+//  })
+func (s *SQL) Iterate(v interface{}, fn func() error, args ...interface{}) error {
+	return s.IterateContext(context.Background(), v, fn, args...)
+}
+
+// 功能同Iterate()，但可以通过ctx取消查询。
+func (s *SQL) IterateContext(ctx context.Context, v interface{}, fn func() error, args ...interface{}) error {
+	if err := s.bindModel(v); err != nil {
+		return err
+	}
+
+	cur, err := s.CursorContext(ctx, args...)
+	if err != nil {
+		return err
+	}
+	defer cur.Close()
+
+	elem := reflect.ValueOf(v).Elem()
+	zero := reflect.Zero(elem.Type())
+	for cur.Next() {
+		elem.Set(zero)
+		if err = cur.Scan(v); err != nil {
+			return err
+		}
+		if err = fn(); err != nil {
+			return err
+		}
+	}
+
+	return cur.Err()
+}
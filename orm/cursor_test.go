@@ -0,0 +1,76 @@
+// Copyright 2014 by caixw, All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package orm
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/caixw/lib.go/assert"
+)
+
+func TestCursor(t *testing.T) {
+	a := assert.New(t)
+	e := newUtilDB(a, "cursor")
+	defer closeUtilDB(a, "cursor")
+
+	users := make([]*utilUser, 0, 10)
+	for i := 1; i <= 10; i++ {
+		users = append(users, &utilUser{ID: int64(i), Name: fmt.Sprintf("u%d", i)})
+	}
+	_, err := e.InsertBatch(users, 0)
+	a.NotError(err)
+
+	cur, err := e.SQL().Table("#user").Columns("*").Asc("{id}").Cursor()
+	a.NotError(err).NotNil(cur)
+
+	var ids []int64
+	for cur.Next() {
+		u := &utilUser{}
+		a.NotError(cur.Scan(u))
+		ids = append(ids, u.ID)
+	}
+	a.NotError(cur.Err()).NotError(cur.Close())
+	a.Equal(ids, []int64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10})
+}
+
+func TestSQLIterate(t *testing.T) {
+	a := assert.New(t)
+	e := newUtilDB(a, "iterate")
+	defer closeUtilDB(a, "iterate")
+
+	_, err := e.InsertBatch([]*hookUser{{ID: 1, Name: "u1"}, {ID: 2, Name: "u2"}, {ID: 3, Name: "u3"}}, 0)
+	a.NotError(err)
+
+	// AfterFetch()会被调用
+	u := &hookUser{}
+	var names []string
+	err = e.SQL().Table("#user").Columns("*").Asc("{id}").Iterate(u, func() error {
+		names = append(names, u.Display)
+		return nil
+	})
+	a.NotError(err).Equal(names, []string{"user:u1", "user:u2", "user:u3"})
+
+	// fn返回错误，中止遍历
+	names = names[:0]
+	err = e.SQL().Table("#user").Columns("*").Asc("{id}").Iterate(u, func() error {
+		names = append(names, u.Name)
+		if len(names) == 2 {
+			return errors.New("stop")
+		}
+		return nil
+	})
+	a.Error(err).Equal(names, []string{"u1", "u2"})
+
+	// 无法解析为Model的类型，Iterate()和Fetch()都返回错误
+	invalid := &struct {
+		ID   int64  `orm:"name(id)"`
+		Name string `orm:"name(name);softdelete"`
+	}{}
+	err = e.SQL().Table("#user").Columns("*").Iterate(invalid, func() error { return nil })
+	a.Error(err)
+	a.Error(e.SQL().Table("#user").Columns("*").Fetch(invalid))
+}
@@ -6,6 +6,7 @@ package dialect
 
 import (
 	"bytes"
+	"strings"
 
 	"github.com/caixw/lib.go/orm/core"
 )
@@ -25,7 +26,7 @@ func createColSQL(b base, buf *bytes.Buffer, col *core.Column) error {
 	buf.WriteByte(' ')
 
 	// 写入字段类型
-	if err := b.sqlType(buf, col); err != nil {
+	if err := writeSQLType(b, buf, col); err != nil {
 		return err
 	}
 
@@ -34,9 +35,8 @@ func createColSQL(b base, buf *bytes.Buffer, col *core.Column) error {
 	}
 
 	if col.HasDefault {
-		buf.WriteString(" DEFAULT '")
-		buf.WriteString(col.Default)
-		buf.WriteByte('\'')
+		buf.WriteString(" DEFAULT ")
+		buf.WriteString(quoteLiteral(col.Default))
 	}
 
 	return nil
@@ -74,18 +74,22 @@ func createUniqueSQL(b base, buf *bytes.Buffer, cols []*core.Column, indexName s
 
 // create table语句中fk的约束部分的语句
 func createFKSQL(b base, buf *bytes.Buffer, fk *core.ForeignKey, fkName string) {
-	//CONSTRAINT fk_name FOREIGN KEY (id) REFERENCES user(id)
+	//CONSTRAINT fk_name FOREIGN KEY (id,type) REFERENCES user(id,type)
 	buf.WriteString(" CONSTRAINT ")
 	buf.WriteString(fkName)
 
 	buf.WriteString(" FOREIGN KEY(")
-	buf.WriteString(fk.Col.Name)
+	for _, col := range fk.Cols {
+		buf.WriteString(col.Name)
+		buf.WriteByte(',')
+	}
+	buf.Truncate(buf.Len() - 1) // 去掉最后一个逗号
 
 	buf.WriteString(") REFERENCES ")
 	buf.WriteString(fk.RefTableName)
 
 	buf.WriteByte('(')
-	buf.WriteString(fk.RefColName)
+	buf.WriteString(strings.Join(fk.RefColNames, ","))
 	buf.WriteByte(')')
 
 	if len(fk.UpdateRule) > 0 {
@@ -111,74 +115,90 @@ func createCheckSQL(b base, buf *bytes.Buffer, expr, chkName string) {
 
 // 添加标准的索引约束：pk,unique,foreign key,check
 // 一些非标准的索引需要各个Dialect自己去实现：如mysql的KEY索引
-func addIndexes(b base, db core.DB, model *core.Model) error {
+// pk为主键约束的名称。
+func addIndexesSQL(model *core.Model, pk string) []string {
+	sqls := make([]string, 0, 1+len(model.UniqueIndexes)+len(model.FK)+len(model.Check))
+
 	// ALTER TABLE语句的公共语句部分，可以重复利用：
-	// ALTER TABLE table_name ADD CONSTRAINT
+	// ALTER TABLE table_name ADD
 	buf := bytes.NewBufferString("ALTER TABLE ")
 	buf.WriteString(model.Name)
-	buf.WriteString(" ADD CONSTRAINT ")
+	buf.WriteString(" ADD")
 	size := buf.Len()
 
-	// ALTER TABLE tbname ADD CONSTRAINT pk PRIMARY KEY
-	buf.WriteString("pk PRIMARY KEY(")
-	for _, col := range model.PK {
-		buf.WriteString(col.Name)
-		buf.WriteByte(',')
-	}
-	buf.UnreadByte()
-	buf.WriteByte(')')
-	if _, err := db.Exec(buf.String()); err != nil {
-		return err
+	// ALTER TABLE tbname ADD CONSTRAINT pk PRIMARY KEY(...)
+	if len(model.PK) > 0 {
+		createPKSQL(nil, buf, model.PK, pk)
+		sqls = append(sqls, buf.String())
 	}
 
 	// ALTER TABLE tbname ADD CONSTRAINT uniquteName unique(...)
 	for name, cols := range model.UniqueIndexes {
 		buf.Truncate(size)
-		buf.WriteString(name)
-		buf.WriteString(" UNIQUE(")
-		for _, col := range cols {
-			buf.WriteString(col.Name)
-			buf.WriteByte(',')
-		}
-		buf.UnreadByte()
-		buf.WriteByte(')')
-
-		if _, err := db.Exec(buf.String()); err != nil {
-			return err
-		}
+		createUniqueSQL(nil, buf, cols, name)
+		sqls = append(sqls, buf.String())
 	}
 
 	// fk ALTER TABLE tbname ADD CONSTRAINT fkname FOREIGN KEY (col) REFERENCES tbl(tblcol)
 	for name, fk := range model.FK {
 		buf.Truncate(size)
-		buf.WriteString(name)
-		buf.WriteString(" FOREIGN KEY(")
-		buf.WriteString(fk.Col.Name)
-		buf.WriteByte(')')
-
-		buf.WriteString(" REFERENCES ")
-		buf.WriteString(fk.RefTableName)
-		buf.WriteByte('(')
-		buf.WriteString(fk.RefColName)
-		buf.WriteByte(')')
-
-		if _, err := db.Exec(buf.String()); err != nil {
-			return err
-		}
+		createFKSQL(nil, buf, fk, name)
+		sqls = append(sqls, buf.String())
 	}
 
 	// chk ALTER TABLE tblname ADD CONSTRAINT chkName CHECK (id>0 AND city='abc')
 	for name, expr := range model.Check {
 		buf.Truncate(size)
-		buf.WriteString(name) // checkName
-		buf.WriteString(" CHECK(")
-		buf.WriteString(expr)
+		createCheckSQL(nil, buf, expr, name)
+		sqls = append(sqls, buf.String())
+	}
+
+	return sqls
+}
+
+// 产生创建KEY索引的语句：
+//  CREATE INDEX index_name ON table_name(col1,col2)
+// 供不支持在create table语句中定义KEY索引的数据库使用。
+func createIndexesSQL(model *core.Model) []string {
+	sqls := make([]string, 0, len(model.KeyIndexes))
+	buf := bytes.NewBufferString("")
+
+	for name, index := range model.KeyIndexes {
+		buf.Reset()
+		buf.WriteString("CREATE INDEX ")
+		buf.WriteString(name)
+		buf.WriteString(" ON ")
+		buf.WriteString(model.Name)
+		buf.WriteByte('(')
+		for _, col := range index {
+			buf.WriteString(col.Name)
+			buf.WriteByte(',')
+		}
+		buf.Truncate(buf.Len() - 1) // 去掉最后的逗号
 		buf.WriteByte(')')
 
-		if _, err := db.Exec(buf.String()); err != nil {
+		sqls = append(sqls, buf.String())
+	}
+
+	return sqls
+}
+
+// 依次执行sqls中的语句。
+func execSQLs(db core.DB, sqls []string) error {
+	for _, sql := range sqls {
+		if _, err := db.Exec(sql); err != nil {
 			return err
 		}
 	}
 
 	return nil
 }
+
+// 对sqls中的每一条语句调用db.PrepareSQL()。
+func prepareSQLs(db core.DB, sqls []string) []string {
+	for i, sql := range sqls {
+		sqls[i] = db.PrepareSQL(sql)
+	}
+
+	return sqls
+}
@@ -37,6 +37,13 @@ func TestCreatColSQL(t *testing.T) {
 	wont = "id SMALLINT NOT NULL DEFAULT '1'"
 	a.StringEqual(buf.String(), wont, style)
 
+	// 默认值中的单引号需要转义
+	buf.Reset()
+	col.Default = "it's"
+	createColSQL(dialect, buf, col)
+	wont = "id SMALLINT NOT NULL DEFAULT 'it''s'"
+	a.StringEqual(buf.String(), wont, style)
+
 	buf.Reset()
 	col.HasDefault = false
 	col.Nullable = true
@@ -85,15 +92,28 @@ func TestCreateFKSQL(t *testing.T) {
 	dialect := &Mysql{}
 	buf := bytes.NewBufferString("")
 	fk := &core.ForeignKey{
-		Col:          &core.Column{Name: "id"},
+		Cols:         []*core.Column{&core.Column{Name: "id"}},
 		RefTableName: "refTable",
-		RefColName:   "refCol",
+		RefColNames:  []string{"refCol"},
 		UpdateRule:   "NO ACTION",
 	}
 
 	createFKSQL(dialect, buf, fk, "fkname")
 	wont := "CONSTRAINT fkname FOREIGN KEY(id) REFERENCES refTable(refCol) ON UPDATE NO ACTION"
 	a.StringEqual(buf.String(), wont, style)
+
+	// 复合外键
+	buf.Reset()
+	fk = &core.ForeignKey{
+		Cols:         []*core.Column{&core.Column{Name: "uid"}, &core.Column{Name: "type"}},
+		RefTableName: "refTable",
+		RefColNames:  []string{"id", "type"},
+		UpdateRule:   "CASCADE",
+		DeleteRule:   "SET NULL",
+	}
+	createFKSQL(dialect, buf, fk, "fkname")
+	wont = "CONSTRAINT fkname FOREIGN KEY(uid,type) REFERENCES refTable(id,type) ON UPDATE CASCADE ON DELETE SET NULL"
+	a.StringEqual(buf.String(), wont, style)
 }
 
 func TestCreateCheckSQL(t *testing.T) {
@@ -106,6 +126,29 @@ func TestCreateCheckSQL(t *testing.T) {
 	a.StringEqual(wont, buf.String(), style)
 }
 
-func TestAddIndexes(t *testing.T) {
-	// TODO
+func TestAddIndexesSQL(t *testing.T) {
+	a := assert.New(t)
+	id := &core.Column{Name: "id"}
+	group := &core.Column{Name: "group"}
+	model := &core.Model{
+		Name:          "user",
+		PK:            []*core.Column{id},
+		UniqueIndexes: map[string][]*core.Column{"u_id": []*core.Column{id, group}},
+		FK: map[string]*core.ForeignKey{
+			"fk_group": &core.ForeignKey{Cols: []*core.Column{group}, RefTableName: "group", RefColNames: []string{"id"}},
+		},
+		Check: map[string]string{"chk_id": "id>0"},
+	}
+
+	sqls := addIndexesSQL(model, pkName)
+	a.Equal(4, len(sqls))
+	a.StringEqual(sqls[0], "ALTER TABLE user ADD CONSTRAINT pk PRIMARY KEY(id)", style).
+		StringEqual(sqls[1], "ALTER TABLE user ADD CONSTRAINT u_id UNIQUE(id,group)", style).
+		StringEqual(sqls[2], "ALTER TABLE user ADD CONSTRAINT fk_group FOREIGN KEY(group) REFERENCES group(id)", style).
+		StringEqual(sqls[3], "ALTER TABLE user ADD CONSTRAINT chk_id CHECK(id>0)", style)
+
+	// 没有主键
+	model.PK = nil
+	sqls = addIndexesSQL(model, pkName)
+	a.Equal(3, len(sqls))
 }
@@ -10,13 +10,91 @@
 package dialect
 
 import (
+	"context"
+	"database/sql"
+	"os"
+	"strings"
 	"testing"
 
 	"github.com/caixw/lib.go/assert"
+	"github.com/caixw/lib.go/orm/core"
 	_ "github.com/go-sql-driver/mysql"
 	_ "github.com/mattn/go-sqlite3"
 )
 
+const testDBFile = "./test.db"
+
+// fakeDB，通过sqlite3实现core.DB接口。
+type fakeDB struct {
+	db *sql.DB
+	d  core.Dialect
+}
+
+func newFakeDB(a *assert.Assertion) *fakeDB {
+	db, err := sql.Open("sqlite3", testDBFile)
+	a.NotError(err).NotNil(db)
+
+	return &fakeDB{db: db, d: &Sqlite3{}}
+}
+
+func (f *fakeDB) close(a *assert.Assertion) {
+	a.NotError(f.db.Close()).
+		NotError(os.Remove(testDBFile))
+}
+
+func (f *fakeDB) Name() string {
+	return "test"
+}
+
+func (f *fakeDB) GetStmts() *core.Stmts {
+	return nil
+}
+
+func (f *fakeDB) GetModels() *core.Models {
+	return nil
+}
+
+func (f *fakeDB) PrepareSQL(sql string) string {
+	l, r := f.d.QuoteStr()
+	return strings.NewReplacer("{", l, "}", r, "#", "prefix_").Replace(sql)
+}
+
+func (f *fakeDB) Dialect() core.Dialect {
+	return f.d
+}
+
+func (f *fakeDB) Exec(sql string, args ...interface{}) (sql.Result, error) {
+	return f.db.Exec(sql, args...)
+}
+
+func (f *fakeDB) Query(sql string, args ...interface{}) (*sql.Rows, error) {
+	return f.db.Query(sql, args...)
+}
+
+func (f *fakeDB) QueryRow(sql string, args ...interface{}) *sql.Row {
+	return f.db.QueryRow(sql, args...)
+}
+
+func (f *fakeDB) Prepare(sql string) (*sql.Stmt, error) {
+	return f.db.Prepare(sql)
+}
+
+func (f *fakeDB) ExecContext(ctx context.Context, sql string, args ...interface{}) (sql.Result, error) {
+	return f.db.ExecContext(ctx, sql, args...)
+}
+
+func (f *fakeDB) QueryContext(ctx context.Context, sql string, args ...interface{}) (*sql.Rows, error) {
+	return f.db.QueryContext(ctx, sql, args...)
+}
+
+func (f *fakeDB) QueryRowContext(ctx context.Context, sql string, args ...interface{}) *sql.Row {
+	return f.db.QueryRowContext(ctx, sql, args...)
+}
+
+func (f *fakeDB) PrepareContext(ctx context.Context, sql string) (*sql.Stmt, error) {
+	return f.db.PrepareContext(ctx, sql)
+}
+
 func TestIsRegistedDriver(t *testing.T) {
 	a := assert.New(t)
 
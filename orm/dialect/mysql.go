@@ -41,6 +41,49 @@ func (m *Mysql) LimitSQL(limit int, offset ...int) (string, []interface{}) {
 	return mysqlLimitSQL(limit, offset...)
 }
 
+// implement core.Dialect.OnConflictSQL()
+// mysql根据主键和所有的唯一索引判断冲突，会忽略conflictCols参数。
+func (m *Mysql) OnConflictSQL(conflictCols, updateCols []string) string {
+	buf := bytes.NewBufferString(" ON DUPLICATE KEY UPDATE ")
+
+	if len(updateCols) == 0 { // 不更新任何数据，将冲突列赋值为自身
+		buf.WriteString(conflictCols[0])
+		buf.WriteByte('=')
+		buf.WriteString(conflictCols[0])
+		return buf.String()
+	}
+
+	for _, col := range updateCols {
+		buf.WriteString(col)
+		buf.WriteString("=VALUES(")
+		buf.WriteString(col)
+		buf.WriteString("),")
+	}
+	buf.Truncate(buf.Len() - 1) // 去掉最后的逗号
+
+	return buf.String()
+}
+
+// implement core.Dialect.SavepointSQL()
+func (m *Mysql) SavepointSQL(action int, name string) string {
+	return savepointSQL(action, name)
+}
+
+// implement core.Dialect.MaxPlaceholders()
+func (m *Mysql) MaxPlaceholders() int {
+	return 65535
+}
+
+// implement core.Dialect.MaxInsertRows()
+func (m *Mysql) MaxInsertRows() int {
+	return 0
+}
+
+// implement core.Dialect.ReplacePlaceholders()
+func (m *Mysql) ReplacePlaceholders(sql string) string {
+	return sql
+}
+
 // implement core.Dialect.SupportLastInsertId()
 func (m *Mysql) SupportLastInsertId() bool {
 	return true
@@ -48,17 +91,46 @@ func (m *Mysql) SupportLastInsertId() bool {
 
 // implement core.Dialect.CreateTable()
 func (m *Mysql) CreateTable(db core.DB, model *core.Model) error {
-	sql := "SELECT `TABLE_NAME` FROM `INFORMATION_SCHEMA`.`TABLES` WHERE `TABLE_SCHEMA`=? and `TABLE_NAME`=?"
-	rows, err := db.Query(sql, db.Name(), db.PrepareSQL(model.Name))
+	sqls, err := m.CreateTableSQL(db, model)
 	if err != nil {
 		return err
 	}
+
+	return execSQLs(db, sqls)
+}
+
+// implement core.Dialect.HasTable()
+func (m *Mysql) HasTable(db core.DB, table string) (bool, error) {
+	sql := "SELECT `TABLE_NAME` FROM `INFORMATION_SCHEMA`.`TABLES` WHERE `TABLE_SCHEMA`=? and `TABLE_NAME`=?"
+	rows, err := db.Query(sql, db.Name(), table)
+	if err != nil {
+		return false, err
+	}
 	defer rows.Close()
 
-	if rows.Next() { // 存在指定的表名
-		return m.upgradeTable(db, model)
+	return rows.Next(), nil
+}
+
+// implement core.Dialect.CreateTableSQL()
+func (m *Mysql) CreateTableSQL(db core.DB, model *core.Model) ([]string, error) {
+	has, err := m.HasTable(db, db.PrepareSQL(model.Name))
+	if err != nil {
+		return nil, err
+	}
+
+	if has {
+		sqls, err := m.upgradeTableSQL(db, model)
+		if err != nil {
+			return nil, err
+		}
+		return prepareSQLs(db, sqls), nil
+	}
+
+	sql, err := m.createTableSQL(model)
+	if err != nil {
+		return nil, err
 	}
-	return m.createTable(db, model)
+	return []string{db.PrepareSQL(sql)}, nil
 }
 
 // implement base.sqlType()
@@ -71,6 +143,11 @@ func (m *Mysql) sqlType(buf *bytes.Buffer, col *core.Column) error {
 		return errors.New("无效的col.GoType值")
 	}
 
+	if col.JSON {
+		buf.WriteString("JSON")
+		return nil
+	}
+
 	addIntLen := func() {
 		if col.Len1 > 0 {
 			buf.WriteByte('(')
@@ -113,20 +190,22 @@ func (m *Mysql) sqlType(buf *bytes.Buffer, col *core.Column) error {
 	case reflect.Float32, reflect.Float64:
 		buf.WriteString(fmt.Sprintf("DOUBLE(%d,%d)", col.Len1, col.Len2))
 	case reflect.String:
-		if col.Len1 < 65533 {
+		if col.Len1 > 0 && col.Len1 < 65533 {
 			buf.WriteString(fmt.Sprintf("VARCHAR(%d)", col.Len1))
+		} else {
+			buf.WriteString("LONGTEXT")
 		}
-		buf.WriteString("LONGTEXT")
 	case reflect.Slice, reflect.Array: // []rune,[]byte当作字符串处理
 		k := col.GoType.Elem().Kind()
-		if (k != reflect.Int8) && (k != reflect.Int32) {
+		if (k != reflect.Uint8) && (k != reflect.Int32) {
 			return errors.New("不支持数组类型")
 		}
 
-		if col.Len1 < 65533 {
+		if col.Len1 > 0 && col.Len1 < 65533 {
 			buf.WriteString(fmt.Sprintf("VARCHAR(%d)", col.Len1))
+		} else {
+			buf.WriteString("LONGTEXT")
 		}
-		buf.WriteString("LONGTEXT")
 	case reflect.Struct:
 		switch col.GoType {
 		case nullBool:
@@ -137,12 +216,15 @@ func (m *Mysql) sqlType(buf *bytes.Buffer, col *core.Column) error {
 			buf.WriteString("BIGINT")
 			addIntLen()
 		case nullString:
-			if col.Len1 < 65533 {
+			if col.Len1 > 0 && col.Len1 < 65533 {
 				buf.WriteString(fmt.Sprintf("VARCHAR(%d)", col.Len1))
+			} else {
+				buf.WriteString("LONGTEXT")
 			}
-			buf.WriteString("LONGTEXT")
 		case timeType:
 			buf.WriteString("DATETIME")
+		default:
+			return fmt.Errorf("不支持的类型:[%v]，可以通过type()指定其数据库类型", col.GoType)
 		}
 	default:
 		return fmt.Errorf("不支持的类型:[%v]", col.GoType.Name())
@@ -151,8 +233,8 @@ func (m *Mysql) sqlType(buf *bytes.Buffer, col *core.Column) error {
 	return nil
 }
 
-// 创建表
-func (m *Mysql) createTable(db core.DB, model *core.Model) error {
+// 产生创建表的语句
+func (m *Mysql) createTableSQL(model *core.Model) (string, error) {
 	buf := bytes.NewBufferString("CREATE TABLE IF NOT EXISTS ")
 	buf.Grow(300)
 
@@ -162,11 +244,11 @@ func (m *Mysql) createTable(db core.DB, model *core.Model) error {
 	// 写入字段信息
 	for _, col := range model.Cols {
 		if err := createColSQL(m, buf, col); err != nil {
-			return err
+			return "", err
 		}
 
 		if col.IsAI() {
-			buf.WriteString(" AUTO_INCRMENT")
+			buf.WriteString(" AUTO_INCREMENT")
 		}
 		buf.WriteByte(',')
 	}
@@ -196,18 +278,16 @@ func (m *Mysql) createTable(db core.DB, model *core.Model) error {
 	}
 
 	// key index不存在CONSTRAINT形式的语句
-	if len(model.KeyIndexes) == 0 {
-		for name, index := range model.KeyIndexes {
-			buf.WriteString("INDEX ")
-			buf.WriteString(name)
-			buf.WriteByte('(')
-			for _, col := range index {
-				buf.WriteString(col.Name)
-				buf.WriteByte(',')
-			}
-			buf.Truncate(buf.Len() - 1) // 去掉最后的逗号
-			buf.WriteString("),")
+	for name, index := range model.KeyIndexes {
+		buf.WriteString("INDEX ")
+		buf.WriteString(name)
+		buf.WriteByte('(')
+		for _, col := range index {
+			buf.WriteString(col.Name)
+			buf.WriteByte(',')
 		}
+		buf.Truncate(buf.Len() - 1) // 去掉最后的逗号
+		buf.WriteString("),")
 	}
 
 	buf.Truncate(buf.Len() - 1) // 去掉最后的逗号
@@ -219,23 +299,23 @@ func (m *Mysql) createTable(db core.DB, model *core.Model) error {
 		buf.WriteString(strconv.Itoa(model.AI.Start))
 	}
 
-	_, err := db.Exec(buf.String())
-	return err
+	return buf.String(), nil
 }
 
-// 更新表
-func (m *Mysql) upgradeTable(db core.DB, model *core.Model) error {
-	if err := m.upgradeCols(db, model); err != nil {
-		return err
+// 产生更新表的语句
+func (m *Mysql) upgradeTableSQL(db core.DB, model *core.Model) ([]string, error) {
+	sqls, err := m.upgradeColsSQL(db, model)
+	if err != nil {
+		return nil, err
 	}
 
-	if err := m.deleteIndexes(db, model); err != nil {
-		return err
+	dropSQLs, err := m.deleteIndexesSQL(db, model)
+	if err != nil {
+		return nil, err
 	}
+	sqls = append(sqls, dropSQLs...)
 
-	if err := addIndexes(m, db, model); err != nil {
-		return err
-	}
+	sqls = append(sqls, addIndexesSQL(model, pkName)...)
 
 	// key
 	buf := bytes.NewBufferString("ALTER TABLE ")
@@ -254,33 +334,34 @@ func (m *Mysql) upgradeTable(db core.DB, model *core.Model) error {
 		buf.Truncate(buf.Len() - 1)
 		buf.WriteByte(')')
 
-		if _, err := db.Exec(buf.String()); err != nil {
-			return err
-		}
+		sqls = append(sqls, buf.String())
 	}
 
 	if model.AI == nil {
-		return nil
+		return sqls, nil
 	}
 
 	// ALTER TABLE document MODIFY COLUMN document_id INT auto_increment
 	buf.Truncate(size)
 	buf.WriteString(" MODIFY COLUMN ")
-	createColSQL(m, buf, model.AI.Col)
-	buf.WriteString(" PRIMARY KEY AUTO_INCREMENT")
-	_, err := db.Exec(buf.String())
-	return err
+	if err := createColSQL(m, buf, model.AI.Col); err != nil {
+		return nil, err
+	}
+	buf.WriteString(" AUTO_INCREMENT")
+
+	return append(sqls, buf.String()), nil
 }
 
-// 更新表的列信息。
+// 产生更新表的列信息的语句。
 // 将model中的列与表中的列做对比：存在的修改；不存在的添加；只存在于
 // 表中的列则直接删除。
-func (m *Mysql) upgradeCols(db core.DB, model *core.Model) error {
+func (m *Mysql) upgradeColsSQL(db core.DB, model *core.Model) ([]string, error) {
 	dbColsMap, err := m.getCols(db, model)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
+	sqls := make([]string, 0, len(model.Cols))
 	buf := bytes.NewBufferString("ALTER TABLE ")
 	buf.WriteString(model.Name)
 	size := buf.Len()
@@ -297,15 +378,11 @@ func (m *Mysql) upgradeCols(db core.DB, model *core.Model) error {
 			delete(dbColsMap, colName)
 		}
 
-		createColSQL(m, buf, col)
-
-		if _, err := db.Exec(buf.String()); err != nil {
-			return err
+		if err := createColSQL(m, buf, col); err != nil {
+			return nil, err
 		}
-	}
 
-	if len(dbColsMap) == 0 {
-		return nil
+		sqls = append(sqls, buf.String())
 	}
 
 	// 删除已经不存在于model中的字段。
@@ -315,18 +392,16 @@ func (m *Mysql) upgradeCols(db core.DB, model *core.Model) error {
 	for name, _ := range dbColsMap {
 		buf.Truncate(size)
 		buf.WriteString(name)
-		if _, err := db.Exec(buf.String()); err != nil {
-			return err
-		}
+		sqls = append(sqls, buf.String())
 	}
 
-	return nil
+	return sqls, nil
 }
 
 // 获取表的列信息
 func (m *Mysql) getCols(db core.DB, model *core.Model) (map[string]interface{}, error) {
 	sql := "SELECT `COLUMN_NAME` FROM `INFORMATION_SCHEMA`.`COLUMNS` WHERE `TABLE_SCHEMA` = ? AND `TABLE_NAME` = ?"
-	rows, err := db.Query(sql, db.Name(), model.Name)
+	rows, err := db.Query(sql, db.Name(), db.PrepareSQL(model.Name))
 	if err != nil {
 		return nil, err
 	}
@@ -334,7 +409,7 @@ func (m *Mysql) getCols(db core.DB, model *core.Model) (map[string]interface{},
 
 	dbCols, err := fetch.ColumnString(false, "COLUMN_NAME", rows)
 	if err != nil {
-		return nil, nil
+		return nil, err
 	}
 
 	// 转换成map，仅用到键名，键值一律置空
@@ -346,55 +421,58 @@ func (m *Mysql) getCols(db core.DB, model *core.Model) (map[string]interface{},
 	return dbColsMap, nil
 }
 
-// 删除表中的索引
-func (m *Mysql) deleteIndexes(db core.DB, model *core.Model) error {
+// 产生删除表中的索引的语句
+func (m *Mysql) deleteIndexesSQL(db core.DB, model *core.Model) ([]string, error) {
+	tableName := db.PrepareSQL(model.Name)
+
 	// 删除有中的标准约束：pk,fk,unique
 	sql := "SELECT CONSTRAINT_NAME, CONSTRAINT_TYPE FROM INFORMATION_SCHEMA.TABLE_CONSTRAINTS WHERE TABLE_SCHEMA=? AND TABLE_NAME=?"
-	rows, err := db.Query(sql, db.Name(), model.Name)
+	rows, err := db.Query(sql, db.Name(), tableName)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	mapped, err := fetch.MapString(false, rows)
+	rows.Close()
 	if err != nil {
-		return err
+		return nil, err
 	}
 
+	sqls := make([]string, 0, len(mapped))
+	dropped := map[string]bool{} // 已经删除的索引，unique约束同时也会出现在STATISTICS中
 	for _, record := range mapped {
+		name := record["CONSTRAINT_NAME"]
 		switch record["CONSTRAINT_TYPE"] {
 		case "PRIMARY KEY":
-			_, err = db.Exec("ALTER TABLE ? DROP PRIMARY KEY", model.Name)
+			sqls = append(sqls, "ALTER TABLE "+model.Name+" DROP PRIMARY KEY")
 		case "FOREIGN KEY":
-			_, err = db.Exec("ALTER TABLE ? DROP FOREIGN KEY ?", model.Name, record["CONSTRAINT_NAME"])
+			sqls = append(sqls, "ALTER TABLE "+model.Name+" DROP FOREIGN KEY "+name)
 		case "UNIQUE":
-			_, err = db.Exec("ALTER TABLE ? DROP INDEX ?", model.Name, record["CONSTRAINT_NAME"])
+			sqls = append(sqls, "ALTER TABLE "+model.Name+" DROP INDEX "+name)
 		default:
+			continue
 		}
-
-		if err != nil {
-			return err
-		}
+		dropped[name] = true
 	}
-	rows.Close()
 
 	// 删除表中的非标准索引：key index
-	sql = "SELECT `INDEX_NAME` FROM INFORMATION_SCHEMA.STATISTICS WHERE TABLE_SCHEMA=? AND TABLE_NAME=?"
-	rows, err = db.Query(sql, db.Name(), model.Name)
+	sql = "SELECT DISTINCT `INDEX_NAME` FROM INFORMATION_SCHEMA.STATISTICS WHERE TABLE_SCHEMA=? AND TABLE_NAME=?"
+	rows, err = db.Query(sql, db.Name(), tableName)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	defer rows.Close()
 
 	indexes, err := fetch.ColumnString(false, "INDEX_NAME", rows)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	for _, index := range indexes {
-		_, err := db.Exec("ALTER TABLE ? DROP INDEX ?", model.Name, index)
-		if err != nil {
-			return err
+		if index == "PRIMARY" || dropped[index] {
+			continue
 		}
+		sqls = append(sqls, "ALTER TABLE "+model.Name+" DROP INDEX "+index)
 	}
-	rows.Close()
 
-	return nil
+	return sqls, nil
 }
@@ -27,6 +27,16 @@ func TestMysqlGetDBName(t *testing.T) {
 	a.Equal(m.GetDBName("root:/"), "")
 }
 
+func TestMysqlOnConflictSQL(t *testing.T) {
+	a := assert.New(t)
+
+	sql := m.OnConflictSQL([]string{"{id}"}, []string{"{name}", "{email}"})
+	a.StringEqual(sql, " ON DUPLICATE KEY UPDATE {name}=VALUES({name}),{email}=VALUES({email})", style)
+
+	sql = m.OnConflictSQL([]string{"{id}"}, nil)
+	a.StringEqual(sql, " ON DUPLICATE KEY UPDATE {id}={id}", style)
+}
+
 func TestMysqlSQLType(t *testing.T) {
 	a := assert.New(t)
 	buf := bytes.NewBufferString("")
@@ -34,6 +44,26 @@ func TestMysqlSQLType(t *testing.T) {
 		GoType: reflect.TypeOf(1),
 	}
 
-	m.sqlType(buf, col)
+	a.NotError(m.sqlType(buf, col))
+	a.Equal(buf.String(), "BIGINT")
+
+	buf.Reset()
+	col.GoType = reflect.TypeOf("")
+	a.NotError(m.sqlType(buf, col))
+	a.Equal(buf.String(), "LONGTEXT")
+
+	buf.Reset()
+	col.Len1 = 50
+	a.NotError(m.sqlType(buf, col))
+	a.Equal(buf.String(), "VARCHAR(50)")
+
+	buf.Reset()
+	col.GoType = reflect.TypeOf([]byte{})
+	a.NotError(m.sqlType(buf, col))
+	a.Equal(buf.String(), "VARCHAR(50)")
 
+	// 不支持的struct
+	buf.Reset()
+	col.GoType = reflect.TypeOf(struct{}{})
+	a.Error(m.sqlType(buf, col))
 }
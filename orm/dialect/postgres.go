@@ -10,9 +10,10 @@ import (
 	"fmt"
 	"reflect"
 	"regexp"
+	"sort"
+	"strings"
 
 	"github.com/caixw/lib.go/orm/core"
-	"github.com/caixw/lib.go/orm/fetch"
 )
 
 type Postgres struct{}
@@ -22,6 +23,31 @@ func (p *Postgres) QuoteStr() (l, r string) {
 	return `"`, `"`
 }
 
+// implement core.Dialect.OnConflictSQL()
+func (p *Postgres) OnConflictSQL(conflictCols, updateCols []string) string {
+	return onConflictSQL(conflictCols, updateCols)
+}
+
+// implement core.Dialect.SavepointSQL()
+func (p *Postgres) SavepointSQL(action int, name string) string {
+	return savepointSQL(action, name)
+}
+
+// implement core.Dialect.MaxPlaceholders()
+func (p *Postgres) MaxPlaceholders() int {
+	return 65535
+}
+
+// implement core.Dialect.MaxInsertRows()
+func (p *Postgres) MaxInsertRows() int {
+	return 0
+}
+
+// implement core.Dialect.ReplacePlaceholders()
+func (p *Postgres) ReplacePlaceholders(sql string) string {
+	return sql
+}
+
 // implement core.Dialect.SupportLastInsertId()
 func (p *Postgres) SupportLastInsertId() bool {
 	return true
@@ -56,21 +82,50 @@ func (p *Postgres) LimitSQL(limit int, offset ...int) (sql string, args []interf
 
 // implement core.Dialect.CreateTable()
 func (p *Postgres) CreateTable(db core.DB, model *core.Model) error {
-	sql := "SELECT * FROM pg_tables where schemaname = 'public' and tablename=?"
-	rows, err := db.Query(sql, model.Name)
+	sqls, err := p.CreateTableSQL(db, model)
 	if err != nil {
 		return err
 	}
+
+	return execSQLs(db, sqls)
+}
+
+// implement core.Dialect.HasTable()
+func (p *Postgres) HasTable(db core.DB, table string) (bool, error) {
+	sql := "SELECT * FROM pg_tables where schemaname = 'public' and tablename=?"
+	rows, err := db.Query(sql, table)
+	if err != nil {
+		return false, err
+	}
 	defer rows.Close()
 
-	if rows.Next() { // 表已经存在
-		return p.upgradeTable(db, model)
+	return rows.Next(), nil
+}
+
+// implement core.Dialect.CreateTableSQL()
+func (p *Postgres) CreateTableSQL(db core.DB, model *core.Model) ([]string, error) {
+	has, err := p.HasTable(db, db.PrepareSQL(model.Name))
+	if err != nil {
+		return nil, err
+	}
+
+	if has {
+		sqls, err := p.upgradeTableSQL(db, model)
+		if err != nil {
+			return nil, err
+		}
+		return prepareSQLs(db, sqls), nil
+	}
+
+	sql, err := p.createTableSQL(model)
+	if err != nil {
+		return nil, err
 	}
-	return p.createTable(db, model)
+	return []string{db.PrepareSQL(sql)}, nil
 }
 
-// 创建新表
-func (p *Postgres) createTable(db core.DB, model *core.Model) error {
+// 产生创建新表的语句
+func (p *Postgres) createTableSQL(model *core.Model) (string, error) {
 	buf := bytes.NewBufferString("CREATE TABLE IF NOT EXISTS ")
 	buf.Grow(300)
 
@@ -79,7 +134,9 @@ func (p *Postgres) createTable(db core.DB, model *core.Model) error {
 
 	// 写入字段信息
 	for _, col := range model.Cols {
-		createColSQL(p, buf, col)
+		if err := createColSQL(p, buf, col); err != nil {
+			return "", err
+		}
 		buf.WriteByte(',')
 	}
 
@@ -110,119 +167,323 @@ func (p *Postgres) createTable(db core.DB, model *core.Model) error {
 	buf.Truncate(buf.Len() - 1) // 去掉最后的逗号
 	buf.WriteByte(')')          // end CreateTable
 
-	_, err := db.Exec(buf.String())
-	return err
+	return buf.String(), nil
 }
 
-// 更新表
-func (p *Postgres) upgradeTable(db core.DB, model *core.Model) error {
-	if err := p.upgradeCols(db, model); err != nil {
-		return err
+// 产生更新表的语句。
+//
+// 将model与表中现有的结构做对比，只产生有差异的部分：
+// 先删除已经不存在或是已经改变的约束，再修改列，最后添加新的约束。
+func (p *Postgres) upgradeTableSQL(db core.DB, model *core.Model) ([]string, error) {
+	dbCols, err := p.getCols(db, model)
+	if err != nil {
+		return nil, err
 	}
 
-	if err := p.deleteConstraints(db, model); err != nil {
-		return err
+	dbConts, err := p.getConstraints(db, model)
+	if err != nil {
+		return nil, err
 	}
 
-	return addIndexes(p, db, model)
+	return p.diffTableSQL(db, model, dbCols, dbConts)
+}
+
+// 表中已经存在的列
+type pgCol struct {
+	typ      string // format_type()返回的类型，比如character varying(20)
+	nullable bool
+	def      string // 默认值表达式，比如'abc'::character varying，没有默认值时为空
 }
 
-// 更新表的列信息。
-// 将model中的列与表中的列做对比：存在的修改；不存在的添加；只存在于
-// 表中的列则直接删除。
-func (p *Postgres) upgradeCols(db core.DB, model *core.Model) error {
-	dbColsMap, err := p.getCols(db, model)
+// 根据表中现有的列和约束，产生更新表的语句。
+func (p *Postgres) diffTableSQL(db core.DB, model *core.Model, dbCols map[string]*pgCol, dbConts map[string]string) ([]string, error) {
+	prefix := "ALTER TABLE " + model.Name + " "
+
+	// 需要删除和添加的约束，约束的定义改变时，先删除再添加。
+	conts := p.constraints(db, model)
+	names := make([]string, 0, len(dbConts))
+	for name := range dbConts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	drops := make([]string, 0, len(dbConts))
+	for _, name := range names {
+		if def, found := conts[name]; !found || normalizeConstraint(def) != normalizeConstraint(dbConts[name]) {
+			drops = append(drops, name)
+		}
+	}
+	// 外键需要在被其引用的主键和唯一约束之前删除
+	sort.SliceStable(drops, func(i, j int) bool {
+		return isFKDef(dbConts[drops[i]]) && !isFKDef(dbConts[drops[j]])
+	})
+
+	sqls := make([]string, 0, len(drops)+len(model.Cols))
+	for _, name := range drops {
+		sqls = append(sqls, prefix+"DROP CONSTRAINT "+name)
+	}
+
+	colSQLs, err := p.diffColsSQL(prefix, model, dbCols)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	sqls = append(sqls, colSQLs...)
 
-	buf := bytes.NewBufferString("ALTER TABLE ")
-	buf.WriteString(model.Name)
-	size := buf.Len()
+	for _, stmt := range addIndexesSQL(model, pkName) {
+		name := constraintName(stmt)
+		if def, found := dbConts[name]; found && normalizeConstraint(def) == normalizeConstraint(conts[name]) {
+			continue
+		}
+		sqls = append(sqls, stmt)
+	}
 
-	// 将model中的列信息作用于数据库中的表，
-	// 并将过滤dbCols中的列，只剩下不存在于model中的字段。
-	for colName, col := range model.Cols {
-		buf.Truncate(size)
+	return sqls, nil
+}
 
-		if _, found := dbColsMap[colName]; !found {
-			buf.WriteString(" ADD ")
-		} else {
-			buf.WriteString(" MODIFY COLUMN ")
-			delete(dbColsMap, colName)
+// 对比model与表中的列：不存在的添加；类型、NOT NULL和默认值有变化的修改；
+// 只存在于表中的列则删除。
+func (p *Postgres) diffColsSQL(prefix string, model *core.Model, dbCols map[string]*pgCol) ([]string, error) {
+	names := make([]string, 0, len(model.Cols))
+	for name := range model.Cols {
+		names = append(names, name)
+	}
+	sort.Strings(names) // 固定语句的顺序，方便审查
+
+	sqls := make([]string, 0, len(model.Cols))
+	buf := new(bytes.Buffer)
+
+	for _, name := range names {
+		col := model.Cols[name]
+
+		dbCol, found := dbCols[name]
+		if !found {
+			buf.Reset()
+			buf.WriteString(prefix)
+			buf.WriteString("ADD ")
+			if err := createColSQL(p, buf, col); err != nil {
+				return nil, err
+			}
+			sqls = append(sqls, buf.String())
+			continue
 		}
 
-		createColSQL(p, buf, col)
+		alter := prefix + "ALTER COLUMN " + col.Name + " "
 
-		if _, err := db.Exec(buf.String()); err != nil {
-			return err
+		buf.Reset()
+		if err := writeSQLType(p, buf, col); err != nil {
+			return nil, err
+		}
+		typ := pgAlterType(buf.String())
+		if pgTypeName(typ) != pgTypeName(dbCol.typ) {
+			sqls = append(sqls, alter+"TYPE "+typ)
 		}
-	}
 
-	if len(dbColsMap) == 0 {
-		return nil
+		if col.Nullable != dbCol.nullable {
+			if col.Nullable {
+				sqls = append(sqls, alter+"DROP NOT NULL")
+			} else {
+				sqls = append(sqls, alter+"SET NOT NULL")
+			}
+		}
+
+		if !col.IsAI() { // 自增列的默认值由序列产生，不作修改。
+			def, hasDef := pgDefault(dbCol.def)
+			switch {
+			case col.HasDefault && (!hasDef || def != col.Default):
+				sqls = append(sqls, alter+"SET DEFAULT "+quoteLiteral(col.Default))
+			case !col.HasDefault && hasDef:
+				sqls = append(sqls, alter+"DROP DEFAULT")
+			}
+		}
 	}
 
-	// 删除已经不存在于model中的字段。
-	buf.Truncate(size)
-	buf.WriteString(" DROP COLUMN ")
-	size = buf.Len()
-	for name, _ := range dbColsMap {
-		buf.Truncate(size)
-		buf.WriteString(name)
-		if _, err := db.Exec(buf.String()); err != nil {
-			return err
+	names = names[:0]
+	for name := range dbCols {
+		if _, found := model.Cols[name]; !found {
+			names = append(names, name)
 		}
 	}
+	sort.Strings(names)
+	for _, name := range names {
+		sqls = append(sqls, prefix+"DROP COLUMN "+name)
+	}
 
-	return nil
+	return sqls, nil
 }
 
 // 获取表的列信息
-func (p *Postgres) getCols(db core.DB, model *core.Model) (map[string]interface{}, error) {
-	sql := "SELECT column_name FROM INFORMATION_SCHEMA.COLUMNS WHERE table_name = ?"
-	rows, err := db.Query(sql, model.Name)
+func (p *Postgres) getCols(db core.DB, model *core.Model) (map[string]*pgCol, error) {
+	sql := `SELECT a.attname, format_type(a.atttypid, a.atttypmod), a.attnotnull, COALESCE(pg_get_expr(d.adbin, d.adrelid), '')
+	FROM pg_attribute AS a JOIN pg_class AS c ON a.attrelid=c.oid
+	LEFT JOIN pg_attrdef AS d ON d.adrelid=a.attrelid AND d.adnum=a.attnum
+	WHERE c.relname=? AND a.attnum>0 AND NOT a.attisdropped`
+	rows, err := db.Query(db.PrepareSQL(sql), db.PrepareSQL(model.Name))
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	dbCols, err := fetch.ColumnString(false, "column_name", rows)
+	cols := map[string]*pgCol{}
+	for rows.Next() {
+		var name string
+		var notNull bool
+		col := &pgCol{}
+		if err = rows.Scan(&name, &col.typ, &notNull, &col.def); err != nil {
+			return nil, err
+		}
+		col.nullable = !notNull
+		cols[name] = col
+	}
+
+	return cols, rows.Err()
+}
+
+// 获取表中所有约束的名称及其定义
+func (p *Postgres) getConstraints(db core.DB, model *core.Model) (map[string]string, error) {
+	sql := `SELECT con.conname, pg_get_constraintdef(con.oid)
+	FROM pg_constraint AS con JOIN pg_class AS cls ON con.conrelid=cls.oid WHERE cls.relname=?`
+	rows, err := db.Query(db.PrepareSQL(sql), db.PrepareSQL(model.Name))
 	if err != nil {
-		return nil, nil
+		return nil, err
 	}
+	defer rows.Close()
 
-	// 转换成map，仅用到键名，键值一律置空
-	dbColsMap := make(map[string]interface{}, len(dbCols))
-	for _, col := range dbCols {
-		dbColsMap[col] = nil
+	conts := map[string]string{}
+	for rows.Next() {
+		var name, def string
+		if err = rows.Scan(&name, &def); err != nil {
+			return nil, err
+		}
+		conts[name] = def
 	}
 
-	return dbColsMap, nil
+	return conts, rows.Err()
 }
 
-// 删除表中所有约束
-func (p *Postgres) deleteConstraints(db core.DB, model *core.Model) error {
-	sql := "SELECT  con.conname FROM pg_constraint AS con, pg_class AS cls WHERE con.conrelid=c.oid AND c.relname=?"
-	rows, err := db.Query(sql, model.Name)
-	if err != nil {
-		return err
+// 返回model中所有约束的名称及其定义，定义的格式与pg_get_constraintdef()相同。
+func (p *Postgres) constraints(db core.DB, model *core.Model) map[string]string {
+	colNames := func(cols []*core.Column) string {
+		names := make([]string, 0, len(cols))
+		for _, col := range cols {
+			names = append(names, col.Name)
+		}
+		return "(" + strings.Join(names, ", ") + ")"
 	}
-	defer rows.Close()
 
-	conts, err := fetch.ColumnString(false, "conname", rows)
-	if err != nil {
-		return err
+	conts := make(map[string]string, 1+len(model.UniqueIndexes)+len(model.FK)+len(model.Check))
+	if len(model.PK) > 0 {
+		conts[pkName] = "PRIMARY KEY " + colNames(model.PK)
+	}
+
+	for name, cols := range model.UniqueIndexes {
+		conts[name] = "UNIQUE " + colNames(cols)
 	}
 
-	buf := bytes.NewBufferString("ALTER TABLE ? DROP CONSTRAINT ?")
-	for _, cont := range conts {
-		if _, err := db.Exec(buf.String(), model.Name, cont); err != nil {
-			return err
+	for name, fk := range model.FK {
+		def := "FOREIGN KEY " + colNames(fk.Cols) + " REFERENCES " + db.PrepareSQL(fk.RefTableName) +
+			"(" + strings.Join(fk.RefColNames, ", ") + ")"
+		if len(fk.UpdateRule) > 0 {
+			def += " ON UPDATE " + fk.UpdateRule
 		}
+		if len(fk.DeleteRule) > 0 {
+			def += " ON DELETE " + fk.DeleteRule
+		}
+		conts[name] = def
 	}
 
-	return nil
+	// check的表达式会被数据库改写，无法比较，只比较名称。
+	for name := range model.Check {
+		conts[name] = "CHECK"
+	}
+
+	return conts
+}
+
+var constraintReplacer = strings.NewReplacer(`"`, "", " ", "", "\t", "", "\n", "")
+
+// 将约束的定义转换成可以比较的格式
+func normalizeConstraint(def string) string {
+	def = strings.ToLower(constraintReplacer.Replace(def))
+	if strings.HasPrefix(def, "check") {
+		return "check"
+	}
+	return def
+}
+
+func isFKDef(def string) bool {
+	return strings.HasPrefix(strings.ToUpper(strings.TrimSpace(def)), "FOREIGN KEY")
+}
+
+// 从addIndexesSQL()产生的语句中获取约束名：
+//  ALTER TABLE tbl ADD CONSTRAINT name ...
+func constraintName(stmt string) string {
+	const flag = " CONSTRAINT "
+	index := strings.Index(stmt, flag)
+	if index < 0 {
+		return ""
+	}
+
+	fields := strings.Fields(stmt[index+len(flag):])
+	if len(fields) == 0 {
+		return ""
+	}
+	return fields[0]
+}
+
+// ALTER COLUMN ... TYPE中不能使用SERIAL等伪类型
+func pgAlterType(typ string) string {
+	switch strings.ToUpper(typ) {
+	case "SERIAL":
+		return "INT"
+	case "BIGSERIAL":
+		return "BIGINT"
+	default:
+		return typ
+	}
+}
+
+// 类型名称与format_type()返回值的对应关系
+var pgTypeNames = map[string]string{
+	"int":              "integer",
+	"int4":             "integer",
+	"int8":             "bigint",
+	"int2":             "smallint",
+	"bool":             "boolean",
+	"time":             "time without time zone",
+	"timestamp":        "timestamp without time zone",
+	"double precision": "double precision",
+	"float8":           "double precision",
+}
+
+// 将类型名称转换成format_type()的格式，并去掉所有空格，以便比较。
+// model和数据库两边的类型名称都需要经过该函数的处理。
+func pgTypeName(typ string) string {
+	typ = strings.ToLower(strings.TrimSpace(typ))
+	if name, found := pgTypeNames[typ]; found {
+		typ = name
+	} else if strings.HasPrefix(typ, "varchar(") {
+		typ = "character varying" + typ[len("varchar"):]
+	}
+	return strings.Replace(typ, " ", "", -1)
+}
+
+// 从默认值表达式中获取默认值，比如'abc'::character varying返回abc；
+// 表达式为空或是由序列产生时，hasDef返回false。
+func pgDefault(expr string) (def string, hasDef bool) {
+	expr = strings.TrimSpace(expr)
+	if len(expr) == 0 || strings.HasPrefix(expr, "nextval(") {
+		return "", false
+	}
+
+	if index := strings.LastIndex(expr, "::"); index > 0 {
+		expr = expr[:index]
+	}
+	expr = strings.TrimPrefix(expr, "(")
+	expr = strings.TrimSuffix(expr, ")")
+	if len(expr) >= 2 && expr[0] == '\'' && expr[len(expr)-1] == '\'' {
+		expr = strings.Replace(expr[1:len(expr)-1], "''", "'", -1)
+	}
+	return expr, true
 }
 
 // implement base.sqlType
@@ -236,6 +497,11 @@ func (p *Postgres) sqlType(buf *bytes.Buffer, col *core.Column) error {
 		return errors.New("无效的col.GoType值")
 	}
 
+	if col.JSON {
+		buf.WriteString("JSONB")
+		return nil
+	}
+
 	switch col.GoType.Kind() {
 	case reflect.Bool:
 		buf.WriteString("BOOLEAN")
@@ -258,28 +524,30 @@ func (p *Postgres) sqlType(buf *bytes.Buffer, col *core.Column) error {
 			buf.WriteString("BIGINT")
 		}
 	case reflect.Float32, reflect.Float64:
-		buf.WriteString(fmt.Sprintf("DOUBLE(%d,%d)", col.Len1, col.Len2))
+		p.floatType(buf, col)
 	case reflect.String:
-		if col.Len1 < 65533 {
+		if col.Len1 > 0 && col.Len1 < 65533 {
 			buf.WriteString(fmt.Sprintf("VARCHAR(%d)", col.Len1))
+		} else {
+			buf.WriteString("TEXT")
 		}
-		buf.WriteString("TEXT")
 	case reflect.Slice, reflect.Array: // []rune,[]byte当作字符串处理
 		k := col.GoType.Elem().Kind()
-		if (k != reflect.Int8) && (k != reflect.Int32) {
+		if (k != reflect.Uint8) && (k != reflect.Int32) {
 			return errors.New("不支持数组类型")
 		}
 
-		if col.Len1 < 65533 {
+		if col.Len1 > 0 && col.Len1 < 65533 {
 			buf.WriteString(fmt.Sprintf("VARCHAR(%d)", col.Len1))
+		} else {
+			buf.WriteString("TEXT")
 		}
-		buf.WriteString("TEXT")
 	case reflect.Struct:
 		switch col.GoType {
 		case nullBool:
 			buf.WriteString("BOOLEAN")
 		case nullFloat64:
-			buf.WriteString(fmt.Sprintf("DOUBLE(%d,%d)", col.Len1, col.Len2))
+			p.floatType(buf, col)
 		case nullInt64:
 			if col.IsAI() {
 				buf.WriteString("BIGSERIAL")
@@ -287,12 +555,15 @@ func (p *Postgres) sqlType(buf *bytes.Buffer, col *core.Column) error {
 				buf.WriteString("BIGINT")
 			}
 		case nullString:
-			if col.Len1 < 65533 {
+			if col.Len1 > 0 && col.Len1 < 65533 {
 				buf.WriteString(fmt.Sprintf("VARCHAR(%d)", col.Len1))
+			} else {
+				buf.WriteString("TEXT")
 			}
-			buf.WriteString("TEXT")
 		case timeType:
 			buf.WriteString("TIME")
+		default:
+			return fmt.Errorf("不支持的类型:[%v]，可以通过type()指定其数据库类型", col.GoType)
 		}
 	default:
 		return fmt.Errorf("不支持的类型:[%v]", col.GoType.Name())
@@ -300,3 +571,12 @@ func (p *Postgres) sqlType(buf *bytes.Buffer, col *core.Column) error {
 
 	return nil
 }
+
+// 指定了长度的浮点数使用NUMERIC，否则使用DOUBLE PRECISION
+func (p *Postgres) floatType(buf *bytes.Buffer, col *core.Column) {
+	if col.Len1 > 0 {
+		buf.WriteString(fmt.Sprintf("NUMERIC(%d,%d)", col.Len1, col.Len2))
+	} else {
+		buf.WriteString("DOUBLE PRECISION")
+	}
+}
@@ -6,8 +6,10 @@ package dialect
 
 import (
 	"testing"
+	"time"
 
 	"github.com/caixw/lib.go/assert"
+	"github.com/caixw/lib.go/orm/core"
 )
 
 var _ base = &Postgres{}
@@ -23,3 +25,88 @@ func TestPostgresGetDBName(t *testing.T) {
 	a.Equal(p.GetDBName("\tdbname=dbname user=abc"), "dbname")
 	a.Equal(p.GetDBName("\tdbname = dbname user=abc"), "dbname")
 }
+
+type postgresUser struct {
+	ID    int64  `orm:"name(id);ai"`
+	Name  string `orm:"name(name);len(20);default(abc);unique(u_name)"`
+	Email string `orm:"name(email);len(50);nullable"`
+	Age   int32  `orm:"name(age);default(18)"`
+
+	Created time.Time `orm:"name(created)"`
+}
+
+func (u *postgresUser) Meta() string {
+	return "name(#pg_user);check(chk_age,{age}>0)"
+}
+
+func TestPostgresDiffTableSQL(t *testing.T) {
+	a := assert.New(t)
+	db := &fakeDB{d: &Sqlite3{}} // 仅用到PrepareSQL()
+
+	m, err := core.NewModel(&postgresUser{})
+	a.NotError(err).NotNil(m)
+
+	// 与model完全相同的表，不产生任何语句
+	cols := map[string]*pgCol{
+		"id":    {typ: "bigint", def: "nextval('prefix_pg_user_id_seq'::regclass)"},
+		"name":  {typ: "character varying(20)", def: "'abc'::character varying"},
+		"email": {typ: "character varying(50)", nullable: true},
+		"age":   {typ: "integer", def: "18"},
+
+		"created": {typ: "time without time zone"},
+	}
+	conts := map[string]string{
+		"pk":      "PRIMARY KEY (id)",
+		"u_name":  "UNIQUE (name)",
+		"chk_age": "CHECK ((age > 0))",
+	}
+	sqls, err := p.diffTableSQL(db, m, cols, conts)
+	a.NotError(err).Empty(sqls)
+
+	// 修改了类型、NOT NULL和默认值，添加和删除列，修改和删除约束
+	cols = map[string]*pgCol{
+		"id":    {typ: "integer", def: "nextval('prefix_pg_user_id_seq'::regclass)"},
+		"name":  {typ: "character varying(20)", nullable: true},
+		"email": {typ: "character varying(50)", nullable: true, def: "'x'::character varying"},
+		"nick":  {typ: "text"},
+
+		"created": {typ: "time without time zone"},
+	}
+	conts = map[string]string{
+		"pk":      "PRIMARY KEY (id)",
+		"u_name":  "UNIQUE (name, email)",
+		"fk_old":  "FOREIGN KEY (nick) REFERENCES prefix_nick(name)",
+		"chk_age": "CHECK ((age > 0))",
+	}
+	sqls, err = p.diffTableSQL(db, m, cols, conts)
+	a.NotError(err).Equal(sqls, []string{
+		"ALTER TABLE #pg_user DROP CONSTRAINT fk_old",
+		"ALTER TABLE #pg_user DROP CONSTRAINT u_name",
+		"ALTER TABLE #pg_user ADD age INT NOT NULL DEFAULT '18'",
+		"ALTER TABLE #pg_user ALTER COLUMN email DROP DEFAULT",
+		"ALTER TABLE #pg_user ALTER COLUMN id TYPE BIGINT",
+		"ALTER TABLE #pg_user ALTER COLUMN name SET NOT NULL",
+		"ALTER TABLE #pg_user ALTER COLUMN name SET DEFAULT 'abc'",
+		"ALTER TABLE #pg_user DROP COLUMN nick",
+		"ALTER TABLE #pg_user ADD CONSTRAINT u_name UNIQUE(name)",
+	})
+}
+
+func TestPgTypeName(t *testing.T) {
+	a := assert.New(t)
+
+	a.Equal(pgTypeName("VARCHAR(20)"), pgTypeName("character varying(20)")).
+		Equal(pgTypeName("NUMERIC(10,2)"), pgTypeName("numeric(10, 2)")).
+		Equal(pgTypeName("INT"), pgTypeName("integer")).
+		Equal(pgTypeName("TIME"), pgTypeName("time without time zone")).
+		Equal(pgTypeName("TIMESTAMP"), pgTypeName("timestamp without time zone")).
+		Equal(pgTypeName("float8"), pgTypeName("double precision")).
+		NotEqual(pgTypeName("VARCHAR(20)"), pgTypeName("text"))
+
+	def, has := pgDefault("'it''s'::character varying")
+	a.True(has).Equal(def, "it's")
+	_, has = pgDefault("nextval('seq'::regclass)")
+	a.False(has)
+	def, has = pgDefault("18")
+	a.True(has).Equal(def, "18")
+}
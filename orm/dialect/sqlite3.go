@@ -7,12 +7,14 @@ package dialect
 import (
 	"bytes"
 	"errors"
+	"fmt"
 	"os"
 	"reflect"
 	"runtime"
 	"strings"
 
 	"github.com/caixw/lib.go/orm/core"
+	"github.com/caixw/lib.go/orm/fetch"
 )
 
 type Sqlite3 struct{}
@@ -22,6 +24,32 @@ func (s *Sqlite3) QuoteStr() (l, r string) {
 	return "[", "]"
 }
 
+// implement core.Dialect.OnConflictSQL()
+func (s *Sqlite3) OnConflictSQL(conflictCols, updateCols []string) string {
+	return onConflictSQL(conflictCols, updateCols)
+}
+
+// implement core.Dialect.SavepointSQL()
+func (s *Sqlite3) SavepointSQL(action int, name string) string {
+	return savepointSQL(action, name)
+}
+
+// implement core.Dialect.MaxPlaceholders()
+// 3.32.0之前的版本限制为999，之后为32766，取较小值以兼容旧版本。
+func (s *Sqlite3) MaxPlaceholders() int {
+	return 999
+}
+
+// implement core.Dialect.MaxInsertRows()
+func (s *Sqlite3) MaxInsertRows() int {
+	return 0
+}
+
+// implement core.Dialect.ReplacePlaceholders()
+func (s *Sqlite3) ReplacePlaceholders(sql string) string {
+	return sql
+}
+
 // implement core.Dialect.SupportLastInsertId()
 func (s *Sqlite3) SupportLastInsertId() bool {
 	return true
@@ -51,19 +79,38 @@ func (s *Sqlite3) LimitSQL(limit int, offset ...int) (sql string, args []interfa
 
 // implement core.Dialect.CreateTable()
 func (s *Sqlite3) CreateTable(db core.DB, m *core.Model) error {
-	has, err := s.hasTable(db, m.Name)
+	sqls, err := s.CreateTableSQL(db, m)
 	if err != nil {
 		return err
 	}
 
+	return execSQLs(db, sqls)
+}
+
+// implement core.Dialect.CreateTableSQL()
+func (s *Sqlite3) CreateTableSQL(db core.DB, m *core.Model) ([]string, error) {
+	has, err := s.HasTable(db, db.PrepareSQL(m.Name))
+	if err != nil {
+		return nil, err
+	}
+
 	if has {
-		return s.createTable(db, m)
+		sqls, err := s.upgradeTableSQL(db, m)
+		if err != nil {
+			return nil, err
+		}
+		return prepareSQLs(db, sqls), nil
+	}
+
+	sql, err := s.createTableSQL(m)
+	if err != nil {
+		return nil, err
 	}
-	return s.upgradeTable(db, m)
+	return []string{db.PrepareSQL(sql)}, nil
 }
 
-// 是否存在指定名称的表
-func (s *Sqlite3) hasTable(db core.DB, tableName string) (bool, error) {
+// implement core.Dialect.HasTable()
+func (s *Sqlite3) HasTable(db core.DB, tableName string) (bool, error) {
 	sql := "SELECT * FROM sqlite_master WHERE type='table' AND name=?"
 	rows, err := db.Query(sql, tableName)
 	if err != nil {
@@ -85,9 +132,16 @@ func (s *Sqlite3) sqlType(buf *bytes.Buffer, col *core.Column) error {
 		return errors.New("无效的col.GoType值")
 	}
 
+	if col.JSON {
+		buf.WriteString("TEXT")
+		return nil
+	}
+
 	switch col.GoType.Kind() {
 	case reflect.String:
 		buf.WriteString("TEXT")
+	case reflect.Bool:
+		buf.WriteString("INTEGER")
 	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
 		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
 		buf.WriteString("INTEGER")
@@ -95,7 +149,7 @@ func (s *Sqlite3) sqlType(buf *bytes.Buffer, col *core.Column) error {
 		buf.WriteString("REAL")
 	case reflect.Array, reflect.Slice:
 		k := col.GoType.Elem().Kind()
-		if (k != reflect.Int8) && (k != reflect.Int32) {
+		if (k != reflect.Uint8) && (k != reflect.Int32) {
 			return errors.New("不支持数组类型")
 		}
 		buf.WriteString("TEXT")
@@ -111,14 +165,18 @@ func (s *Sqlite3) sqlType(buf *bytes.Buffer, col *core.Column) error {
 			buf.WriteString("TEXT")
 		case timeType:
 			buf.WriteString("DATETIME")
+		default:
+			return fmt.Errorf("不支持的类型:[%v]，可以通过type()指定其数据库类型", col.GoType)
 		}
+	default:
+		return fmt.Errorf("不支持的类型:[%v]", col.GoType.Name())
 	}
 
 	return nil
 }
 
-// 创建表
-func (s *Sqlite3) createTable(db core.DB, model *core.Model) error {
+// 产生创建表的语句
+func (s *Sqlite3) createTableSQL(model *core.Model) (string, error) {
 	buf := bytes.NewBufferString("CREATE TABLE IF NOT EXISTS ")
 	buf.Grow(300)
 
@@ -128,11 +186,11 @@ func (s *Sqlite3) createTable(db core.DB, model *core.Model) error {
 	// 写入字段信息
 	for _, col := range model.Cols {
 		if err := createColSQL(s, buf, col); err != nil {
-			return err
+			return "", err
 		}
 
 		if col.IsAI() {
-			buf.WriteString(" AUTOINCRMENT")
+			buf.WriteString(" AUTOINCREMENT")
 		}
 		buf.WriteByte(',')
 	}
@@ -164,74 +222,89 @@ func (s *Sqlite3) createTable(db core.DB, model *core.Model) error {
 	buf.Truncate(buf.Len() - 1) // 去掉最后的逗号
 	buf.WriteByte(')')          // end CreateTable
 
-	_, err := db.Exec(buf.String())
-	return err
+	return buf.String(), nil
 }
 
-// 更新表。Sqlite3并没有更改列类型的方法，只能采取官网说的方法来实现：
+// 产生更新表的语句。Sqlite3并没有更改列类型的方法，只能采取官网说的方法来实现：
 // http://www.sqlite.org/lang_altertable.html
-func (s *Sqlite3) upgradeTable(db core.DB, model *core.Model) error {
-	// 关闭外键
-	if _, err := db.Exec("PRAGMA foreign_keys=OFF"); err != nil {
-		return err
+func (s *Sqlite3) upgradeTableSQL(db core.DB, model *core.Model) ([]string, error) {
+	tableName := db.PrepareSQL(model.Name)
+
+	tmpName, err := s.tmpName(db, tableName)
+	if err != nil {
+		return nil, err
 	}
 
-	tmpName, err := s.rename(db, model.Name)
+	dbCols, err := s.getCols(db, tableName)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	if err := s.createTable(db, model); err != nil {
-		return err
+	createSQL, err := s.createTableSQL(model)
+	if err != nil {
+		return nil, err
+	}
+
+	sqls := []string{
+		"PRAGMA foreign_keys=OFF", // 关闭外键
+		"ALTER TABLE " + model.Name + " RENAME TO " + tmpName,
+		createSQL,
 	}
 
-	// 从tmpName表中导出数据到model.Name表中
-	// "INSERT INTO ?(cols...) SELECT cols FROM ?"
+	// 从tmpName表中导出数据到model.Name表中，只导出两个表中都存在的列。
+	// "INSERT INTO tbl(cols...) SELECT cols FROM tmp"
 	cols := make([]string, 0, len(model.Cols))
 	for colName, _ := range model.Cols {
-		cols = append(cols, colName)
-	}
-	colsSQL := strings.Join(cols, ",")
-	buf := bytes.NewBufferString("INSERT INTO ?(")
-	buf.WriteString(colsSQL)
-	buf.WriteString(") SELECT")
-	buf.WriteString(colsSQL)
-	buf.WriteString("FROM ?")
-	if _, err := db.Exec(buf.String(), model.Name, tmpName); err != nil {
-		return err
+		if _, found := dbCols[colName]; found {
+			cols = append(cols, colName)
+		}
+	}
+	if len(cols) > 0 {
+		colsSQL := strings.Join(cols, ",")
+		sqls = append(sqls, "INSERT INTO "+model.Name+"("+colsSQL+") SELECT "+colsSQL+" FROM "+tmpName)
 	}
 
-	if _, err := db.Exec("DROP TABLE IF EXISTS ?", tmpName); err != nil {
-		return err
+	return append(sqls,
+		"DROP TABLE IF EXISTS "+tmpName,
+		"PRAGMA foreign_keys=ON", // 打开外键
+	), nil
+}
+
+// 获取表的列信息
+func (s *Sqlite3) getCols(db core.DB, tableName string) (map[string]interface{}, error) {
+	rows, err := db.Query("SELECT name FROM pragma_table_info(?)", tableName)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	dbCols, err := fetch.ColumnString(false, "name", rows)
+	if err != nil {
+		return nil, err
 	}
 
-	// 打开外键
-	_, err = db.Exec("PRAGMA foreign_keys=OFF")
+	// 转换成map，仅用到键名，键值一律置空
+	dbColsMap := make(map[string]interface{}, len(dbCols))
+	for _, col := range dbCols {
+		dbColsMap[col] = nil
+	}
 
-	return err
+	return dbColsMap, nil
 }
 
-// 将一个表重命名，新名称通过返回值返回。
-func (s *Sqlite3) rename(db core.DB, tableName string) (string, error) {
+// 为tableName获取一个不存在的临时表名。
+func (s *Sqlite3) tmpName(db core.DB, tableName string) (string, error) {
 	tmpName := tableName + "_tmp"
 	for {
-		has, err := s.hasTable(db, tmpName)
+		has, err := s.HasTable(db, tmpName)
 		if err != nil {
 			return "", err
 		}
 
 		if !has {
-			break
+			return tmpName, nil
 		}
 
 		tmpName += "_tmp"
 	}
-
-	// 将当前表改名
-	sql := "ALTER TABLE ? RENAME TO ?"
-	if _, err := db.Exec(sql, tableName, tmpName); err != nil {
-		return "", err
-	}
-
-	return tmpName, nil
 }
@@ -5,9 +5,11 @@
 package dialect
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/caixw/lib.go/assert"
+	"github.com/caixw/lib.go/orm/core"
 )
 
 var _ base = &Sqlite3{}
@@ -23,3 +25,57 @@ func TestSqlite3GetDBName(t *testing.T) {
 	a.Equal(s.GetDBName("dbname"), "dbname")
 	a.Equal(s.GetDBName(""), "")
 }
+
+type sqlite3User struct {
+	ID   int64  `orm:"name(id);pk"`
+	Name string `orm:"name(name)"`
+}
+
+func (u *sqlite3User) Meta() string {
+	return "name(#user)"
+}
+
+type sqlite3User2 struct {
+	ID    int64  `orm:"name(id);pk"`
+	Email string `orm:"name(email);nullable"`
+}
+
+func (u *sqlite3User2) Meta() string {
+	return "name(#user)"
+}
+
+func TestSqlite3CreateTableSQL(t *testing.T) {
+	a := assert.New(t)
+	db := newFakeDB(a)
+	defer db.close(a)
+
+	m, err := core.NewModel(&sqlite3User{})
+	a.NotError(err).NotNil(m)
+
+	// 表不存在，返回创建语句
+	sqls, err := s.CreateTableSQL(db, m)
+	a.NotError(err).Equal(1, len(sqls))
+	a.True(strings.HasPrefix(sqls[0], "CREATE TABLE IF NOT EXISTS prefix_user("))
+
+	// 只返回语句，并未实际创建表
+	has, err := s.HasTable(db, "prefix_user")
+	a.NotError(err).False(has)
+
+	a.NotError(s.CreateTable(db, m))
+	has, err = s.HasTable(db, "prefix_user")
+	a.NotError(err).True(has)
+
+	// 表已经存在，返回更新语句，且只复制两个表都存在的列。
+	m2, err := core.NewModel(&sqlite3User2{})
+	a.NotError(err).NotNil(m2)
+	sqls, err = s.CreateTableSQL(db, m2)
+	a.NotError(err).Equal(6, len(sqls))
+	a.Equal(sqls[1], "ALTER TABLE prefix_user RENAME TO prefix_user_tmp").
+		True(strings.HasPrefix(sqls[2], "CREATE TABLE IF NOT EXISTS prefix_user(")).
+		Equal(sqls[3], "INSERT INTO prefix_user(id) SELECT id FROM prefix_user_tmp").
+		Equal(sqls[4], "DROP TABLE IF EXISTS prefix_user_tmp")
+
+	a.NotError(s.CreateTable(db, m2))
+	cols, err := s.getCols(db, "prefix_user")
+	a.NotError(err).Equal(cols, map[string]interface{}{"id": nil, "email": nil})
+}
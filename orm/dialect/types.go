@@ -0,0 +1,105 @@
+// Copyright 2014 by caixw, All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package dialect
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+
+	"github.com/caixw/lib.go/orm/core"
+)
+
+// 自定义类型与数据库类型的对应关系
+var types = &typesMap{items: map[reflect.Type]map[reflect.Type]string{}}
+
+type typesMap struct {
+	sync.Mutex
+
+	// 第一层以Dialect的类型为键名，第二层以Go类型为键名。
+	items map[reflect.Type]map[reflect.Type]string
+}
+
+// 注册Go类型在某一Dialect中对应的数据库类型。
+// 之后该Dialect创建表时，类型为goType的列都会使用sqlType作为其类型。
+// goType可以是类型的值，也可以是reflect.Type：
+//  dialect.RegisterType(&dialect.Mysql{}, Decimal{}, "DECIMAL(10,2)")
+//  dialect.RegisterType(&dialect.Postgres{}, Decimal{}, "NUMERIC(10,2)")
+func RegisterType(d core.Dialect, goType interface{}, sqlType string) error {
+	if d == nil {
+		return errors.New("d参数不能为空")
+	}
+	if goType == nil {
+		return errors.New("goType参数不能为空")
+	}
+	if len(sqlType) == 0 {
+		return errors.New("sqlType参数不能为空")
+	}
+
+	t, ok := goType.(reflect.Type)
+	if !ok {
+		t = reflect.TypeOf(goType)
+	}
+
+	types.Lock()
+	defer types.Unlock()
+
+	dt := reflect.TypeOf(d)
+	items, found := types.items[dt]
+	if !found {
+		items = map[reflect.Type]string{}
+		types.items[dt] = items
+	}
+
+	if _, found := items[t]; found {
+		return fmt.Errorf("类型[%v]已经注册", t)
+	}
+
+	items[t] = sqlType
+	return nil
+}
+
+// 查找由RegisterType()注册的类型
+func getType(d core.Dialect, t reflect.Type) (string, bool) {
+	types.Lock()
+	defer types.Unlock()
+
+	typ, found := types.items[reflect.TypeOf(d)][t]
+	return typ, found
+}
+
+// 将col的数据库类型写入buf中，按以下顺序确定类型：
+// 通过type()指定的类型；由RegisterType()注册的类型；
+// 实现了driver.Valuer接口的，根据Value()返回值的类型推导；
+// 最后才是根据GoType推导。JSON列直接由sqlType()决定。
+func writeSQLType(b base, buf *bytes.Buffer, col *core.Column) error {
+	if len(col.SQLType) > 0 {
+		buf.WriteString(col.SQLType)
+		return nil
+	}
+
+	if col.GoType == nil {
+		return errors.New("无效的col.GoType值")
+	}
+
+	if col.JSON {
+		return b.sqlType(buf, col)
+	}
+
+	if typ, found := getType(b, col.GoType); found {
+		buf.WriteString(typ)
+		return nil
+	}
+
+	if t := col.DriverType(); t != nil && t != col.GoType {
+		c := *col
+		c.GoType = t
+		return b.sqlType(buf, &c)
+	}
+
+	return b.sqlType(buf, col)
+}
@@ -0,0 +1,100 @@
+// Copyright 2014 by caixw, All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package dialect
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"reflect"
+	"testing"
+
+	"github.com/caixw/lib.go/assert"
+	"github.com/caixw/lib.go/orm/core"
+)
+
+// 以字符串形式保存的decimal类型
+type typesDecimal struct {
+	val string
+}
+
+func (d typesDecimal) Value() (driver.Value, error) {
+	return d.val, nil
+}
+
+type typesPoint struct {
+	X, Y float64
+}
+
+func TestRegisterType(t *testing.T) {
+	a := assert.New(t)
+
+	a.NotError(RegisterType(&Mysql{}, typesPoint{}, "POINT"))
+	a.NotError(RegisterType(&Postgres{}, reflect.TypeOf(typesPoint{}), "POINT"))
+	a.Error(RegisterType(&Mysql{}, typesPoint{}, "POINT")) // 重复注册
+	a.Error(RegisterType(&Mysql{}, typesDecimal{}, ""))
+	a.Error(RegisterType(nil, typesDecimal{}, "DECIMAL"))
+
+	typ, found := getType(&Mysql{}, reflect.TypeOf(typesPoint{}))
+	a.True(found).Equal(typ, "POINT")
+
+	_, found = getType(&Sqlite3{}, reflect.TypeOf(typesPoint{}))
+	a.False(found)
+}
+
+func TestWriteSQLType(t *testing.T) {
+	a := assert.New(t)
+	d := &Sqlite3{}
+	buf := bytes.NewBufferString("")
+
+	a.NotError(RegisterType(d, typesPoint{}, "BLOB"))
+
+	// type()
+	col := &core.Column{GoType: reflect.TypeOf(1.0), SQLType: "DECIMAL(10,2)"}
+	a.NotError(writeSQLType(d, buf, col))
+	a.Equal(buf.String(), "DECIMAL(10,2)")
+
+	// RegisterType()
+	buf.Reset()
+	col = &core.Column{GoType: reflect.TypeOf(typesPoint{})}
+	a.NotError(writeSQLType(d, buf, col))
+	a.Equal(buf.String(), "BLOB")
+
+	// driver.Valuer
+	buf.Reset()
+	col = &core.Column{GoType: reflect.TypeOf(typesDecimal{})}
+	a.NotError(writeSQLType(d, buf, col))
+	a.Equal(buf.String(), "TEXT")
+
+	// 指针类型的driver.Valuer
+	buf.Reset()
+	col = &core.Column{GoType: reflect.TypeOf(&typesDecimal{})}
+	a.NotError(writeSQLType(d, buf, col))
+	a.Equal(buf.String(), "TEXT")
+
+	// JSON，优先于RegisterType()注册的类型
+	buf.Reset()
+	col = &core.Column{GoType: reflect.TypeOf(typesPoint{}), JSON: true}
+	a.NotError(writeSQLType(d, buf, col))
+	a.Equal(buf.String(), "TEXT")
+
+	buf.Reset()
+	a.NotError(writeSQLType(&Mysql{}, buf, col))
+	a.Equal(buf.String(), "JSON")
+
+	buf.Reset()
+	a.NotError(writeSQLType(&Postgres{}, buf, col))
+	a.Equal(buf.String(), "JSONB")
+
+	// 普通类型
+	buf.Reset()
+	col = &core.Column{GoType: reflect.TypeOf(int64(1))}
+	a.NotError(writeSQLType(d, buf, col))
+	a.Equal(buf.String(), "INTEGER")
+
+	// 无法识别的类型
+	buf.Reset()
+	col = &core.Column{GoType: reflect.TypeOf(struct{}{})}
+	a.Error(writeSQLType(d, buf, col))
+}
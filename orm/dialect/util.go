@@ -5,9 +5,14 @@
 package dialect
 
 import (
+	"bytes"
 	"database/sql"
 	"reflect"
+	"strconv"
+	"strings"
 	"time"
+
+	"github.com/caixw/lib.go/orm/core"
 )
 
 const (
@@ -22,6 +27,15 @@ var (
 	timeType    = reflect.TypeOf(time.Time{})
 )
 
+// 表名中的引用符号，用于从表名生成约束名。
+var quoteReplacer = strings.NewReplacer("{", "", "}", "")
+
+// 以表名为前缀的主键约束名。
+// oracle和sql server的约束名在整个schema中必须是唯一的，不能直接使用pkName。
+func tablePKName(model *core.Model) string {
+	return quoteReplacer.Replace(model.Name) + "_" + pkName
+}
+
 // mysq系列数据库分页语法的实现。支持以下数据库：
 // MySQL, H2, HSQLDB, Postgres, SQLite3
 func mysqlLimitSQL(limit int, offset ...int) (string, []interface{}) {
@@ -41,3 +55,81 @@ func oracleLimitSQL(limit int, offset ...int) (string, []interface{}) {
 
 	return " OFFSET ? ROWS FETCH NEXT ? ROWS ONLY ", []interface{}{offset[0], limit}
 }
+
+// 将s转换成SQL中的字符串字面量，s中的单引号会被转义：
+//  it's ==> 'it''s'
+func quoteLiteral(s string) string {
+	return "'" + strings.Replace(s, "'", "''", -1) + "'"
+}
+
+// 将sql中的?占位符依次替换成prefix1,prefix2...的形式，单引号和双引号中的?保持不变。
+//  replacePlaceholders("SELECT * FROM user WHERE id=? AND name='?'", ":")
+//  // SELECT * FROM user WHERE id=:1 AND name='?'
+func replacePlaceholders(sql, prefix string) string {
+	if strings.IndexByte(sql, '?') < 0 {
+		return sql
+	}
+
+	buf := bytes.NewBuffer(make([]byte, 0, len(sql)+16))
+	var quote rune // 当前所在引号的类型，为0表示不在引号中
+	index := 0
+	for _, c := range sql {
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '?':
+			index++
+			buf.WriteString(prefix)
+			buf.WriteString(strconv.Itoa(index))
+			continue
+		}
+		buf.WriteRune(c)
+	}
+	return buf.String()
+}
+
+// 标准的ON CONFLICT语法的实现。支持以下数据库：
+// Postgres 9.5+, SQLite3 3.24+
+func onConflictSQL(conflictCols, updateCols []string) string {
+	buf := bytes.NewBufferString(" ON CONFLICT(")
+	for _, col := range conflictCols {
+		buf.WriteString(col)
+		buf.WriteByte(',')
+	}
+	buf.Truncate(buf.Len() - 1) // 去掉最后的逗号
+	buf.WriteByte(')')
+
+	if len(updateCols) == 0 {
+		buf.WriteString(" DO NOTHING")
+		return buf.String()
+	}
+
+	buf.WriteString(" DO UPDATE SET ")
+	for _, col := range updateCols {
+		buf.WriteString(col)
+		buf.WriteString("=EXCLUDED.")
+		buf.WriteString(col)
+		buf.WriteByte(',')
+	}
+	buf.Truncate(buf.Len() - 1) // 去掉最后的逗号
+
+	return buf.String()
+}
+
+// 标准的保存点语句，mysql，postgres和sqlite3都支持。
+func savepointSQL(action int, name string) string {
+	switch action {
+	case core.SavepointBegin:
+		return "SAVEPOINT " + name
+	case core.SavepointRelease:
+		return "RELEASE SAVEPOINT " + name
+	case core.SavepointRollback:
+		return "ROLLBACK TO SAVEPOINT " + name
+	default:
+		return ""
+	}
+}
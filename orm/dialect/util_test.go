@@ -8,6 +8,7 @@ import (
 	"testing"
 
 	"github.com/caixw/lib.go/assert"
+	"github.com/caixw/lib.go/orm/core"
 )
 
 func TestMysqlLimitSQL(t *testing.T) {
@@ -33,3 +34,48 @@ func TestOracleLimitSQL(t *testing.T) {
 	a.StringEqual(sql, "FETCH NEXT ? ROWS ONLY ", style).
 		Equal(args, []interface{}{5})
 }
+
+func TestQuoteLiteral(t *testing.T) {
+	a := assert.New(t)
+
+	a.Equal(quoteLiteral("abc"), "'abc'")
+	a.Equal(quoteLiteral("it's"), "'it''s'")
+	a.Equal(quoteLiteral(""), "''")
+}
+
+func TestReplacePlaceholders(t *testing.T) {
+	a := assert.New(t)
+
+	a.Equal(replacePlaceholders("SELECT * FROM user", ":"), "SELECT * FROM user")
+	a.Equal(replacePlaceholders("SELECT * FROM user WHERE id=? AND age>?", ":"),
+		"SELECT * FROM user WHERE id=:1 AND age>:2")
+	a.Equal(replacePlaceholders("SELECT * FROM user WHERE id=? AND age>?", "@p"),
+		"SELECT * FROM user WHERE id=@p1 AND age>@p2")
+
+	// 引号中的?保持不变
+	a.Equal(replacePlaceholders(`SELECT "a?" FROM user WHERE name='?''?' AND id=?`, ":"),
+		`SELECT "a?" FROM user WHERE name='?''?' AND id=:1`)
+
+	// 多次替换不改变结果
+	sql := replacePlaceholders("UPDATE user SET name=? WHERE id=?", ":")
+	a.Equal(replacePlaceholders(sql, ":"), sql)
+}
+
+func TestOnConflictSQL(t *testing.T) {
+	a := assert.New(t)
+
+	sql := onConflictSQL([]string{"{id}"}, []string{"{name}", "{email}"})
+	a.StringEqual(sql, " ON CONFLICT({id}) DO UPDATE SET {name}=EXCLUDED.{name},{email}=EXCLUDED.{email}", style)
+
+	sql = onConflictSQL([]string{"{id}", "{gid}"}, nil)
+	a.StringEqual(sql, " ON CONFLICT({id},{gid}) DO NOTHING", style)
+}
+
+func TestSavepointSQL(t *testing.T) {
+	a := assert.New(t)
+
+	a.Equal(savepointSQL(core.SavepointBegin, "sp_1"), "SAVEPOINT sp_1")
+	a.Equal(savepointSQL(core.SavepointRelease, "sp_1"), "RELEASE SAVEPOINT sp_1")
+	a.Equal(savepointSQL(core.SavepointRollback, "sp_1"), "ROLLBACK TO SAVEPOINT sp_1")
+	a.Equal(savepointSQL(-1, "sp_1"), "")
+}
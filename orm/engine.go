@@ -5,6 +5,7 @@
 package orm
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"strings"
@@ -17,15 +18,28 @@ import (
 // 供SQL和model包使用
 
 type Engine struct {
-	name   string // 数据库的名称
-	prefix string // 表名前缀
-	d      core.Dialect
-	db     *sql.DB
-	stmts  *core.Stmts
-	sql    *SQL // 内置的SQL引擎，用于执行Update等操作
+	name     string            // 数据库的名称
+	prefix   string            // 表名前缀
+	replacer *strings.Replacer // PrepareSQL()使用的替换规则，由prefix和Dialect决定
+	d        core.Dialect
+	db       *sql.DB
+	stmts    *core.Stmts
+	models   *core.Models
+	sql      *SQL // 内置的SQL引擎，用于执行Update等操作
+
+	migrations []*Migration // 所有的迁移操作，按版本号排序
+
+	replicas    *replicaSet // 从库，为nil表示没有从库
+	primaryOnly bool        // 是否所有操作都只在主库上执行
+
+	logger Logger // SQL语句的日志，为nil表示不记录
+	cache  Cache  // 查询结果的缓存，为nil表示不缓存
+
+	prefixes *prefixStmts // WithPrefix()返回实例的sql.Stmt缓存
 }
 
-func newEngine(driverName, dataSourceName, prefix string) (*Engine, error) {
+// replicas为从库的连接信息，可以为空。
+func newEngine(driverName, dataSourceName, prefix string, replicas []Replica, opts []Option) (*Engine, error) {
 	d, found := dialect.Get(driverName)
 	if !found {
 		return nil, fmt.Errorf("未找到与driverName[%v]相同的Dialect", driverName)
@@ -36,15 +50,35 @@ func newEngine(driverName, dataSourceName, prefix string) (*Engine, error) {
 		return nil, err
 	}
 
+	o := newOptions(opts)
+	o.apply(dbInst)
+	if o.ping {
+		if err = o.pingDB(context.Background(), dbInst); err != nil {
+			dbInst.Close()
+			return nil, err
+		}
+	}
+
 	inst := &Engine{
 		db:     dbInst,
 		d:      d,
-		prefix: prefix,
 		name:   d.GetDBName(dataSourceName),
+		models: core.NewModels(),
+		prefixes: &prefixStmts{
+			items: map[string]*core.Stmts{},
+		},
 	}
+	inst.setPrefix(prefix)
 	inst.stmts = core.NewStmts(inst)
 	inst.sql = inst.SQL()
 
+	if len(replicas) > 0 {
+		if inst.replicas, err = newReplicaSet(driverName, replicas, o); err != nil {
+			dbInst.Close()
+			return nil, err
+		}
+	}
+
 	return inst, nil
 }
 
@@ -58,13 +92,21 @@ func (e *Engine) GetStmts() *core.Stmts {
 	return e.stmts
 }
 
+// 对orm/core.DB.GetModels()的实现，返回当前Engine的Model缓存容器。
+func (e *Engine) GetModels() *core.Models {
+	return e.models
+}
+
 // 对orm/core.DB.PrepareSQL()的实现。替换语句的各种占位符。
 func (e *Engine) PrepareSQL(sql string) string {
-	// TODO 缓存replace
-	l, r := e.Dialect().QuoteStr()
-	replace := strings.NewReplacer("{", l, "}", r, "#", e.prefix)
+	return e.replacer.Replace(sql)
+}
 
-	return replace.Replace(sql)
+// 设置表名前缀，同时更新PrepareSQL()的替换规则。
+func (e *Engine) setPrefix(prefix string) {
+	l, r := e.d.QuoteStr()
+	e.prefix = prefix
+	e.replacer = strings.NewReplacer("{", l, "}", r, "#", prefix)
 }
 
 // 对orm/core.DB.Dialect()的实现。返回当前数据库对应的Dialect
@@ -73,35 +115,69 @@ func (e *Engine) Dialect() core.Dialect {
 }
 
 // 对orm/core.DB.Exec()的实现。执行一条非查询的SQL语句。
+//
+// 包括Query()和Prepare()等在内的所有执行语句的方法，
+// 都会通过Dialect.ReplacePlaceholders()将?占位符替换成数据库驱动支持的形式。
 func (e *Engine) Exec(sql string, args ...interface{}) (sql.Result, error) {
-	return e.db.Exec(sql, args...)
+	return execContext(context.Background(), e.logger, e.db, e.d.ReplacePlaceholders(sql), args)
 }
 
 // 对orm/core.DB.Query()的实现，执行一条查询语句。
+// 存在从库时，在从库上执行。
 func (e *Engine) Query(sql string, args ...interface{}) (*sql.Rows, error) {
-	return e.db.Query(sql, args...)
+	return queryContext(context.Background(), e.logger, e.reader(), e.d.ReplacePlaceholders(sql), args)
 }
 
 // 对orm/core.DB.QueryRow()的实现。
-// 执行一条查询语句，并返回第一条符合条件的记录。
+// 执行一条查询语句，并返回第一条符合条件的记录。存在从库时，在从库上执行。
 func (e *Engine) QueryRow(sql string, args ...interface{}) *sql.Row {
-	return e.db.QueryRow(sql, args...)
+	return queryRowContext(context.Background(), e.logger, e.reader(), e.d.ReplacePlaceholders(sql), args)
 }
 
 // 对orm/core.DB.Prepare()的实现。预处理SQL语句成sql.Stmt实例。
 func (e *Engine) Prepare(sql string) (*sql.Stmt, error) {
-	return e.db.Prepare(sql)
+	return prepareContext(context.Background(), e.logger, e.db, e.d.ReplacePlaceholders(sql))
+}
+
+// 对orm/core.DB.ExecContext()的实现。
+func (e *Engine) ExecContext(ctx context.Context, sql string, args ...interface{}) (sql.Result, error) {
+	return execContext(ctx, e.logger, e.db, e.d.ReplacePlaceholders(sql), args)
+}
+
+// 对orm/core.DB.QueryContext()的实现。存在从库时，在从库上执行。
+func (e *Engine) QueryContext(ctx context.Context, sql string, args ...interface{}) (*sql.Rows, error) {
+	return queryContext(ctx, e.logger, e.reader(), e.d.ReplacePlaceholders(sql), args)
+}
+
+// 对orm/core.DB.QueryRowContext()的实现。存在从库时，在从库上执行。
+func (e *Engine) QueryRowContext(ctx context.Context, sql string, args ...interface{}) *sql.Row {
+	return queryRowContext(ctx, e.logger, e.reader(), e.d.ReplacePlaceholders(sql), args)
+}
+
+// 对orm/core.DB.PrepareContext()的实现。
+func (e *Engine) PrepareContext(ctx context.Context, sql string) (*sql.Stmt, error) {
+	return prepareContext(ctx, e.logger, e.db, e.d.ReplacePlaceholders(sql))
 }
 
 // 关闭当前的db，销毁所有的数据。不能再次使用。
 func (e *Engine) close() {
 	e.stmts.Close()
+	e.prefixes.close()
 	e.db.Close()
+	if e.replicas != nil {
+		e.replicas.close()
+	}
 }
 
 // 开始一个新的事务
 func (e *Engine) Begin() (*Tx, error) {
-	tx, err := e.db.Begin()
+	return e.BeginTx(context.Background(), nil)
+}
+
+// 开始一个新的事务，ctx被取消时，事务会被自动回滚。
+// opts可以为nil，表示使用默认的隔离级别。
+func (e *Engine) BeginTx(ctx context.Context, opts *sql.TxOptions) (*Tx, error) {
+	tx, err := e.db.BeginTx(ctx, opts)
 	if err != nil {
 		return nil, err
 	}
@@ -114,6 +190,27 @@ func (e *Engine) Begin() (*Tx, error) {
 	return ret, nil
 }
 
+// 在事务中执行fn。fn返回错误或是发生panic时回滚事务，否则提交事务，
+// panic在回滚之后会被继续抛出。
+//  err := e.Transaction(func(tx *Tx) error {
+//      if err := tx.Insert(u); err != nil {
+//          return err
+//      }
+//      return tx.Update(g)
+//  })
+func (e *Engine) Transaction(fn func(*Tx) error) error {
+	return e.TransactionContext(context.Background(), nil, fn)
+}
+
+// 功能同Transaction()，但可以通过ctx取消操作，以及通过opts指定事务的隔离级别等。
+func (e *Engine) TransactionContext(ctx context.Context, opts *sql.TxOptions, fn func(*Tx) error) error {
+	tx, err := e.BeginTx(ctx, opts)
+	if err != nil {
+		return err
+	}
+	return transaction(tx, fn)
+}
+
 // 查找缓存的sql.Stmt，在未找到的情况下，第二个参数返回false
 func (e *Engine) Stmt(name string) (*sql.Stmt, bool) {
 	return e.stmts.Get(name)
@@ -129,27 +226,116 @@ func (e *Engine) Where(cond string, args ...interface{}) *SQL {
 
 // 插入一个或多个数据
 // v可以是对象或是对象数组
+//
+// 值为零的自增列不会被插入，由数据库生成；Dialect支持LastInsertId()时，
+// 生成的值会被写入对应的字段中，此时v需要是指针或是指针数组。
 func (e *Engine) Insert(v interface{}) error {
-	return insertMult(e.sql, v)
+	return e.InsertContext(context.Background(), v)
+}
+
+// 功能同Insert()，但可以通过ctx取消操作。
+func (e *Engine) InsertContext(ctx context.Context, v interface{}) error {
+	return insertMult(ctx, e.sql, v, false)
+}
+
+// 以多行VALUES的insert语句批量插入数据，返回每一批次实际插入的行数。
+// v为对象数组；batchSize为每条语句插入的最大行数，
+// 同时受限于数据库允许的占位符数量和VALUES的行数，小于等于0时只受后两者限制。
+// 不支持多行VALUES的数据库，比如oracle，会逐行插入。
+// 自增列的值为零时由数据库生成，但生成的值不会写入对象中；同一批次中的值不能部分为零。
+//
+// 所有批次在同一个事务中执行，任意一批失败时，所有批次都会被回滚；
+// 钩子方法接收到的db参数为该事务。
+func (e *Engine) InsertBatch(v interface{}, batchSize int) ([]int64, error) {
+	return e.InsertBatchContext(context.Background(), v, batchSize)
+}
+
+// 功能同InsertBatch()，但可以通过ctx取消操作。
+func (e *Engine) InsertBatchContext(ctx context.Context, v interface{}, batchSize int) ([]int64, error) {
+	var rows []int64
+	err := e.TransactionContext(ctx, nil, func(tx *Tx) (err error) {
+		rows, err = insertBatch(ctx, tx, v, batchSize)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// 插入或是更新一个或多个数据。
+// 若数据的主键或唯一索引已经存在，则更新该记录的其它列，否则插入新记录。
+// v可以是对象或是对象数组
+func (e *Engine) Upsert(v interface{}) error {
+	return e.UpsertContext(context.Background(), v)
+}
+
+// 功能同Upsert()，但可以通过ctx取消操作。
+func (e *Engine) UpsertContext(ctx context.Context, v interface{}) error {
+	return insertMult(ctx, e.sql, v, true)
+}
+
+// 根据v的主键或是唯一索引的值，读取该记录的所有列到v中。
+// v只能是struct指针，记录不存在时返回sql.ErrNoRows。
+//  u := &User{ID: 1}
+//  err := e.Select(u)
+func (e *Engine) Select(v interface{}) error {
+	return e.SelectContext(context.Background(), v)
+}
+
+// 功能同Select()，但可以通过ctx取消操作。
+func (e *Engine) SelectContext(ctx context.Context, v interface{}) error {
+	return selectOne(ctx, e.sql, v)
 }
 
 // 更新一个或多个类型。
 // 更新依据为每个对象的主键或是唯一索引列。
 // 若不存在此两个类型的字段，则返回错误信息。
 func (e *Engine) Update(v interface{}) error {
-	return updateMult(e.sql, v)
+	return e.UpdateContext(context.Background(), v)
+}
+
+// 功能同Update()，但可以通过ctx取消操作。
+func (e *Engine) UpdateContext(ctx context.Context, v interface{}) error {
+	return updateMult(ctx, e.sql, v)
 }
 
 // 删除指定的数据对象。
+// 若对象存在软删除列，则只是标记为删除，并不会真正从数据库中删除。
 func (e *Engine) Delete(v interface{}) error {
-	return deleteMult(e.sql, v)
+	return e.DeleteContext(context.Background(), v)
+}
+
+// 功能同Delete()，但可以通过ctx取消操作。
+func (e *Engine) DeleteContext(ctx context.Context, v interface{}) error {
+	return deleteMult(ctx, e.sql, v, false)
+}
+
+// 删除指定的数据对象，即使对象存在软删除列，也会从数据库中真正删除。
+func (e *Engine) ForceDelete(v interface{}) error {
+	return e.ForceDeleteContext(context.Background(), v)
+}
+
+// 功能同ForceDelete()，但可以通过ctx取消操作。
+func (e *Engine) ForceDeleteContext(ctx context.Context, v interface{}) error {
+	return deleteMult(ctx, e.sql, v, true)
 }
 
 // 根据obj创建表
 func (e *Engine) Create(obj interface{}) error {
-	m, err := core.NewModel(obj)
+	m, err := e.models.New(obj)
 	if err != nil {
 		return err
 	}
-	return e.Dialect().CreateTable(e, m)
+	return e.Dialect().CreateTable(e.UsePrimary(), m)
+}
+
+// 返回根据obj创建或是更新表时需要执行的DDL语句，但并不实际执行。
+// 可以用于在执行Create()之前审核语句的内容。
+func (e *Engine) CreateSQL(obj interface{}) ([]string, error) {
+	m, err := e.models.New(obj)
+	if err != nil {
+		return nil, err
+	}
+	return e.Dialect().CreateTableSQL(e.UsePrimary(), m)
 }
@@ -5,6 +5,7 @@
 package orm
 
 import (
+	"fmt"
 	"strconv"
 )
 
@@ -18,3 +19,14 @@ func (err Errors) Error() string {
 
 	return ret
 }
+
+// 使用乐观锁更新数据时，数据库中的版本号与对象中的不一致，
+// 说明数据已经被其它操作修改过。
+type ConflictError struct {
+	Table   string      // 表名
+	Version interface{} // 对象中的版本号
+}
+
+func (err *ConflictError) Error() string {
+	return fmt.Sprintf("表[%v]中的数据已经被修改，版本号[%v]已经失效", err.Table, err.Version)
+}
@@ -8,10 +8,6 @@ import (
 	"database/sql"
 	"fmt"
 	"reflect"
-	"unicode"
-
-	"github.com/caixw/lib.go/conv"
-	"github.com/caixw/lib.go/encoding/tag"
 )
 
 // 将v转换成map[string]reflect.Value形式，其中键名为对象的字段名，
@@ -22,72 +18,40 @@ func parseObj(v reflect.Value, ret *map[string]reflect.Value) error {
 		v = v.Elem()
 	}
 
-	if v.Kind() != reflect.Struct {
-		return fmt.Errorf("v参数的类型只能是reflect.Struct或是struct的指针,当前为[%v]", v.Kind())
+	p, err := getPlan(v.Type())
+	if err != nil {
+		return err
 	}
 
-	vt := v.Type()
-	num := vt.NumField()
-	for i := 0; i < num; i++ {
-		field := vt.Field(i)
-
-		if field.Anonymous { // 匿名对象
-			parseObj(v.Field(i), ret)
-			continue
-		}
-
-		tagTxt := field.Tag.Get("orm")
-		if len(tagTxt) == 0 { // 不存在struct tag
-			goto FIELD_NAME
-		}
-
-		if tagTxt[0] == '-' { // 该字段被标记为忽略
-			continue
-		}
+	for name, f := range p.fields {
+		(*ret)[name] = fieldByIndex(v, f.index)
+	}
+	return nil
+}
 
-		if name, found := tag.Get(tagTxt, "name"); found {
-			if _, found := (*ret)[name[0]]; found {
-				return fmt.Errorf("已存在相同名字的字段[%v]", field.Name)
-			}
-			(*ret)[name[0]] = v.Field(i)
-			continue
-		}
+// 将rows中的当前记录写入到val中，必须保证val的类型为reflect.Struct。
+func scanObj(val reflect.Value, cols []string, rows *sql.Rows) error {
+	p, err := getPlan(val.Type())
+	if err != nil {
+		return err
+	}
 
-	FIELD_NAME:
-		if unicode.IsUpper(rune(field.Name[0])) {
-			if _, found := (*ret)[field.Name]; found {
-				return fmt.Errorf("已存在相同名字的字段[%v]", field.Name)
-			}
-			(*ret)[field.Name] = v.Field(i)
-		}
-	} // end for
-	return nil
+	return rows.Scan(p.dests(val, cols)...)
 }
 
 // 将rows中的一条记录写入到val中，必须保证val的类型为reflect.Struct。
 // 仅供Obj()调用。
 func fetchOnceObj(val reflect.Value, rows *sql.Rows) error {
-	mapped, err := Map(true, rows)
+	cols, err := rows.Columns()
 	if err != nil {
 		return err
 	}
 
-	objItem := make(map[string]reflect.Value, 0)
-	if err = parseObj(val, &objItem); err != nil {
-		return err
-	}
-
-	for index, item := range objItem {
-		v, found := mapped[0][index]
-		if !found {
-			continue
-		}
-		if err = conv.To(v, item); err != nil {
-			return err
-		}
+	if !rows.Next() {
+		return rows.Err()
 	}
 
-	return nil
+	return scanObj(val, cols, rows)
 }
 
 // 将rows中的记录按obj的长度数量导出到obj中。
@@ -102,34 +66,18 @@ func fetchObjToFixedSlice(val reflect.Value, rows *sql.Rows) error {
 		return fmt.Errorf("元素类型只能为reflect.Struct或是struct指针，当前为[%v]", itemType.Kind())
 	}
 
-	// 先导出数据到map中
-	mapped, err := Map(false, rows)
+	cols, err := rows.Columns()
 	if err != nil {
 		return err
 	}
 
-	l := len(mapped)
-	if l > val.Len() {
-		l = val.Len()
-	}
-
-	for i := 0; i < l; i++ {
-		objItem := make(map[string]reflect.Value, 0)
-		if err = parseObj(val.Index(i), &objItem); err != nil {
+	for i := 0; i < val.Len() && rows.Next(); i++ {
+		if err = scanObj(elemStruct(val.Index(i)), cols, rows); err != nil {
 			return err
 		}
-		for index, item := range objItem {
-			v, found := mapped[i][index]
-			if !found {
-				continue
-			}
-			if err = conv.To(v, item); err != nil {
-				return err
-			}
-		} // end for objItem
 	}
 
-	return nil
+	return rows.Err()
 }
 
 // 将rows中的所有记录导出到val中，val必须为slice的指针。
@@ -138,7 +86,8 @@ func fetchObjToSlice(val reflect.Value, rows *sql.Rows) error {
 	elem := val.Elem()
 
 	itemType := elem.Type().Elem()
-	if itemType.Kind() == reflect.Ptr {
+	isPtr := itemType.Kind() == reflect.Ptr
+	if isPtr {
 		itemType = itemType.Elem()
 	}
 	// 判断数组元素的类型是否为struct
@@ -146,39 +95,41 @@ func fetchObjToSlice(val reflect.Value, rows *sql.Rows) error {
 		return fmt.Errorf("元素类型只能为reflect.Struct或是struct指针，当前为[%v]", itemType.Kind())
 	}
 
-	// 先导出数据到map中
-	mapped, err := Map(false, rows)
+	cols, err := rows.Columns()
 	if err != nil {
 		return err
 	}
 
-	// 使elem表示的数组长度最起码和mapped一样。
-	size := len(mapped) - elem.Len()
-	if size > 0 {
-		for i := 0; i < size; i++ {
-			elem = reflect.Append(elem, reflect.New(itemType))
+	i := 0
+	for ; rows.Next(); i++ {
+		// 使elem表示的数组长度最起码和rows一样。
+		if i >= elem.Len() {
+			item := reflect.New(itemType)
+			if !isPtr {
+				item = item.Elem()
+			}
+			elem = reflect.Append(elem, item)
 		}
-		val.Elem().Set(elem)
-	}
 
-	for i := 0; i < len(mapped); i++ {
-		objItem := make(map[string]reflect.Value, 0)
-		if err = parseObj(elem.Index(i), &objItem); err != nil {
+		if err = scanObj(elemStruct(elem.Index(i)), cols, rows); err != nil {
 			return err
 		}
+	}
+	val.Elem().Set(elem)
 
-		for index, item := range objItem {
-			e, found := mapped[i][index]
-			if !found {
-				continue
-			}
-			if err = conv.To(e, item); err != nil {
-				return err
-			}
-		} // end for objItem
+	return rows.Err()
+}
+
+// 获取数组元素v对应的struct，v为nil指针时，会为其分配内存。
+func elemStruct(v reflect.Value) reflect.Value {
+	if v.Kind() != reflect.Ptr {
+		return v
 	}
 
-	return nil
+	if v.IsNil() {
+		v.Set(reflect.New(v.Type().Elem()))
+	}
+	return v.Elem()
 }
 
 // 将rows中的数据导出到obj中。obj只有在类型为slice指针时，
@@ -225,3 +176,38 @@ func Obj(obj interface{}, rows *sql.Rows) (err error) {
 		return fmt.Errorf("不允许的数据类型：[%v]", val.Kind())
 	}
 }
+
+// 将rows中的当前记录导出到obj中，obj只能为struct指针。
+//
+// 与Obj()不同，Row()不会调用rows.Next()，由调用者控制读取的进度，
+// 可以逐条处理大量的数据，而不需要将所有数据都加载到内存中：
+//  for rows.Next() {
+//      u := &User{}
+//      if err := Row(u, rows); err != nil {
+//          return err
+//      }
+//  }
+func Row(obj interface{}, rows *sql.Rows) error {
+	val := reflect.ValueOf(obj)
+	if val.Kind() != reflect.Ptr || val.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("obj只能为struct指针，当前为[%v]", val.Kind())
+	}
+
+	cols, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+
+	return scanObj(val.Elem(), cols, rows)
+}
+
+// 功能同Row()，但由调用者提供rows.Columns()的返回值，
+// 在循环中调用时，可以避免每一行都重新获取列名。
+func RowColumns(obj interface{}, cols []string, rows *sql.Rows) error {
+	val := reflect.ValueOf(obj)
+	if val.Kind() != reflect.Ptr || val.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("obj只能为struct指针，当前为[%v]", val.Kind())
+	}
+
+	return scanObj(val.Elem(), cols, rows)
+}
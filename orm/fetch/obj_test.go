@@ -196,3 +196,33 @@ func TestObj(t *testing.T) {
 	a.Error(Obj(obj, rows))
 	a.NotError(rows.Close())
 }
+
+func TestRow(t *testing.T) {
+	a := assert.New(t)
+	db := initDB(a)
+	defer closeDB(db, a)
+
+	rows, err := db.Query(`SELECT id,Email FROM user WHERE id<3 ORDER BY id`)
+	a.NotError(err).NotNil(rows)
+
+	objs := []FetchUser{}
+	for rows.Next() {
+		obj := FetchUser{}
+		a.NotError(Row(&obj, rows))
+		objs = append(objs, obj)
+	}
+	a.NotError(rows.Err()).NotError(rows.Close())
+
+	a.Equal([]FetchUser{
+		{Id: 0, FetchEmail: FetchEmail{Email: "email-0"}},
+		{Id: 1, FetchEmail: FetchEmail{Email: "email-1"}},
+		{Id: 2, FetchEmail: FetchEmail{Email: "email-2"}},
+	}, objs)
+
+	// 非struct指针
+	rows, err = db.Query(`SELECT id,Email FROM user WHERE id<3 ORDER BY id`)
+	a.NotError(err).NotNil(rows)
+	a.True(rows.Next())
+	a.Error(Row(FetchUser{}, rows))
+	a.NotError(rows.Close())
+}
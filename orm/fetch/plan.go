@@ -0,0 +1,227 @@
+// Copyright 2014 by caixw, All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package fetch
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/caixw/lib.go/conv"
+	"github.com/caixw/lib.go/encoding/tag"
+)
+
+var scannerType = reflect.TypeOf((*sql.Scanner)(nil)).Elem()
+
+// plan缓存
+var plans = &plansMap{items: map[reflect.Type]*plan{}}
+
+type plansMap struct {
+	sync.Mutex
+	items map[reflect.Type]*plan
+}
+
+// 一个struct类型的字段导出计划，
+// 记录了每个列名所对应的字段，避免每一行数据都重新解析struct。
+type plan struct {
+	fields map[string]*planField // 以列名为键名
+}
+
+type planField struct {
+	index   []int // 字段的索引，可用于reflect.Value.FieldByIndex()
+	scanner bool  // 字段的指针是否实现了sql.Scanner接口
+	json    bool  // 字段是否以JSON格式保存
+}
+
+// 获取类型t对应的plan，t的类型必须为reflect.Struct。
+func getPlan(t reflect.Type) (*plan, error) {
+	plans.Lock()
+	defer plans.Unlock()
+
+	if p, found := plans.items[t]; found {
+		return p, nil
+	}
+
+	p := &plan{fields: map[string]*planField{}}
+	if err := p.parse(t, nil); err != nil {
+		return nil, err
+	}
+
+	plans.items[t] = p
+	return p, nil
+}
+
+// 解析类型t中的所有字段。支持匿名字段，不会转换不可导出(小写字母开头)的
+// 字段，也不会转换struct tag以-开头的字段。
+// parent为t在上一级struct中的索引。
+func (p *plan) parse(t reflect.Type, parent []int) error {
+	if t.Kind() != reflect.Struct {
+		return fmt.Errorf("v参数的类型只能是reflect.Struct或是struct的指针,当前为[%v]", t.Kind())
+	}
+
+	num := t.NumField()
+	for i := 0; i < num; i++ {
+		field := t.Field(i)
+		index := make([]int, len(parent), len(parent)+1)
+		copy(index, parent)
+		index = append(index, i)
+
+		if field.Anonymous { // 匿名对象，忽略其中的错误。
+			typ := field.Type
+			if typ.Kind() == reflect.Ptr {
+				typ = typ.Elem()
+			}
+			p.parse(typ, index)
+			continue
+		}
+
+		if len(field.PkgPath) > 0 { // 不可导出的字段
+			continue
+		}
+
+		f := &planField{
+			index:   index,
+			scanner: reflect.PtrTo(field.Type).Implements(scannerType),
+		}
+
+		name := field.Name
+		tagTxt := field.Tag.Get("orm")
+		if len(tagTxt) > 0 {
+			if tagTxt[0] == '-' { // 该字段被标记为忽略
+				continue
+			}
+
+			if n, found := tag.Get(tagTxt, "name"); found {
+				name = n[0]
+			}
+			f.json = tag.Has(tagTxt, "json")
+		}
+
+		if _, found := p.fields[name]; found {
+			return fmt.Errorf("已存在相同名字的字段[%v]", field.Name)
+		}
+		p.fields[name] = f
+	}
+
+	return nil
+}
+
+// 根据列名cols，返回val中各列对应的rows.Scan()参数。
+// 没有对应字段的列，其值会被丢弃。
+func (p *plan) dests(val reflect.Value, cols []string) []interface{} {
+	dests := make([]interface{}, len(cols))
+	for i, col := range cols {
+		f, found := p.fields[col]
+		if !found {
+			dests[i] = new(interface{})
+			continue
+		}
+
+		field := fieldByIndex(val, f.index)
+		switch {
+		case f.json:
+			dests[i] = &jsonScanner{field: field}
+		case f.scanner:
+			dests[i] = field.Addr().Interface()
+		default:
+			dests[i] = &fieldScanner{field: field}
+		}
+	}
+
+	return dests
+}
+
+// 功能同reflect.Value.FieldByIndex()，
+// 但会为路径中值为nil的匿名struct指针分配内存。
+func fieldByIndex(v reflect.Value, index []int) reflect.Value {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+
+	return v
+}
+
+// 将从数据库读取的值写入到一个未实现sql.Scanner接口的字段中。
+type fieldScanner struct {
+	field reflect.Value
+}
+
+// implement sql.Scanner.Scan()
+func (f *fieldScanner) Scan(src interface{}) error {
+	if src == nil { // NULL
+		f.field.Set(reflect.Zero(f.field.Type()))
+		return nil
+	}
+
+	// 常用类型直接赋值，其它的交由conv.To()处理。
+	switch f.field.Kind() {
+	case reflect.String:
+		switch v := src.(type) {
+		case string:
+			f.field.SetString(v)
+			return nil
+		case []byte:
+			f.field.SetString(string(v))
+			return nil
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if v, ok := src.(int64); ok {
+			f.field.SetInt(v)
+			return nil
+		}
+	case reflect.Float32, reflect.Float64:
+		if v, ok := src.(float64); ok {
+			f.field.SetFloat(v)
+			return nil
+		}
+	case reflect.Slice:
+		if v, ok := src.([]byte); ok && f.field.Type().Elem().Kind() == reflect.Uint8 {
+			// src的内容在下次调用rows.Next()之后可能会被修改，需要复制。
+			f.field.SetBytes(append([]byte{}, v...))
+			return nil
+		}
+	case reflect.Struct:
+		if v, ok := src.(time.Time); ok && f.field.Type() == reflect.TypeOf(v) {
+			f.field.Set(reflect.ValueOf(v))
+			return nil
+		}
+	}
+
+	return conv.To(src, f.field)
+}
+
+// 将从数据库读取的JSON字符串转换到字段中。
+type jsonScanner struct {
+	field reflect.Value
+}
+
+// implement sql.Scanner.Scan()
+func (j *jsonScanner) Scan(src interface{}) error {
+	var data []byte
+	switch v := src.(type) {
+	case nil: // NULL
+		j.field.Set(reflect.Zero(j.field.Type()))
+		return nil
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		return fmt.Errorf("无法将[%T]转换成JSON", src)
+	}
+
+	// 先清空原有的值，否则map等类型会保留原来的键值。
+	j.field.Set(reflect.Zero(j.field.Type()))
+	return json.Unmarshal(data, j.field.Addr().Interface())
+}
@@ -0,0 +1,126 @@
+// Copyright 2014 by caixw, All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package fetch
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/caixw/lib.go/assert"
+)
+
+// 实现了sql.Scanner接口的类型，将读取的内容转换成大写。
+type upperString string
+
+func (s *upperString) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case string:
+		*s = upperString(strings.ToUpper(v))
+	case []byte:
+		*s = upperString(strings.ToUpper(string(v)))
+	default:
+		return errors.New("无法转换")
+	}
+	return nil
+}
+
+type planUser struct {
+	*FetchEmail
+	Id       int         `orm:"name(id)"`
+	Username upperString `orm:"name(Username)"`
+	Group    string      `orm:"name(group)"`
+	age      int
+	Regdate  int `orm:"-"`
+}
+
+func TestGetPlan(t *testing.T) {
+	a := assert.New(t)
+
+	p1, err := getPlan(reflect.TypeOf(planUser{}))
+	a.NotError(err).NotNil(p1)
+	a.Equal(4, len(p1.fields))
+
+	a.Equal(p1.fields["Email"].index, []int{0, 0}).
+		False(p1.fields["Email"].scanner)
+	a.Equal(p1.fields["id"].index, []int{1})
+	a.True(p1.fields["Username"].scanner)
+
+	// 缓存
+	p2, err := getPlan(reflect.TypeOf(planUser{}))
+	a.NotError(err).True(p1 == p2)
+
+	// 非struct
+	_, err = getPlan(reflect.TypeOf(5))
+	a.Error(err)
+
+	// 相同名称的字段
+	_, err = getPlan(reflect.TypeOf(struct {
+		ID  int `orm:"name(id)"`
+		ID2 int `orm:"name(id)"`
+	}{}))
+	a.Error(err)
+}
+
+func TestObjScanner(t *testing.T) {
+	a := assert.New(t)
+	db := initDB(a)
+	defer closeDB(db, a)
+
+	rows, err := db.Query(`SELECT id,Email,Username,[group],NULL AS Regdate FROM user WHERE id<2 ORDER BY id`)
+	a.NotError(err).NotNil(rows)
+
+	objs := []planUser{}
+	a.NotError(Obj(&objs, rows))
+	a.NotError(rows.Close())
+
+	a.Equal(2, len(objs))
+	a.Equal(objs[1].Id, 1).
+		Equal(objs[1].Email, "email-1").
+		Equal(objs[1].Username, upperString("USERNAME-1")).
+		Equal(objs[1].Group, "1")
+
+	// NULL值
+	rows, err = db.Query(`SELECT NULL AS id,NULL AS Email FROM user WHERE id=1`)
+	a.NotError(err).NotNil(rows)
+	obj := &planUser{Id: 5}
+	a.NotError(Obj(obj, rows))
+	a.NotError(rows.Close())
+	a.Equal(obj.Id, 0).Equal(obj.Email, "")
+}
+
+type planJSON struct {
+	Id   int               `orm:"name(id)"`
+	Tags []string          `orm:"name(tags);json"`
+	Meta map[string]string `orm:"name(meta);json"`
+}
+
+func TestObjJSON(t *testing.T) {
+	a := assert.New(t)
+	db := initDB(a)
+	defer closeDB(db, a)
+
+	rows, err := db.Query(`SELECT 1 AS id,'["a","b"]' AS tags,'{"k":"v"}' AS meta`)
+	a.NotError(err).NotNil(rows)
+	obj := &planJSON{Meta: map[string]string{"old": "old"}}
+	a.NotError(Obj(obj, rows))
+	a.NotError(rows.Close())
+	a.Equal(obj, &planJSON{Id: 1, Tags: []string{"a", "b"}, Meta: map[string]string{"k": "v"}})
+
+	// NULL
+	rows, err = db.Query(`SELECT 1 AS id,NULL AS tags`)
+	a.NotError(err).NotNil(rows)
+	obj = &planJSON{Tags: []string{"a"}}
+	a.NotError(Obj(obj, rows))
+	a.NotError(rows.Close())
+	a.Nil(obj.Tags)
+
+	// 无效的JSON
+	rows, err = db.Query(`SELECT 1 AS id,'["a",' AS tags`)
+	a.NotError(err).NotNil(rows)
+	a.Error(Obj(obj, rows))
+	a.NotError(rows.Close())
+}
@@ -0,0 +1,37 @@
+// Copyright 2014 by caixw, All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+// gen根据model生成对应的列引用代码。
+//
+// 对于以下model：
+//  type User struct {
+//      ID   int64  `orm:"name(id);ai"`
+//      Name string `orm:"name(name);len(20)"`
+//  }
+//
+//  func (u *User) Meta() string { return "name(#user)" }
+//
+// 生成的代码为：
+//  const UserTable = "#user"
+//
+//  var UserCols = struct {
+//      ID   orm.Col
+//      Name orm.Col
+//  }{
+//      ID:   "{id}",
+//      Name: "{name}",
+//  }
+//
+// 之后就可以通过UserCols.Name.Like("abc%")等方式构建查询条件，
+// model中的字段被修改之后，重新生成代码，引用了旧字段的地方将无法通过编译。
+//
+// 一般在一个单独的程序中调用WriteFile()，再通过go generate执行：
+//  //go:generate go run ./cmd/gencols
+//  func main() {
+//      err := gen.WriteFile("./cols.go", "models", &models.User{}, &models.Group{})
+//      if err != nil {
+//          panic(err)
+//      }
+//  }
+package gen
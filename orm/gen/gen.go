@@ -0,0 +1,136 @@
+// Copyright 2014 by caixw, All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package gen
+
+import (
+	"bytes"
+	"errors"
+	"go/format"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"sort"
+	"strconv"
+
+	"github.com/caixw/lib.go/orm/core"
+)
+
+const header = `// 该文件由github.com/caixw/lib.go/orm/gen自动生成，请勿手动修改。
+
+package `
+
+// 生成objs的列引用代码，并写入到w中。
+// pkg为生成代码所在的包名，objs为model的实例，
+// 其类型必须是具名的struct或是struct指针。
+func Write(w io.Writer, pkg string, objs ...interface{}) error {
+	if len(objs) == 0 {
+		return errors.New("objs参数不能为空")
+	}
+
+	buf := bytes.NewBufferString(header)
+	buf.WriteString(pkg)
+	buf.WriteString("\n\nimport \"github.com/caixw/lib.go/orm\"\n")
+
+	for _, obj := range objs {
+		if err := writeModel(buf, obj); err != nil {
+			return err
+		}
+	}
+
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(src)
+	return err
+}
+
+// 功能同Write()，但直接将代码写入到path文件中，文件已经存在则覆盖。
+func WriteFile(path, pkg string, objs ...interface{}) error {
+	buf := new(bytes.Buffer)
+	if err := Write(buf, pkg, objs...); err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(path, buf.Bytes(), 0644)
+}
+
+// 生成单个model的代码
+func writeModel(buf *bytes.Buffer, obj interface{}) error {
+	t := reflect.TypeOf(obj)
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct || len(t.Name()) == 0 {
+		return errors.New("obj参数只能是具名的struct或是struct指针")
+	}
+
+	m, err := core.NewModel(obj)
+	if err != nil {
+		return err
+	}
+
+	cols := make([]*core.Column, 0, len(m.Cols))
+	for _, col := range m.Cols {
+		cols = append(cols, col)
+	}
+
+	// 按字段在struct中的顺序输出
+	order := map[string]int{}
+	fieldOrder(t, order)
+	sort.Slice(cols, func(i, j int) bool {
+		return order[cols[i].GoName] < order[cols[j].GoName]
+	})
+
+	name := t.Name()
+
+	buf.WriteString("\n// ")
+	buf.WriteString(name)
+	buf.WriteString("Table 为")
+	buf.WriteString(name)
+	buf.WriteString("对应的表名。\nconst ")
+	buf.WriteString(name)
+	buf.WriteString("Table = ")
+	buf.WriteString(strconv.Quote(m.Name))
+	buf.WriteString("\n\n// ")
+
+	buf.WriteString(name)
+	buf.WriteString("Cols 为")
+	buf.WriteString(name)
+	buf.WriteString("中各列的引用。\nvar ")
+	buf.WriteString(name)
+	buf.WriteString("Cols = struct {\n")
+	for _, col := range cols {
+		buf.WriteString(col.GoName)
+		buf.WriteString(" orm.Col\n")
+	}
+	buf.WriteString("}{\n")
+	for _, col := range cols {
+		buf.WriteString(col.GoName)
+		buf.WriteString(": ")
+		buf.WriteString(strconv.Quote("{" + col.Name + "}"))
+		buf.WriteString(",\n")
+	}
+	buf.WriteString("}\n")
+
+	return nil
+}
+
+// 获取t中各字段的顺序，匿名字段中的字段按其出现的位置展开，
+// 与core.NewModel()解析字段的规则相同。
+func fieldOrder(t reflect.Type, order map[string]int) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			fieldOrder(field.Type, order)
+			continue
+		}
+
+		if _, found := order[field.Name]; !found {
+			order[field.Name] = len(order)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+// Copyright 2014 by caixw, All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package gen
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/caixw/lib.go/assert"
+)
+
+type base struct {
+	Created int64 `orm:"name(created)"`
+}
+
+type genUser struct {
+	ID       int64  `orm:"name(id);ai"`
+	Username string `orm:"name(username);len(20)"`
+	base
+	Email  string `orm:"name(email)"`
+	Ignore string `orm:"-"`
+}
+
+func (u *genUser) Meta() string {
+	return "name(#user)"
+}
+
+type genGroup struct {
+	ID int64 `orm:"name(id)"`
+}
+
+const wont = `// 该文件由github.com/caixw/lib.go/orm/gen自动生成，请勿手动修改。
+
+package models
+
+import "github.com/caixw/lib.go/orm"
+
+// genUserTable 为genUser对应的表名。
+const genUserTable = "#user"
+
+// genUserCols 为genUser中各列的引用。
+var genUserCols = struct {
+	ID       orm.Col
+	Username orm.Col
+	Created  orm.Col
+	Email    orm.Col
+}{
+	ID:       "{id}",
+	Username: "{username}",
+	Created:  "{created}",
+	Email:    "{email}",
+}
+
+// genGroupTable 为genGroup对应的表名。
+const genGroupTable = "genGroup"
+
+// genGroupCols 为genGroup中各列的引用。
+var genGroupCols = struct {
+	ID orm.Col
+}{
+	ID: "{id}",
+}
+`
+
+func TestWrite(t *testing.T) {
+	a := assert.New(t)
+
+	buf := new(bytes.Buffer)
+	a.NotError(Write(buf, "models", &genUser{}, genGroup{}))
+	a.Equal(buf.String(), wont)
+
+	// 无效的参数
+	a.Error(Write(buf, "models"))
+	a.Error(Write(buf, "models", 5))
+	a.Error(Write(buf, "models", &struct{ ID int }{}))
+}
+
+func TestWriteFile(t *testing.T) {
+	a := assert.New(t)
+	path := "./cols_test.txt"
+	defer os.Remove(path)
+
+	a.NotError(WriteFile(path, "models", &genUser{}, &genGroup{}))
+	data, err := ioutil.ReadFile(path)
+	a.NotError(err).Equal(string(data), wont)
+}
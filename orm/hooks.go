@@ -0,0 +1,104 @@
+// Copyright 2014 by caixw, All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package orm
+
+import (
+	"reflect"
+
+	"github.com/caixw/lib.go/orm/core"
+)
+
+// 以下接口可以由数据对象选择性地实现，在Insert()，Update()，
+// Delete()和Fetch()等操作的前后被调用。
+//
+// 参数db为执行当前操作的Engine或是Tx实例，在事务中执行时，
+// 可以通过db在同一事务中执行其它操作。
+// Before系列的方法返回错误时，将中止当前操作，并返回该错误。
+// 对象以值的形式传递时，钩子方法在其副本的指针上调用，
+// 对副本的修改会作用于当前操作，但不会反映到原来的对象上。
+//  type User struct {
+//      Password string
+//      Created  int64
+//  }
+//
+//  func (u *User) BeforeInsert(db core.DB) error {
+//      u.Created = time.Now().Unix()
+//      return nil
+//  }
+
+// 在插入数据之前调用
+type BeforeInserter interface {
+	BeforeInsert(db core.DB) error
+}
+
+// 在插入数据之后调用
+type AfterInserter interface {
+	AfterInsert(db core.DB) error
+}
+
+// 在更新数据之前调用
+type BeforeUpdater interface {
+	BeforeUpdate(db core.DB) error
+}
+
+// 在更新数据之后调用
+type AfterUpdater interface {
+	AfterUpdate(db core.DB) error
+}
+
+// 在删除数据之前调用，包括软删除。
+type BeforeDeleter interface {
+	BeforeDelete(db core.DB) error
+}
+
+// 在删除数据之后调用，包括软删除。
+type AfterDeleter interface {
+	AfterDelete(db core.DB) error
+}
+
+// 在通过SQL.Fetch()导出数据之后调用
+type AfterFetcher interface {
+	AfterFetch(db core.DB) error
+}
+
+// 返回可以调用钩子方法的对象。v不是指针时，返回其副本的指针，
+// 以免接收者为指针的钩子方法被忽略。
+func hookObj(v interface{}) interface{} {
+	rval := reflect.ValueOf(v)
+	if rval.Kind() == reflect.Ptr {
+		return v
+	}
+
+	ptr := reflect.New(rval.Type())
+	ptr.Elem().Set(rval)
+	return ptr.Interface()
+}
+
+var afterFetcherType = reflect.TypeOf((*AfterFetcher)(nil)).Elem()
+
+// 对v中的每一个对象调用AfterFetch()方法，
+// v可以是orm/fetch.Obj()中允许的所有类型。
+func afterFetch(db core.DB, v interface{}) error {
+	if t := objType(v); t == nil || !reflect.PtrTo(t).Implements(afterFetcherType) {
+		return nil
+	}
+
+	vals, _, err := structValues(v)
+	if err != nil {
+		return err
+	}
+
+	for _, val := range vals {
+		if !val.CanAddr() {
+			continue
+		}
+
+		if err := val.Addr().Interface().(AfterFetcher).AfterFetch(db); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,119 @@
+// Copyright 2014 by caixw, All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package orm
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/caixw/lib.go/assert"
+	"github.com/caixw/lib.go/orm/core"
+)
+
+type hookUser struct {
+	ID      int64  `orm:"name(id);pk"`
+	Name    string `orm:"name(name)"`
+	Version int64  `orm:"name(version)"`
+
+	Display string   `orm:"-"`
+	called  []string // 被调用的钩子函数
+	db      core.DB  // 钩子函数接收到的db参数
+}
+
+func (u *hookUser) Meta() string {
+	return "name(#user)"
+}
+
+func (u *hookUser) BeforeInsert(db core.DB) error {
+	u.called = append(u.called, "BeforeInsert")
+	u.db = db
+	u.Version = 100
+	return nil
+}
+
+func (u *hookUser) AfterInsert(db core.DB) error {
+	u.called = append(u.called, "AfterInsert")
+	return nil
+}
+
+func (u *hookUser) BeforeUpdate(db core.DB) error {
+	if len(u.Name) == 0 {
+		return errors.New("name不能为空")
+	}
+	u.called = append(u.called, "BeforeUpdate")
+	return nil
+}
+
+func (u *hookUser) AfterUpdate(db core.DB) error {
+	u.called = append(u.called, "AfterUpdate")
+	return nil
+}
+
+func (u *hookUser) BeforeDelete(db core.DB) error {
+	u.called = append(u.called, "BeforeDelete")
+	return nil
+}
+
+func (u *hookUser) AfterDelete(db core.DB) error {
+	u.called = append(u.called, "AfterDelete")
+	return nil
+}
+
+func (u *hookUser) AfterFetch(db core.DB) error {
+	u.Display = "user:" + u.Name
+	return nil
+}
+
+func TestHooks(t *testing.T) {
+	a := assert.New(t)
+	e := newUtilDB(a, "hooks")
+	defer closeUtilDB(a, "hooks")
+
+	u := &hookUser{ID: 1, Name: "u1"}
+	a.NotError(e.Insert(u))
+	a.Equal(u.called, []string{"BeforeInsert", "AfterInsert"}).
+		Equal(u.db, e)
+
+	// BeforeUpdate()中断操作
+	u.called = nil
+	u.Name = ""
+	a.Error(e.Update(u))
+	a.Empty(u.called)
+
+	u.Name = "u1-1"
+	a.NotError(e.Update(u))
+	a.Equal(u.called, []string{"BeforeUpdate", "AfterUpdate"})
+
+	// AfterFetch()
+	users := []*hookUser{}
+	a.NotError(e.SQL().Table("#user").Columns("*").Fetch(&users))
+	a.Equal(1, len(users)).
+		Equal(users[0].Display, "user:u1-1").
+		Equal(users[0].Version, 100)
+
+	u.called = nil
+	a.NotError(e.Delete(u))
+	a.Equal(u.called, []string{"BeforeDelete", "AfterDelete"})
+
+	// 在事务中，db参数为Tx实例。
+	tx, err := e.Begin()
+	a.NotError(err).NotNil(tx)
+	u = &hookUser{ID: 2, Name: "u2"}
+	a.NotError(tx.Insert(u))
+	a.Equal(u.db, tx)
+	a.NotError(tx.Commit())
+	// 以值的形式传递时，钩子方法在副本上调用
+	a.NotError(e.Insert(hookUser{ID: 3, Name: "u3"}))
+	val := &hookUser{ID: 3}
+	a.NotError(e.Select(val))
+	a.Equal(val.Version, 100)
+	a.Error(e.Update(hookUser{ID: 3})) // BeforeUpdate()返回错误
+
+	_, err = e.InsertBatch([1]hookUser{{ID: 4, Name: "u4"}}, 0)
+	a.NotError(err)
+	val = &hookUser{ID: 4}
+	a.NotError(e.Select(val))
+	a.Equal(val.Version, 100)
+}
@@ -0,0 +1,139 @@
+// Copyright 2014 by caixw, All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package orm
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/caixw/lib.go/logs"
+)
+
+// 一条SQL语句的执行信息，由Engine和Tx在执行完语句之后传递给Logger。
+type QueryInfo struct {
+	SQL      string        // 最终执行的语句，已经替换了?占位符
+	Args     []interface{} // 语句的参数
+	Duration time.Duration // 执行语句所用的时间
+	Rows     int64         // 受影响的行数，仅Exec()有效，其它操作为-1
+	Err      error         // 执行过程中返回的错误
+}
+
+// 记录SQL语句的执行情况，通过Engine.SetLogger()指定。
+//
+// Engine和Tx的Exec()、Query()、QueryRow()和Prepare()及其Context版本
+// 在执行完之后都会调用Log()，Log()的调用会阻塞这些操作，不应该太耗时。
+//
+// 预编译的语句只在Prepare()时记录一次：Engine.Stmt()、Tx.Stmt()、SQL.Stmt()
+// 以及core.Stmts返回的都是*sql.Stmt，之后通过它们执行的语句不会被记录。
+type Logger interface {
+	Log(info *QueryInfo)
+}
+
+// 将SQL语句输出到logs.LevelLogger的某一级别中。
+type levelLogger struct {
+	l     *logs.LevelLogger
+	level int
+	slow  time.Duration
+}
+
+// 声明一个将SQL语句输出到l的level级别中的Logger。
+//
+// slow为慢查询的阈值，大于0时，只输出执行时间大于等于slow的语句，
+// 执行出错的语句不受此限制；小于等于0时，输出所有的语句。
+//  l, _ := logs.NewFromFile("./logs.xml")
+//  e.SetLogger(orm.NewLevelLogger(l, logs.LevelWarn, 500*time.Millisecond))
+func NewLevelLogger(l *logs.LevelLogger, level int, slow time.Duration) Logger {
+	return &levelLogger{l: l, level: level, slow: slow}
+}
+
+// implement Logger.Log()
+func (l *levelLogger) Log(info *QueryInfo) {
+	if info.Err != nil {
+		l.l.Printf(l.level, "[%v] %v %v %v", info.Duration, info.SQL, info.Args, info.Err)
+		return
+	}
+
+	if l.slow > 0 && info.Duration < l.slow {
+		return
+	}
+
+	l.l.Printf(l.level, "[%v] %v %v rows:%v", info.Duration, info.SQL, info.Args, info.Rows)
+}
+
+// 指定SQL语句的日志记录，为nil表示不记录。
+// 该设置同时作用于由e创建的Tx，不能在执行语句的同时调用。
+func (e *Engine) SetLogger(l Logger) {
+	e.logger = l
+}
+
+// 以下函数为Engine和Tx共用的带日志记录的语句执行函数。
+
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+	PrepareContext(ctx context.Context, query string) (*sql.Stmt, error)
+}
+
+func logQuery(l Logger, query string, args []interface{}, start time.Time, rows int64, err error) {
+	l.Log(&QueryInfo{
+		SQL:      query,
+		Args:     args,
+		Duration: time.Since(start),
+		Rows:     rows,
+		Err:      err,
+	})
+}
+
+func execContext(ctx context.Context, l Logger, db execer, query string, args []interface{}) (sql.Result, error) {
+	if l == nil {
+		return db.ExecContext(ctx, query, args...)
+	}
+
+	start := time.Now()
+	r, err := db.ExecContext(ctx, query, args...)
+	rows := int64(-1)
+	if err == nil {
+		if n, e := r.RowsAffected(); e == nil {
+			rows = n
+		}
+	}
+	logQuery(l, query, args, start, rows, err)
+	return r, err
+}
+
+func queryContext(ctx context.Context, l Logger, db execer, query string, args []interface{}) (*sql.Rows, error) {
+	if l == nil {
+		return db.QueryContext(ctx, query, args...)
+	}
+
+	start := time.Now()
+	rows, err := db.QueryContext(ctx, query, args...)
+	logQuery(l, query, args, start, -1, err)
+	return rows, err
+}
+
+func queryRowContext(ctx context.Context, l Logger, db execer, query string, args []interface{}) *sql.Row {
+	if l == nil {
+		return db.QueryRowContext(ctx, query, args...)
+	}
+
+	start := time.Now()
+	row := db.QueryRowContext(ctx, query, args...)
+	logQuery(l, query, args, start, -1, row.Err())
+	return row
+}
+
+func prepareContext(ctx context.Context, l Logger, db execer, query string) (*sql.Stmt, error) {
+	if l == nil {
+		return db.PrepareContext(ctx, query)
+	}
+
+	start := time.Now()
+	stmt, err := db.PrepareContext(ctx, query)
+	logQuery(l, query, nil, start, -1, err)
+	return stmt, err
+}
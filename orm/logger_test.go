@@ -0,0 +1,106 @@
+// Copyright 2014 by caixw, All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package orm
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/caixw/lib.go/assert"
+	"github.com/caixw/lib.go/logs"
+)
+
+// 记录所有QueryInfo的Logger
+type testLogger struct {
+	infos []*QueryInfo
+}
+
+func (l *testLogger) Log(info *QueryInfo) {
+	l.infos = append(l.infos, info)
+}
+
+func TestEngineSetLogger(t *testing.T) {
+	a := assert.New(t)
+	e := newUtilDB(a, "logger")
+	defer closeUtilDB(a, "logger")
+
+	l := &testLogger{}
+	e.SetLogger(l)
+
+	a.NotError(e.Insert(&utilUser{ID: 1, Name: "n1"}))
+	a.Equal(len(l.infos), 1)
+	info := l.infos[0]
+	a.True(strings.Contains(info.SQL, "util_user")).
+		False(strings.Contains(info.SQL, "#")).
+		Equal(info.Rows, 1).
+		NotError(info.Err)
+
+	ids, err := e.SQL().Table("#user").Columns("{id}").FetchColumns("id")
+	a.NotError(err).Equal(ids, []interface{}{1})
+	a.Equal(len(l.infos), 2)
+	a.Equal(l.infos[1].Rows, -1).NotError(l.infos[1].Err)
+
+	_, err = e.Exec("SELECT * FROM not_exists WHERE id=?", 5)
+	a.Error(err)
+	a.Equal(len(l.infos), 3)
+	info = l.infos[2]
+	a.Equal(info.SQL, "SELECT * FROM not_exists WHERE id=?").
+		Equal(info.Args, []interface{}{5}).
+		Equal(info.Err, err)
+
+	// 事务中的语句
+	a.NotError(e.Transaction(func(tx *Tx) error {
+		return tx.Insert(&utilUser{ID: 2, Name: "n2"})
+	}))
+	a.Equal(len(l.infos), 4)
+
+	// 取消日志
+	e.SetLogger(nil)
+	a.NotError(e.Insert(&utilUser{ID: 3, Name: "n3"}))
+	a.Equal(len(l.infos), 4)
+}
+
+var logsBuffer = new(bytes.Buffer)
+
+func init() {
+	logs.Register("ormbuffer", func(map[string]string) (io.Writer, error) {
+		return logsBuffer, nil
+	})
+}
+
+func TestLevelLogger(t *testing.T) {
+	a := assert.New(t)
+
+	ll, err := logs.NewFromXml(strings.NewReader(`<logs><info flag=""><ormbuffer /></info></logs>`))
+	a.NotError(err).NotNil(ll)
+
+	// 输出所有语句
+	logsBuffer.Reset()
+	l := NewLevelLogger(ll, logs.LevelInfo, 0)
+	l.Log(&QueryInfo{SQL: "SELECT 1", Args: []interface{}{1}, Rows: -1})
+	a.True(strings.Contains(logsBuffer.String(), "SELECT 1"))
+
+	// 只输出慢查询和出错的语句
+	logsBuffer.Reset()
+	l = NewLevelLogger(ll, logs.LevelInfo, time.Second)
+	l.Log(&QueryInfo{SQL: "SELECT 1", Duration: time.Millisecond})
+	a.Equal(logsBuffer.Len(), 0)
+
+	l.Log(&QueryInfo{SQL: "SELECT 2", Duration: 2 * time.Second})
+	a.True(strings.Contains(logsBuffer.String(), "SELECT 2"))
+
+	l.Log(&QueryInfo{SQL: "SELECT 3", Err: errors.New("error")})
+	a.True(strings.Contains(logsBuffer.String(), "SELECT 3"))
+
+	// 其它级别不输出
+	logsBuffer.Reset()
+	l = NewLevelLogger(ll, logs.LevelDebug, 0)
+	l.Log(&QueryInfo{SQL: "SELECT 1"})
+	a.Equal(logsBuffer.Len(), 0)
+}
@@ -0,0 +1,333 @@
+// Copyright 2014 by caixw, All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package orm
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// 保存迁移记录的表名，#会被替换成Engine的表名前缀。
+const migrationsTable = "#migrations"
+
+// 迁移记录表的结构。各数据库的建表语法和类型名称并不相同，
+// 比如oracle和sql server不支持CREATE TABLE IF NOT EXISTS，oracle也没有BIGINT，
+// 所以由Dialect根据该结构创建表。
+type migrationTable struct {
+	Version  int64  `orm:"name(version);pk"`
+	Name     string `orm:"name(name);len(255)"`
+	Checksum string `orm:"name(checksum);len(40)"`
+	Applied  int64  `orm:"name(applied)"`
+}
+
+func (m *migrationTable) Meta() string {
+	return "name(" + migrationsTable + ")"
+}
+
+// 表示一次数据库结构的迁移操作。
+//
+// 升级和降级操作可以是SQL语句，也可以是Go函数，两者同时存在时，
+// 先执行SQL语句，再执行函数。每个迁移操作及其迁移记录的写入都在同一个事务中执行，
+// 但mysql和oracle等数据库中的DDL语句会隐式地提交事务，无法被回滚，
+// 若DDL之后的操作失败，数据库结构可能已经改变，却没有相应的迁移记录。
+// 在这些数据库中，每个迁移操作最好只包含一条DDL语句，且放在最后执行。
+// SQL语句中同样可以使用{}和#等占位符：
+//  &orm.Migration{
+//      Version: 201405010001,
+//      Name:    "rename username",
+//      UpSQL:   "ALTER TABLE #user RENAME COLUMN {username} TO {name}",
+//      DownSQL: "ALTER TABLE #user RENAME COLUMN {name} TO {username}",
+//  }
+type Migration struct {
+	Version int64  // 版本号，必须大于0，按从小到大的顺序执行
+	Name    string // 简短的描述信息
+
+	UpSQL   string // 升级时执行的SQL语句
+	DownSQL string // 降级时执行的SQL语句
+
+	Up   func(*Tx) error // 升级时执行的函数
+	Down func(*Tx) error // 降级时执行的函数
+}
+
+// 迁移记录表中的一条记录
+type migrationRecord struct {
+	Version  int64  `orm:"name(version)"`
+	Checksum string `orm:"name(checksum)"`
+}
+
+// 计算迁移内容的校验值。Go函数无法计算校验值，
+// 只有名称和SQL语句会参与计算。
+func (m *Migration) checksum() string {
+	h := sha1.New()
+	h.Write([]byte(m.Name))
+	h.Write([]byte{0})
+	h.Write([]byte(m.UpSQL))
+	h.Write([]byte{0})
+	h.Write([]byte(m.DownSQL))
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// 执行升级或是降级操作。
+func (m *Migration) exec(ctx context.Context, tx *Tx, up bool) error {
+	sql, fn := m.DownSQL, m.Down
+	if up {
+		sql, fn = m.UpSQL, m.Up
+	}
+
+	if len(sql) > 0 {
+		if _, err := tx.ExecContext(ctx, tx.PrepareSQL(sql)); err != nil {
+			return err
+		}
+	}
+
+	if fn != nil {
+		return fn(tx)
+	}
+
+	return nil
+}
+
+// 校验值不匹配时返回的错误。
+type ChecksumError struct {
+	Version          int64
+	Applied, Current string // 已执行的和当前的校验值
+}
+
+func (err *ChecksumError) Error() string {
+	return fmt.Sprintf("版本[%v]的迁移内容在执行之后被修改：[%v]=>[%v]", err.Version, err.Applied, err.Current)
+}
+
+// 添加一个或多个迁移操作。版本号不能重复。
+func (e *Engine) AddMigrations(ms ...*Migration) error {
+	for _, m := range ms {
+		if m.Version <= 0 {
+			return fmt.Errorf("无效的版本号[%v]", m.Version)
+		}
+
+		if len(m.UpSQL) == 0 && m.Up == nil {
+			return fmt.Errorf("版本[%v]未指定升级操作", m.Version)
+		}
+
+		if _, found := e.migration(m.Version); found {
+			return fmt.Errorf("该版本[%v]的迁移操作已经存在", m.Version)
+		}
+
+		e.migrations = append(e.migrations, m)
+	}
+
+	sort.Sort(migrations(e.migrations))
+	return nil
+}
+
+// 查找指定版本的迁移操作
+func (e *Engine) migration(version int64) (*Migration, bool) {
+	for _, m := range e.migrations {
+		if m.Version == version {
+			return m, true
+		}
+	}
+
+	return nil, false
+}
+
+// 将数据库迁移到版本target。
+// 当前版本低于target时，依次执行中间的升级操作；
+// 当前版本高于target时，依次执行中间的降级操作；
+// target小于0时，表示升级到最新的版本。
+func (e *Engine) Migrate(target int64) error {
+	return e.MigrateContext(context.Background(), target)
+}
+
+// 功能同Migrate()，但可以通过ctx取消操作。
+func (e *Engine) MigrateContext(ctx context.Context, target int64) error {
+	applied, err := e.appliedMigrations(ctx)
+	if err != nil {
+		return err
+	}
+
+	if target < 0 && len(e.migrations) > 0 {
+		target = e.migrations[len(e.migrations)-1].Version
+	}
+
+	// 降级，从最高版本开始，直到target为止(不包含target)
+	for i := len(applied) - 1; i >= 0; i-- {
+		if applied[i].Version <= target {
+			break
+		}
+		if err := e.down(ctx, applied[i].Version); err != nil {
+			return err
+		}
+	}
+
+	// 升级所有未执行且不高于target的版本
+	done := make(map[int64]bool, len(applied))
+	for _, r := range applied {
+		done[r.Version] = true
+	}
+	for _, m := range e.migrations {
+		if m.Version > target {
+			break
+		}
+		if done[m.Version] {
+			continue
+		}
+		if err := e.up(ctx, m); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// 回滚最后执行的n个迁移操作。
+func (e *Engine) Rollback(n int) error {
+	return e.RollbackContext(context.Background(), n)
+}
+
+// 功能同Rollback()，但可以通过ctx取消操作。
+func (e *Engine) RollbackContext(ctx context.Context, n int) error {
+	if n <= 0 {
+		return errors.New("Rollback:n必须大于0")
+	}
+
+	applied, err := e.appliedMigrations(ctx)
+	if err != nil {
+		return err
+	}
+
+	for i := len(applied) - 1; i >= 0 && n > 0; i-- {
+		if err := e.down(ctx, applied[i].Version); err != nil {
+			return err
+		}
+		n--
+	}
+
+	return nil
+}
+
+// 迁移记录表不存在时，创建该表。已经存在的表不会被修改。
+func (e *Engine) createMigrationsTable() error {
+	db := e.UsePrimary()
+	has, err := e.Dialect().HasTable(db, e.PrepareSQL(migrationsTable))
+	if err != nil || has {
+		return err
+	}
+	return e.Create(&migrationTable{})
+}
+
+// 返回已经执行的迁移记录，按版本号从小到大排序。
+// 同时会检测已执行的迁移操作是否被修改过。
+func (e *Engine) appliedMigrations(ctx context.Context) ([]*migrationRecord, error) {
+	if err := e.createMigrationsTable(); err != nil {
+		return nil, err
+	}
+
+	// 迁移记录表可能刚刚创建，必须从主库读取。
+	records := []*migrationRecord{}
+	err := e.UsePrimary().SQL().
+		Table(migrationsTable).
+		Columns("{version}", "{checksum}").
+		Asc("{version}").
+		FetchContext(ctx, &records)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, r := range records {
+		m, found := e.migration(r.Version)
+		if !found {
+			continue // 由降级操作报告该错误
+		}
+
+		if sum := m.checksum(); sum != r.Checksum {
+			return nil, &ChecksumError{Version: r.Version, Applied: r.Checksum, Current: sum}
+		}
+	}
+
+	return records, nil
+}
+
+// 执行升级操作，并写入迁移记录。
+func (e *Engine) up(ctx context.Context, m *Migration) error {
+	return e.migrateTx(ctx, func(tx *Tx) error {
+		if err := m.exec(ctx, tx, true); err != nil {
+			return err
+		}
+
+		_, err := tx.SQL().
+			Table(migrationsTable).
+			Add("{version}", m.Version).
+			Add("{name}", m.Name).
+			Add("{checksum}", m.checksum()).
+			Add("{applied}", time.Now().Unix()).
+			InsertContext(ctx)
+		return err
+	})
+}
+
+// 执行指定版本的降级操作，并删除迁移记录。
+func (e *Engine) down(ctx context.Context, version int64) error {
+	m, found := e.migration(version)
+	if !found {
+		return fmt.Errorf("版本[%v]已经执行，但未找到对应的迁移操作", version)
+	}
+
+	if len(m.DownSQL) == 0 && m.Down == nil {
+		return fmt.Errorf("版本[%v]未指定降级操作", version)
+	}
+
+	return e.migrateTx(ctx, func(tx *Tx) error {
+		if err := m.exec(ctx, tx, false); err != nil {
+			return err
+		}
+
+		_, err := tx.SQL().
+			Table(migrationsTable).
+			Where("{version}=?", m.Version).
+			DeleteContext(ctx)
+		return err
+	})
+}
+
+// 在一个事务中执行f，f返回错误时回滚事务。
+func (e *Engine) migrateTx(ctx context.Context, f func(*Tx) error) error {
+	tx, err := e.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	if err = f(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// 实现sort.Interface，按版本号排序。
+type migrations []*Migration
+
+func (ms migrations) Len() int           { return len(ms) }
+func (ms migrations) Less(i, j int) bool { return ms[i].Version < ms[j].Version }
+func (ms migrations) Swap(i, j int)      { ms[i], ms[j] = ms[j], ms[i] }
+
+// 返回当前数据库已经执行的最高版本号，未执行任何迁移操作时返回0。
+func (e *Engine) MigrationVersion() (int64, error) {
+	applied, err := e.appliedMigrations(context.Background())
+	if err != nil {
+		return 0, err
+	}
+
+	if len(applied) == 0 {
+		return 0, nil
+	}
+	return applied[len(applied)-1].Version, nil
+}
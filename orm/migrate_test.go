@@ -0,0 +1,122 @@
+// Copyright 2014 by caixw, All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package orm
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/caixw/lib.go/assert"
+)
+
+const migrateDBFile = "./migrate.db"
+
+func TestMigrationChecksum(t *testing.T) {
+	a := assert.New(t)
+
+	m1 := &Migration{Version: 1, Name: "m", UpSQL: "up", DownSQL: "down"}
+	m2 := &Migration{Version: 2, Name: "m", UpSQL: "up", DownSQL: "down"}
+	a.Equal(m1.checksum(), m2.checksum())
+
+	m2.UpSQL = "up2"
+	a.NotEqual(m1.checksum(), m2.checksum())
+
+	// 内容拼接后相同，但各字段不同
+	m2.Name, m2.UpSQL = "mu", "p"
+	a.NotEqual(m1.checksum(), m2.checksum())
+}
+
+func TestEngineAddMigrations(t *testing.T) {
+	a := assert.New(t)
+	e := &Engine{}
+
+	a.NotError(e.AddMigrations(
+		&Migration{Version: 3, UpSQL: "3"},
+		&Migration{Version: 1, UpSQL: "1"},
+	))
+	a.NotError(e.AddMigrations(&Migration{Version: 2, Up: func(*Tx) error { return nil }}))
+	a.Equal(3, len(e.migrations)).
+		Equal(e.migrations[0].Version, 1).
+		Equal(e.migrations[2].Version, 3)
+
+	a.Error(e.AddMigrations(&Migration{Version: 2, UpSQL: "2"})) // 重复的版本号
+	a.Error(e.AddMigrations(&Migration{Version: 0, UpSQL: "0"})) // 无效的版本号
+	a.Error(e.AddMigrations(&Migration{Version: 4}))             // 没有升级操作
+}
+
+func TestEngineMigrate(t *testing.T) {
+	a := assert.New(t)
+	newDB(a) // 确保sqlite3的dialect已经注册
+
+	e, err := New("sqlite3", migrateDBFile, "migrate", "m_")
+	a.NotError(err).NotNil(e)
+	defer func() {
+		Close("migrate")
+		a.NotError(os.Remove(migrateDBFile))
+	}()
+
+	// 迁移记录表由Dialect创建，已经存在时不会被修改。
+	a.NotError(e.createMigrationsTable())
+	has, err := e.Dialect().HasTable(e, "m_migrations")
+	a.NotError(err).True(has)
+	a.NotError(e.createMigrationsTable())
+
+	a.NotError(e.AddMigrations(
+		&Migration{
+			Version: 1,
+			Name:    "create user",
+			UpSQL:   "CREATE TABLE #user({id} INTEGER NOT NULL PRIMARY KEY, {username} TEXT)",
+			DownSQL: "DROP TABLE #user",
+		},
+		&Migration{
+			Version: 2,
+			Name:    "add email",
+			UpSQL:   "ALTER TABLE #user ADD {email} TEXT",
+			Down: func(tx *Tx) error {
+				return errors.New("无法删除email列")
+			},
+		},
+		&Migration{
+			Version: 3,
+			Name:    "insert admin",
+			Up: func(tx *Tx) error {
+				_, err := tx.SQL().Table("#user").Add("{id}", 1).Add("{username}", "admin").Insert()
+				return err
+			},
+			Down: func(tx *Tx) error {
+				_, err := tx.SQL().Table("#user").Where("{id}=?", 1).Delete()
+				return err
+			},
+		},
+	))
+
+	a.NotError(e.Migrate(2))
+	ver, err := e.MigrationVersion()
+	a.NotError(err).Equal(ver, 2)
+
+	a.NotError(e.Migrate(-1))
+	ver, err = e.MigrationVersion()
+	a.NotError(err).Equal(ver, 3)
+
+	name, err := e.SQL().Table("#user").Columns("{username}").FetchColumn("username")
+	a.NotError(err).Equal(name, "admin")
+
+	a.NotError(e.Rollback(1))
+	ver, err = e.MigrationVersion()
+	a.NotError(err).Equal(ver, 2)
+
+	// 版本2的降级操作返回错误，整个事务回滚，版本号不变。
+	a.Error(e.Rollback(1))
+	ver, err = e.MigrationVersion()
+	a.NotError(err).Equal(ver, 2)
+
+	// 修改已经执行的迁移内容
+	e.migrations[0].UpSQL += " "
+	err = e.Migrate(-1)
+	a.Error(err)
+	_, ok := err.(*ChecksumError)
+	a.True(ok)
+}
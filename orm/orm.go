@@ -17,19 +17,37 @@ type engineMap struct {
 var engines = engineMap{items: make(map[string]*Engine)}
 
 // New 声明一个新的Engine实例。
-func New(driverName, dataSourceName, engineName, prefix string) (*Engine, error) {
-	engines.Lock()
-	defer engines.Unlock()
+// opts用于设置连接池等，可以为空。
+func New(driverName, dataSourceName, engineName, prefix string, opts ...Option) (*Engine, error) {
+	return NewWithReplicas(driverName, dataSourceName, nil, engineName, prefix, opts...)
+}
 
-	if _, found := engines.items[engineName]; found {
+// NewWithReplicas 声明一个带从库的Engine实例。
+//
+// 查询语句，包括SQL.Query()和SQL.Fetch()等，会按权重分配到各个从库上执行；
+// 写操作和事务都在主库上执行。需要读取刚写入的数据时，可以使用Engine.UsePrimary()。
+// 从库会在声明时以及之后定时进行健康检测，检测失败的从库会被暂时忽略，所有从库都不可用时，使用主库。
+// 连接池的设置同时作用于主库和从库。
+func NewWithReplicas(driverName, dataSourceName string, replicas []Replica, engineName, prefix string, opts ...Option) (*Engine, error) {
+	if _, found := Get(engineName); found {
 		return nil, fmt.Errorf("该名称[%v]的Engine已经存在", engineName)
 	}
 
-	e, err := newEngine(driverName, dataSourceName, prefix)
+	// 连接和检测数据库可能比较耗时，不能在锁中进行，
+	// 否则会阻塞其它Engine的Get()和Close()等操作。
+	e, err := newEngine(driverName, dataSourceName, prefix, replicas, opts)
 	if err != nil {
 		return nil, err
 	}
 
+	engines.Lock()
+	defer engines.Unlock()
+
+	// 在声明e的同时，可能已经有同名的Engine被声明。
+	if _, found := engines.items[engineName]; found {
+		e.close()
+		return nil, fmt.Errorf("该名称[%v]的Engine已经存在", engineName)
+	}
 	engines.items[engineName] = e
 
 	return e, nil
@@ -18,9 +18,13 @@ import (
 func TestEngines(t *testing.T) {
 	a := assert.New(t)
 
-	// 注册dialect
-	a.NotError(dialect.Register("sqlite3", &dialect.Sqlite3{}))
-	a.NotError(dialect.Register("mysql", &dialect.Mysql{}))
+	// 注册dialect，其它测试可能已经注册过
+	if !dialect.IsRegisted("sqlite3") {
+		a.NotError(dialect.Register("sqlite3", &dialect.Sqlite3{}))
+	}
+	if !dialect.IsRegisted("mysql") {
+		a.NotError(dialect.Register("mysql", &dialect.Mysql{}))
+	}
 
 	e, err := New("sqlite3", "./test", "main", "main_")
 	a.NotError(err).NotNil(e)
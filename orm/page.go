@@ -0,0 +1,109 @@
+// Copyright 2014 by caixw, All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package orm
+
+import (
+	"bytes"
+	"context"
+	"errors"
+)
+
+// 分页信息，由SQL.FetchPage()返回。
+type PageInfo struct {
+	Page    int   // 当前页码，从1开始
+	Size    int   // 每页的记录数量
+	Total   int64 // 符合条件的记录总数
+	Pages   int   // 总页数
+	HasNext bool  // 是否还有下一页
+}
+
+// 导出第page页的数据到v中，每页size条记录，同时返回分页信息。
+// 记录总数通过与当前语句相同的where和join部分的COUNT(*)语句获取。
+// 必须通过Asc()或Desc()指定排序方式，否则返回错误：
+// 没有ORDER BY时各页记录的顺序是不确定的，sql server也不允许在没有ORDER BY时使用OFFSET。
+//  users := []*User{}
+//  info, err := e.SQL().Table("#user").Columns("*").Asc("{id}").FetchPage(&users, 2, 20)
+func (s *SQL) FetchPage(v interface{}, page, size int) (*PageInfo, error) {
+	return s.FetchPageContext(context.Background(), v, page, size)
+}
+
+// 功能同FetchPage()，但可以通过ctx取消查询。
+func (s *SQL) FetchPageContext(ctx context.Context, v interface{}, page, size int) (*PageInfo, error) {
+	if len(s.orderCols) == 0 {
+		s.errors = append(s.errors, errors.New("FetchPage:需要先通过Asc()或Desc()指定排序方式"))
+	}
+	s.Page(page, size)
+	if s.HasErrors() {
+		return nil, Errors(s.errors)
+	}
+
+	total, err := s.CountContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = s.FetchContext(ctx, v); err != nil {
+		return nil, err
+	}
+
+	pages := int((total + int64(size) - 1) / int64(size))
+	return &PageInfo{
+		Page:    page,
+		Size:    size,
+		Total:   total,
+		Pages:   pages,
+		HasNext: page < pages,
+	}, nil
+}
+
+// keyset分页：只返回排序位置在vals之后的记录。
+//
+// vals为上一页最后一条记录中ORDER BY各列的值，数量和顺序必须与之相同，
+// 所以需要在Asc()和Desc()之后调用。相比于OFFSET，不需要扫描之前的所有记录，
+// 适合数据量较大的表。
+//  // ORDER BY {created} DESC, {id} ASC
+//  // WHERE(({created}<?) OR({created}=? AND {id}>?))
+//  e.SQL().Table("#user").Columns("*").
+//      Desc("{created}").Asc("{id}").
+//      After(last.Created, last.ID).
+//      Limit(20, 0).
+//      Fetch(&users)
+func (s *SQL) After(vals ...interface{}) *SQL {
+	if len(s.orderCols) == 0 {
+		s.errors = append(s.errors, errors.New("After:需要先指定ORDER BY的列"))
+		return s
+	}
+	if len(vals) != len(s.orderCols) {
+		s.errors = append(s.errors, errors.New("After:vals的数量与ORDER BY中列的数量不相同"))
+		return s
+	}
+
+	cond := bytes.NewBufferString("")
+	args := make([]interface{}, 0, len(vals)*(len(vals)+1)/2)
+	for i := range s.orderCols {
+		if i > 0 {
+			cond.WriteString(" OR ")
+		}
+		cond.WriteByte('(')
+
+		// 前i列相等
+		for j := 0; j < i; j++ {
+			cond.WriteString(s.orderCols[j])
+			cond.WriteString("=? AND ")
+			args = append(args, vals[j])
+		}
+
+		cond.WriteString(s.orderCols[i])
+		if s.orderSorts[i] == 0 {
+			cond.WriteString(">?")
+		} else {
+			cond.WriteString("<?")
+		}
+		cond.WriteByte(')')
+		args = append(args, vals[i])
+	}
+
+	return s.build(0, cond.String(), args...)
+}
@@ -0,0 +1,94 @@
+// Copyright 2014 by caixw, All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package orm
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/caixw/lib.go/assert"
+)
+
+func TestSQLFetchPage(t *testing.T) {
+	a := assert.New(t)
+	e := newUtilDB(a, "page")
+	defer closeUtilDB(a, "page")
+
+	users := make([]*utilUser, 0, 25)
+	for i := 1; i <= 25; i++ {
+		users = append(users, &utilUser{ID: int64(i), Name: fmt.Sprintf("u%d", i), Version: int64(i % 2)})
+	}
+	_, err := e.InsertBatch(users, 0)
+	a.NotError(err)
+
+	fetched := []*utilUser{}
+	info, err := e.SQL().Table("#user").Columns("*").Asc("{id}").FetchPage(&fetched, 2, 10)
+	a.NotError(err).
+		Equal(info, &PageInfo{Page: 2, Size: 10, Total: 25, Pages: 3, HasNext: true}).
+		Equal(10, len(fetched)).
+		Equal(fetched[0].ID, 11)
+
+	fetched = fetched[:0]
+	info, err = e.SQL().Table("#user").Columns("*").Where("{version}=?", 1).Asc("{id}").FetchPage(&fetched, 2, 10)
+	a.NotError(err).
+		Equal(info, &PageInfo{Page: 2, Size: 10, Total: 13, Pages: 2, HasNext: false}).
+		Equal(3, len(fetched)).
+		Equal(fetched[0].ID, 21)
+
+	// 无效的页码
+	_, err = e.SQL().Table("#user").Columns("*").Asc("{id}").FetchPage(&fetched, 0, 10)
+	a.Error(err)
+
+	// 未指定排序方式
+	_, err = e.SQL().Table("#user").Columns("*").FetchPage(&fetched, 1, 10)
+	a.Error(err)
+}
+
+func TestSQLAfter(t *testing.T) {
+	a := assert.New(t)
+	db := newDB(a)
+	defer db.close()
+
+	sql := db.SQL().Table("#user").Columns("*").
+		Where("{age}>?", 18).
+		Desc("{created}").
+		Asc("{id}").
+		After(100, 5)
+	a.StringEqual(sql.selectSQL(), "SELECT * FROM prefix_user WHERE([age]>?) AND(([created]<?) OR ([created]=? AND [id]>?)) ORDER BY [created] DESC, [id] ASC", style).
+		Equal(sql.selectArgs(), []interface{}{18, 100, 100, 5})
+
+	// 未指定ORDER BY
+	sql = db.SQL().Table("#user").Columns("*").After(5)
+	a.True(sql.HasErrors())
+
+	// 数量不相同
+	sql = db.SQL().Table("#user").Columns("*").Asc("{id}").After(5, 6)
+	a.True(sql.HasErrors())
+}
+
+func TestSQLAfterFetch(t *testing.T) {
+	a := assert.New(t)
+	e := newUtilDB(a, "keyset")
+	defer closeUtilDB(a, "keyset")
+
+	users := []*utilUser{
+		{ID: 1, Name: "u1", Version: 2},
+		{ID: 2, Name: "u2", Version: 1},
+		{ID: 3, Name: "u3", Version: 2},
+		{ID: 4, Name: "u4", Version: 1},
+	}
+	_, err := e.InsertBatch(users, 0)
+	a.NotError(err)
+
+	// ORDER BY version DESC, id ASC: 1,3,2,4
+	fetched := []*utilUser{}
+	err = e.SQL().Table("#user").Columns("*").
+		Desc("{version}").Asc("{id}").
+		After(2, 3).
+		Fetch(&fetched)
+	a.NotError(err).Equal(2, len(fetched)).
+		Equal(fetched[0].ID, 2).
+		Equal(fetched[1].ID, 4)
+}
@@ -0,0 +1,138 @@
+// Copyright 2014 by caixw, All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package orm
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// New()和NewWithReplicas()的可选参数，用于设置连接池等。
+//  e, err := orm.New("mysql", dsn, "main", "m_",
+//      orm.MaxOpenConns(50),
+//      orm.ConnMaxLifetime(time.Hour),
+//      orm.Ping(5, time.Second))
+type Option func(*options)
+
+type options struct {
+	pool        []func(*sql.DB) // 连接池的设置，同时作用于主库和从库
+	ping        bool            // 是否在声明Engine时检测主库的连接
+	pingRetries int
+	pingBackoff time.Duration
+	pingTimeout time.Duration // 每次检测的超时时间
+}
+
+func newOptions(opts []Option) *options {
+	o := &options{pingTimeout: 5 * time.Second}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// 将连接池的设置应用到db上。
+func (o *options) apply(db *sql.DB) {
+	for _, f := range o.pool {
+		f(db)
+	}
+}
+
+// 最大的连接数量，小于等于0表示不限制。参考sql.DB.SetMaxOpenConns()
+func MaxOpenConns(n int) Option {
+	return func(o *options) {
+		o.pool = append(o.pool, func(db *sql.DB) { db.SetMaxOpenConns(n) })
+	}
+}
+
+// 最大的空闲连接数量，小于等于0表示不保留空闲连接。参考sql.DB.SetMaxIdleConns()
+func MaxIdleConns(n int) Option {
+	return func(o *options) {
+		o.pool = append(o.pool, func(db *sql.DB) { db.SetMaxIdleConns(n) })
+	}
+}
+
+// 连接可被重用的最长时间，小于等于0表示不限制。参考sql.DB.SetConnMaxLifetime()
+func ConnMaxLifetime(d time.Duration) Option {
+	return func(o *options) {
+		o.pool = append(o.pool, func(db *sql.DB) { db.SetConnMaxLifetime(d) })
+	}
+}
+
+// 连接的最长空闲时间，小于等于0表示不限制。参考sql.DB.SetConnMaxIdleTime()
+func ConnMaxIdleTime(d time.Duration) Option {
+	return func(o *options) {
+		o.pool = append(o.pool, func(db *sql.DB) { db.SetConnMaxIdleTime(d) })
+	}
+}
+
+// 在声明Engine时检测主库的连接，检测失败时New()返回错误。
+//
+// 第一次检测失败之后，最多再重试retries次，
+// 第一次重试前等待backoff，之后每次的等待时间都是上一次的2倍。
+// 每一次检测的超时时间可以通过PingTimeout()指定。
+func Ping(retries int, backoff time.Duration) Option {
+	return func(o *options) {
+		o.ping = true
+		o.pingRetries = retries
+		o.pingBackoff = backoff
+	}
+}
+
+// 通过Ping()检测连接时，每一次检测的超时时间，超时即视为检测失败，默认为5秒。
+func PingTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.pingTimeout = timeout
+	}
+}
+
+// 检测db的连接，失败时按o中的设置进行重试，返回最后一次的错误信息。
+func (o *options) pingDB(ctx context.Context, db *sql.DB) error {
+	backoff := o.pingBackoff
+	err := o.pingOnce(ctx, db)
+	for i := 0; err != nil && i < o.pingRetries; i++ {
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+
+		backoff *= 2
+		err = o.pingOnce(ctx, db)
+	}
+	return err
+}
+
+// 在o.pingTimeout时间内检测一次db的连接。
+func (o *options) pingOnce(ctx context.Context, db *sql.DB) error {
+	if o.pingTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, o.pingTimeout)
+		defer cancel()
+	}
+	return db.PingContext(ctx)
+}
+
+// Engine的连接状态，由Engine.Stats()返回。
+type Stats struct {
+	sql.DBStats // 主库的连接池状态
+
+	Replicas []sql.DBStats // 各个从库的连接池状态，顺序与声明时的顺序相同
+	Stmts    int           // 缓存的sql.Stmt数量，包括WithPrefix()返回的各实例中缓存的数量
+}
+
+// 返回当前的连接池状态和缓存的sql.Stmt数量。
+func (e *Engine) Stats() Stats {
+	s := Stats{
+		DBStats: e.db.Stats(),
+		Stmts:   e.stmts.Len() + e.prefixes.len(),
+	}
+
+	if e.replicas != nil {
+		s.Replicas = e.replicas.stats()
+	}
+
+	return s
+}
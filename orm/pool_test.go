@@ -0,0 +1,117 @@
+// Copyright 2014 by caixw, All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package orm
+
+import (
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/caixw/lib.go/assert"
+	"github.com/caixw/lib.go/orm/dialect"
+)
+
+func TestEngineOptions(t *testing.T) {
+	a := assert.New(t)
+	newDB(a) // 确保sqlite3的dialect已经注册
+
+	e, err := NewWithReplicas("sqlite3", "./pool_p.db", []Replica{
+		{DSN: "./pool_r1.db"},
+	}, "pool", "p_",
+		MaxOpenConns(5),
+		MaxIdleConns(2),
+		ConnMaxLifetime(time.Minute),
+		ConnMaxIdleTime(time.Minute),
+		Ping(1, time.Millisecond))
+	a.NotError(err).NotNil(e)
+	defer func() {
+		Close("pool")
+		a.NotError(os.Remove("./pool_p.db"))
+		os.Remove("./pool_r1.db") // 从库的健康检测不一定已经创建了文件
+	}()
+
+	stats := e.Stats()
+	a.Equal(stats.MaxOpenConnections, 5).
+		Equal(stats.Stmts, 0).
+		Equal(len(stats.Replicas), 1).
+		Equal(stats.Replicas[0].MaxOpenConnections, 5)
+
+	_, err = e.SQL().Table("sqlite_master").Columns("*").Stmt(Select, "pool_stmt")
+	a.NotError(err)
+	a.Equal(e.Stats().Stmts, 1)
+
+	// 包括WithPrefix()返回的实例中缓存的sql.Stmt
+	_, err = e.WithPrefix("t1_").SQL().Table("sqlite_master").Columns("*").Stmt(Select, "pool_stmt")
+	a.NotError(err)
+	a.Equal(e.Stats().Stmts, 2)
+}
+
+func TestEnginePing(t *testing.T) {
+	a := assert.New(t)
+
+	if !dialect.IsRegisted("mysql") {
+		a.NotError(dialect.Register("mysql", &dialect.Mysql{}))
+	}
+
+	// 无法连接的地址，在重试之后依然返回错误
+	start := time.Now()
+	e, err := New("mysql", "root:@tcp(127.0.0.1:1)/test", "ping", "p_", Ping(2, 10*time.Millisecond))
+	a.Error(err).Nil(e)
+	a.True(time.Since(start) >= 30*time.Millisecond)
+
+	e, found := Get("ping")
+	a.False(found).Nil(e)
+}
+
+func TestEnginePingTimeout(t *testing.T) {
+	a := assert.New(t)
+
+	if !dialect.IsRegisted("mysql") {
+		a.NotError(dialect.Register("mysql", &dialect.Mysql{}))
+	}
+
+	// 只接受连接，但从不响应的服务
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	a.NotError(err)
+	conns := make(chan net.Conn, 10)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			conns <- conn
+		}
+	}()
+	defer func() {
+		l.Close()
+		for len(conns) > 0 {
+			(<-conns).Close()
+		}
+	}()
+
+	done := make(chan error)
+	go func() {
+		_, err := New("mysql", "root:@tcp("+l.Addr().String()+")/test", "timeout", "p_",
+			Ping(1, time.Millisecond),
+			PingTimeout(200*time.Millisecond))
+		done <- err
+	}()
+
+	// 检测过程中，不会阻塞其它Engine的操作
+	time.Sleep(50 * time.Millisecond)
+	start := time.Now()
+	e, found := Get("timeout")
+	a.False(found).Nil(e)
+	a.True(time.Since(start) < 100*time.Millisecond)
+
+	select {
+	case err := <-done:
+		a.Error(err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Ping()未在超时时间内返回")
+	}
+}
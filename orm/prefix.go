@@ -0,0 +1,266 @@
+// Copyright 2014 by caixw, All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package orm
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+
+	"github.com/caixw/lib.go/orm/core"
+)
+
+// 使用独立表名前缀的数据库操作实例，由Engine.WithPrefix()返回。
+//
+// 与Engine共享数据库连接、从库、Model缓存、日志和查询缓存，
+// 但sql.Stmt缓存是按表名前缀区分的，不会执行其它前缀下缓存的语句。
+// 不能关闭，也不能修改日志、缓存和执行迁移等，这些操作需要在Engine上进行。
+type Prefixed struct {
+	e *Engine
+}
+
+// 各表名前缀对应的sql.Stmt缓存，由Engine及其派生的实例共享。
+type prefixStmts struct {
+	sync.Mutex
+	items map[string]*core.Stmts
+}
+
+// 返回一个表名前缀为prefix的实例，用于多租户等需要在运行时切换表的情况：
+//  tenant := e.WithPrefix("t42_")
+//  tenant.SQL().Table("#user").Columns("*").Fetch(&users) // 读取t42_user表
+//
+// 声明的代价很小，可以在每个请求中调用，不需要也不能被关闭。
+// 相同前缀的实例共用同一个sql.Stmt缓存，这些缓存会在Engine关闭时一起关闭。
+// 若表名没有使用{}引用，prefix也可以是"schema."的形式，用于切换schema。
+func (e *Engine) WithPrefix(prefix string) *Prefixed {
+	inst := *e
+	inst.setPrefix(prefix)
+	inst.stmts = e.prefixes.get(&inst)
+	inst.sql = inst.SQL()
+	return &Prefixed{e: &inst}
+}
+
+// 获取与e的表名前缀对应的sql.Stmt缓存，不存在时声明一个新的。
+func (ps *prefixStmts) get(e *Engine) *core.Stmts {
+	ps.Lock()
+	defer ps.Unlock()
+
+	stmts, found := ps.items[e.prefix]
+	if !found {
+		stmts = core.NewStmts(e)
+		ps.items[e.prefix] = stmts
+	}
+	return stmts
+}
+
+// 所有缓存中的sql.Stmt数量
+func (ps *prefixStmts) len() int {
+	ps.Lock()
+	defer ps.Unlock()
+
+	cnt := 0
+	for _, stmts := range ps.items {
+		cnt += stmts.Len()
+	}
+	return cnt
+}
+
+// 关闭所有的sql.Stmt缓存
+func (ps *prefixStmts) close() {
+	ps.Lock()
+	defer ps.Unlock()
+
+	for _, stmts := range ps.items {
+		stmts.Close()
+	}
+	ps.items = map[string]*core.Stmts{}
+}
+
+// 对orm/core.DB.Name()的实现，返回当前操作的数据库名称。
+func (p *Prefixed) Name() string {
+	return p.e.Name()
+}
+
+// 对orm/core.DB.GetStmts()的实现，返回当前表名前缀对应的sql.Stmt缓存。
+func (p *Prefixed) GetStmts() *core.Stmts {
+	return p.e.GetStmts()
+}
+
+// 对orm/core.DB.GetModels()的实现，与Engine共用同一个Model缓存。
+func (p *Prefixed) GetModels() *core.Models {
+	return p.e.GetModels()
+}
+
+// 对orm/core.DB.PrepareSQL()的实现。替换语句的各种占位符。
+func (p *Prefixed) PrepareSQL(sql string) string {
+	return p.e.PrepareSQL(sql)
+}
+
+// 对orm/core.DB.Dialect()的实现。返回当前数据库对应的Dialect
+func (p *Prefixed) Dialect() core.Dialect {
+	return p.e.Dialect()
+}
+
+// 对orm/core.DB.Exec()的实现。执行一条非查询的SQL语句。
+func (p *Prefixed) Exec(sql string, args ...interface{}) (sql.Result, error) {
+	return p.e.Exec(sql, args...)
+}
+
+// 对orm/core.DB.Query()的实现，执行一条查询语句。
+func (p *Prefixed) Query(sql string, args ...interface{}) (*sql.Rows, error) {
+	return p.e.Query(sql, args...)
+}
+
+// 对orm/core.DB.QueryRow()的实现。
+func (p *Prefixed) QueryRow(sql string, args ...interface{}) *sql.Row {
+	return p.e.QueryRow(sql, args...)
+}
+
+// 对orm/core.DB.Prepare()的实现。
+func (p *Prefixed) Prepare(sql string) (*sql.Stmt, error) {
+	return p.e.Prepare(sql)
+}
+
+// 对orm/core.DB.ExecContext()的实现。
+func (p *Prefixed) ExecContext(ctx context.Context, sql string, args ...interface{}) (sql.Result, error) {
+	return p.e.ExecContext(ctx, sql, args...)
+}
+
+// 对orm/core.DB.QueryContext()的实现。
+func (p *Prefixed) QueryContext(ctx context.Context, sql string, args ...interface{}) (*sql.Rows, error) {
+	return p.e.QueryContext(ctx, sql, args...)
+}
+
+// 对orm/core.DB.QueryRowContext()的实现。
+func (p *Prefixed) QueryRowContext(ctx context.Context, sql string, args ...interface{}) *sql.Row {
+	return p.e.QueryRowContext(ctx, sql, args...)
+}
+
+// 对orm/core.DB.PrepareContext()的实现。
+func (p *Prefixed) PrepareContext(ctx context.Context, sql string) (*sql.Stmt, error) {
+	return p.e.PrepareContext(ctx, sql)
+}
+
+// 返回一个所有操作都在主库上执行的实例，表名前缀保持不变。
+func (p *Prefixed) UsePrimary() *Prefixed {
+	e := p.e.UsePrimary()
+	if e == p.e {
+		return p
+	}
+	return &Prefixed{e: e}
+}
+
+// 开始一个新的事务，事务中的语句使用当前的表名前缀。
+func (p *Prefixed) Begin() (*Tx, error) {
+	return p.e.Begin()
+}
+
+// 功能同Begin()，但可以通过ctx取消事务，以及通过opts指定事务的隔离级别等。
+func (p *Prefixed) BeginTx(ctx context.Context, opts *sql.TxOptions) (*Tx, error) {
+	return p.e.BeginTx(ctx, opts)
+}
+
+// 在事务中执行fn，具体可参考Engine.Transaction()。
+func (p *Prefixed) Transaction(fn func(*Tx) error) error {
+	return p.e.Transaction(fn)
+}
+
+// 功能同Transaction()，但可以通过ctx取消操作，以及通过opts指定事务的隔离级别等。
+func (p *Prefixed) TransactionContext(ctx context.Context, opts *sql.TxOptions, fn func(*Tx) error) error {
+	return p.e.TransactionContext(ctx, opts, fn)
+}
+
+// 查找当前表名前缀下缓存的sql.Stmt，在未找到的情况下，第二个参数返回false
+func (p *Prefixed) Stmt(name string) (*sql.Stmt, bool) {
+	return p.e.Stmt(name)
+}
+
+func (p *Prefixed) SQL() *SQL {
+	return p.e.SQL()
+}
+
+func (p *Prefixed) Where(cond string, args ...interface{}) *SQL {
+	return p.e.Where(cond, args...)
+}
+
+// 插入一个或多个数据，具体可参考Engine.Insert()。
+func (p *Prefixed) Insert(v interface{}) error {
+	return p.e.Insert(v)
+}
+
+// 功能同Insert()，但可以通过ctx取消操作。
+func (p *Prefixed) InsertContext(ctx context.Context, v interface{}) error {
+	return p.e.InsertContext(ctx, v)
+}
+
+// 批量插入数据，具体可参考Engine.InsertBatch()。
+func (p *Prefixed) InsertBatch(v interface{}, batchSize int) ([]int64, error) {
+	return p.e.InsertBatch(v, batchSize)
+}
+
+// 功能同InsertBatch()，但可以通过ctx取消操作。
+func (p *Prefixed) InsertBatchContext(ctx context.Context, v interface{}, batchSize int) ([]int64, error) {
+	return p.e.InsertBatchContext(ctx, v, batchSize)
+}
+
+// 插入或是更新一个或多个数据，具体可参考Engine.Upsert()。
+func (p *Prefixed) Upsert(v interface{}) error {
+	return p.e.Upsert(v)
+}
+
+// 功能同Upsert()，但可以通过ctx取消操作。
+func (p *Prefixed) UpsertContext(ctx context.Context, v interface{}) error {
+	return p.e.UpsertContext(ctx, v)
+}
+
+// 根据v的主键或是唯一索引的值，读取该记录的所有列到v中，具体可参考Engine.Select()。
+func (p *Prefixed) Select(v interface{}) error {
+	return p.e.Select(v)
+}
+
+// 功能同Select()，但可以通过ctx取消操作。
+func (p *Prefixed) SelectContext(ctx context.Context, v interface{}) error {
+	return p.e.SelectContext(ctx, v)
+}
+
+// 更新一个或多个对象，具体可参考Engine.Update()。
+func (p *Prefixed) Update(v interface{}) error {
+	return p.e.Update(v)
+}
+
+// 功能同Update()，但可以通过ctx取消操作。
+func (p *Prefixed) UpdateContext(ctx context.Context, v interface{}) error {
+	return p.e.UpdateContext(ctx, v)
+}
+
+// 删除指定的数据对象，具体可参考Engine.Delete()。
+func (p *Prefixed) Delete(v interface{}) error {
+	return p.e.Delete(v)
+}
+
+// 功能同Delete()，但可以通过ctx取消操作。
+func (p *Prefixed) DeleteContext(ctx context.Context, v interface{}) error {
+	return p.e.DeleteContext(ctx, v)
+}
+
+// 删除指定的数据对象，即使对象存在软删除列，也会从数据库中真正删除。
+func (p *Prefixed) ForceDelete(v interface{}) error {
+	return p.e.ForceDelete(v)
+}
+
+// 功能同ForceDelete()，但可以通过ctx取消操作。
+func (p *Prefixed) ForceDeleteContext(ctx context.Context, v interface{}) error {
+	return p.e.ForceDeleteContext(ctx, v)
+}
+
+// 根据obj创建表
+func (p *Prefixed) Create(obj interface{}) error {
+	return p.e.Create(obj)
+}
+
+// 返回根据obj创建或是更新表时需要执行的DDL语句，但并不实际执行。
+func (p *Prefixed) CreateSQL(obj interface{}) ([]string, error) {
+	return p.e.CreateSQL(obj)
+}
@@ -0,0 +1,284 @@
+// Copyright 2014 by caixw, All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package orm
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"github.com/caixw/lib.go/encoding/tag"
+	"github.com/caixw/lib.go/orm/core"
+)
+
+// 指定在Fetch()时需要一并加载的关联字段，每个字段只会产生一条额外的查询语句。
+//
+// 关联字段需要用orm:"-"标记，以免被当作普通的列处理，
+// 同时可以通过fk(name)指定关联所使用的外键名称：
+// 外键属于当前对象时，为belongs-to关系；
+// 外键属于字段类型时，字段为struct或是struct指针表示has-one关系，
+// 字段为slice表示has-many关系。自引用的表，slice字段为has-many，其它为belongs-to。
+//  type User struct {
+//      ID    int     `orm:"name(id);pk"`
+//      Posts []*Post `orm:"-;fk(fk_user)"` // has-many
+//  }
+//
+//  type Post struct {
+//      ID   int   `orm:"name(id);pk"`
+//      UID  int   `orm:"name(uid);fk(fk_user,User,id)"`
+//      User *User `orm:"-;fk(fk_user)"` // belongs-to
+//  }
+//
+// 未指定外键名称时，两个表之间只能存在一个外键，否则返回错误。
+//
+//  e.SQL().Table("User").Columns("*").Preload("Posts").Fetch(&users)
+func (s *SQL) Preload(fields ...string) *SQL {
+	s.preloads = append(s.preloads, fields...)
+	return s
+}
+
+// 加载v中所有由Preload()指定的关联字段。
+func (s *SQL) preload(ctx context.Context, v interface{}) error {
+	parents, elemType, err := structValues(v)
+	if err != nil {
+		return err
+	}
+	if len(parents) == 0 {
+		return nil
+	}
+
+	pm, err := s.db.GetModels().New(reflect.New(elemType).Interface())
+	if err != nil {
+		return err
+	}
+
+	for _, name := range s.preloads {
+		field, found := elemType.FieldByName(name)
+		if !found {
+			return fmt.Errorf("Preload:[%v]中不存在字段[%v]", elemType, name)
+		}
+
+		targetType := relationType(field.Type)
+		if targetType == nil {
+			return fmt.Errorf("Preload:字段[%v]的类型[%v]不能作为关联字段", name, field.Type)
+		}
+
+		tm, err := s.db.GetModels().New(reflect.New(targetType).Interface())
+		if err != nil {
+			return err
+		}
+
+		if err = s.loadRelation(ctx, parents, field, pm, tm, targetType); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// 加载parents中的关联字段field。
+// pm为parents的Model，tm为关联字段的Model，targetType为关联字段的struct类型。
+func (s *SQL) loadRelation(ctx context.Context, parents []reflect.Value, field reflect.StructField, pm, tm *core.Model, targetType reflect.Type) error {
+	fk, belongsTo, err := s.findFK(field, pm, tm)
+	if err != nil {
+		return err
+	}
+	if len(fk.Cols) != 1 {
+		return fmt.Errorf("Preload:字段[%v]不支持复合外键", field.Name)
+	}
+	col := fk.Cols[0]
+
+	// localField为parents中用于关联的字段名；
+	// remoteField和remoteCol为关联对象中对应的字段名和列名。
+	var localField, remoteField, remoteCol string
+	if belongsTo {
+		refCol, found := tm.Cols[fk.RefColNames[0]]
+		if !found {
+			return fmt.Errorf("Preload:[%v]中不存在外键[%v]引用的列[%v]", tm.Name, col.Name, fk.RefColNames[0])
+		}
+		localField, remoteField, remoteCol = col.GoName, refCol.GoName, refCol.Name
+	} else { // has-one, has-many
+		refCol, found := pm.Cols[fk.RefColNames[0]]
+		if !found {
+			return fmt.Errorf("Preload:[%v]中不存在外键[%v]引用的列[%v]", pm.Name, col.Name, fk.RefColNames[0])
+		}
+		localField, remoteField, remoteCol = refCol.GoName, col.GoName, col.Name
+	}
+
+	// 收集所有不重复的关联值
+	keys := make([]interface{}, 0, len(parents))
+	exists := make(map[string]bool, len(parents))
+	for _, p := range parents {
+		val := p.FieldByName(localField).Interface()
+		key := fmt.Sprint(val)
+		if !exists[key] {
+			exists[key] = true
+			keys = append(keys, val)
+		}
+	}
+
+	// IN中的值按数据库允许的占位符数量分批查询
+	size := s.db.Dialect().MaxPlaceholders()
+	items := reflect.MakeSlice(reflect.SliceOf(reflect.PtrTo(targetType)), 0, len(keys))
+	for start := 0; start < len(keys); start += size {
+		end := start + size
+		if end > len(keys) {
+			end = len(keys)
+		}
+
+		batch := reflect.New(items.Type())
+		err := newSQL(s.db).
+			Table(tm.Name).
+			Columns("*").
+			In("{"+remoteCol+"}", keys[start:end]...).
+			FetchContext(ctx, batch.Interface())
+		if err != nil {
+			return err
+		}
+		items = reflect.AppendSlice(items, batch.Elem())
+	}
+
+	// 按关联值分组
+	groups := make(map[string][]reflect.Value, len(keys))
+	for i := 0; i < items.Len(); i++ {
+		item := items.Index(i)
+		key := fmt.Sprint(item.Elem().FieldByName(remoteField).Interface())
+		groups[key] = append(groups[key], item)
+	}
+
+	for _, p := range parents {
+		key := fmt.Sprint(p.FieldByName(localField).Interface())
+		setRelation(p.FieldByIndex(field.Index), groups[key])
+	}
+
+	return nil
+}
+
+// 查找关联字段field所使用的外键，belongsTo表示外键是否属于pm。
+//
+// field指定了fk(name)时，按名称查找；否则在pm和tm之间查找唯一的外键。
+func (s *SQL) findFK(field reflect.StructField, pm, tm *core.Model) (fk *core.ForeignKey, belongsTo bool, err error) {
+	isSlice := field.Type.Kind() == reflect.Slice
+
+	if names, found := tag.Parse(field.Tag.Get("orm"))["fk"]; found {
+		if len(names) != 1 {
+			return nil, false, fmt.Errorf("Preload:字段[%v]的fk属性只能指定外键名称", field.Name)
+		}
+
+		// 自引用的表，pm与tm相同，由字段类型决定关系的方向。
+		if fk, found := pm.FK[names[0]]; found && s.refers(fk, tm) && (!isSlice || pm != tm) {
+			return fk, true, nil
+		}
+		if fk, found := tm.FK[names[0]]; found && s.refers(fk, pm) {
+			return fk, false, nil
+		}
+		return nil, false, fmt.Errorf("Preload:字段[%v]指定的外键[%v]不存在于[%v]与[%v]之间", field.Name, names[0], pm.Name, tm.Name)
+	}
+
+	var belongs, has []*core.ForeignKey
+	for _, fk := range pm.FK {
+		if s.refers(fk, tm) {
+			belongs = append(belongs, fk)
+		}
+	}
+	if pm != tm { // 自引用时，两者是同一组外键
+		for _, fk := range tm.FK {
+			if s.refers(fk, pm) {
+				has = append(has, fk)
+			}
+		}
+	}
+
+	switch {
+	case len(belongs)+len(has) == 0:
+		return nil, false, fmt.Errorf("Preload:[%v]与[%v]之间不存在外键关系", pm.Name, tm.Name)
+	case len(belongs)+len(has) > 1:
+		return nil, false, fmt.Errorf("Preload:[%v]与[%v]之间存在多个外键，需要通过fk(name)指定字段[%v]使用的外键", pm.Name, tm.Name, field.Name)
+	case len(belongs) == 1:
+		return belongs[0], pm != tm || !isSlice, nil
+	default:
+		return has[0], false, nil
+	}
+}
+
+// fk是否引用了m对应的表
+func (s *SQL) refers(fk *core.ForeignKey, m *core.Model) bool {
+	return fk.RefTableName == m.Name || s.db.PrepareSQL(fk.RefTableName) == s.db.PrepareSQL(m.Name)
+}
+
+// 将items中的值写入到关联字段field中，items中的元素都为struct指针。
+func setRelation(field reflect.Value, items []reflect.Value) {
+	switch field.Kind() {
+	case reflect.Slice:
+		ptr := field.Type().Elem().Kind() == reflect.Ptr
+		slice := reflect.MakeSlice(field.Type(), 0, len(items))
+		for _, item := range items {
+			if !ptr {
+				item = item.Elem()
+			}
+			slice = reflect.Append(slice, item)
+		}
+		field.Set(slice)
+	case reflect.Ptr:
+		if len(items) > 0 {
+			field.Set(items[0])
+		}
+	case reflect.Struct:
+		if len(items) > 0 {
+			field.Set(items[0].Elem())
+		}
+	}
+}
+
+// 获取关联字段对应的struct类型，不能作为关联字段的类型返回nil。
+// 可以是struct，struct指针或是它们的slice。
+func relationType(t reflect.Type) reflect.Type {
+	if t.Kind() == reflect.Slice {
+		t = t.Elem()
+	}
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	if t.Kind() != reflect.Struct {
+		return nil
+	}
+	return t
+}
+
+// 获取v中所有的struct元素，以及struct的类型。
+// v可以是orm/fetch.Obj()中允许的所有类型。
+func structValues(v interface{}) ([]reflect.Value, reflect.Type, error) {
+	rval := reflect.ValueOf(v)
+	if rval.Kind() == reflect.Ptr {
+		rval = rval.Elem()
+	}
+
+	switch rval.Kind() {
+	case reflect.Struct:
+		return []reflect.Value{rval}, rval.Type(), nil
+	case reflect.Slice, reflect.Array:
+		elemType := rval.Type().Elem()
+		ptr := elemType.Kind() == reflect.Ptr
+		if ptr {
+			elemType = elemType.Elem()
+		}
+
+		vals := make([]reflect.Value, 0, rval.Len())
+		for i := 0; i < rval.Len(); i++ {
+			item := rval.Index(i)
+			if ptr {
+				if item.IsNil() {
+					continue
+				}
+				item = item.Elem()
+			}
+			vals = append(vals, item)
+		}
+		return vals, elemType, nil
+	default:
+		return nil, nil, fmt.Errorf("Preload:不支持的类型[%v]", rval.Kind())
+	}
+}
@@ -0,0 +1,169 @@
+// Copyright 2014 by caixw, All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package orm
+
+import (
+	"os"
+	"testing"
+
+	"github.com/caixw/lib.go/assert"
+)
+
+const preloadDBFile = "./preload.db"
+
+type preloadUser struct {
+	ID      int64           `orm:"name(id);pk"`
+	Name    string          `orm:"name(name)"`
+	Posts   []*preloadPost  `orm:"-;fk(fk_post_user)"` // has-many
+	Profile *preloadProfile `orm:"-"`                  // has-one
+}
+
+func (u *preloadUser) Meta() string {
+	return "name(#user)"
+}
+
+type preloadProfile struct {
+	UID int64  `orm:"name(uid);pk;fk(fk_profile_user,#user,id)"`
+	Bio string `orm:"name(bio)"`
+}
+
+func (p *preloadProfile) Meta() string {
+	return "name(#profile)"
+}
+
+type preloadPost struct {
+	ID    int64       `orm:"name(id);pk"`
+	UID   int64       `orm:"name(uid);fk(fk_post_user,#user,id)"`
+	Title string      `orm:"name(title)"`
+	User  preloadUser `orm:"-"` // belongs-to
+}
+
+func (p *preloadPost) Meta() string {
+	return "name(#post)"
+}
+
+func newPreloadDB(a *assert.Assertion) *Engine {
+	newDB(a) // 确保sqlite3的dialect已经注册
+
+	e, err := New("sqlite3", preloadDBFile, "preload", "p_")
+	a.NotError(err).NotNil(e)
+
+	sqls := []string{
+		"CREATE TABLE #user({id} INTEGER PRIMARY KEY, {name} TEXT)",
+		"CREATE TABLE #profile({uid} INTEGER PRIMARY KEY, {bio} TEXT)",
+		"CREATE TABLE #post({id} INTEGER PRIMARY KEY, {uid} INTEGER, {title} TEXT)",
+		"INSERT INTO #user VALUES(1,'u1'),(2,'u2'),(3,'u3')",
+		"INSERT INTO #profile VALUES(1,'bio1'),(3,'bio3')",
+		"INSERT INTO #post VALUES(1,1,'p1'),(2,1,'p2'),(3,2,'p3')",
+	}
+	for _, sql := range sqls {
+		_, err := e.Exec(e.PrepareSQL(sql))
+		a.NotError(err)
+	}
+
+	return e
+}
+
+func TestSQLPreload(t *testing.T) {
+	a := assert.New(t)
+	e := newPreloadDB(a)
+	defer func() {
+		Close("preload")
+		a.NotError(os.Remove(preloadDBFile))
+	}()
+
+	// has-many, has-one
+	users := []*preloadUser{}
+	err := e.SQL().
+		Table("#user").
+		Columns("*").
+		Asc("{id}").
+		Preload("Posts", "Profile").
+		Fetch(&users)
+	a.NotError(err).Equal(3, len(users))
+
+	a.Equal(2, len(users[0].Posts)).
+		Equal(users[0].Posts[0].Title, "p1").
+		Equal(users[0].Posts[1].Title, "p2").
+		Equal(users[0].Profile.Bio, "bio1")
+	a.Equal(1, len(users[1].Posts)).
+		Equal(users[1].Posts[0].Title, "p3").
+		Nil(users[1].Profile)
+	a.Equal(0, len(users[2].Posts)).
+		Equal(users[2].Profile.Bio, "bio3")
+
+	// belongs-to
+	posts := []*preloadPost{}
+	err = e.SQL().
+		Table("#post").
+		Columns("*").
+		Asc("{id}").
+		Preload("User").
+		Fetch(&posts)
+	a.NotError(err).Equal(3, len(posts))
+	a.Equal(posts[0].User.Name, "u1").
+		Equal(posts[1].User.Name, "u1").
+		Equal(posts[2].User.Name, "u2")
+
+	// 不存在的字段
+	err = e.SQL().Table("#post").Columns("*").Preload("Users").Fetch(&posts)
+	a.Error(err)
+
+	// 不存在关联关系的字段
+	err = e.SQL().Table("#post").Columns("*").Preload("Title").Fetch(&posts)
+	a.Error(err)
+}
+
+type preloadNode struct {
+	ID       int64          `orm:"name(id);pk"`
+	PID      int64          `orm:"name(pid);fk(fk_node_parent,#node,id)"`
+	Parent   *preloadNode   `orm:"-"` // belongs-to
+	Children []*preloadNode `orm:"-;fk(fk_node_parent)"`
+}
+
+func (n *preloadNode) Meta() string {
+	return "name(#node)"
+}
+
+// 自引用的表以及超过占位符数量的IN查询
+func TestSQLPreloadSelf(t *testing.T) {
+	a := assert.New(t)
+	e := newPreloadDB(a)
+	defer func() {
+		Close("preload")
+		a.NotError(os.Remove(preloadDBFile))
+	}()
+
+	_, err := e.Exec(e.PrepareSQL("CREATE TABLE #node({id} INTEGER PRIMARY KEY, {pid} INTEGER)"))
+	a.NotError(err)
+
+	// 超过sqlite3的999个占位符
+	const count = 1200
+	nodes := make([]*preloadNode, 0, count)
+	for i := int64(1); i <= count; i++ {
+		nodes = append(nodes, &preloadNode{ID: i, PID: i / 2})
+	}
+	_, err = e.InsertBatch(nodes, 0)
+	a.NotError(err)
+
+	nodes = nodes[:0]
+	err = e.SQL().
+		Table("#node").
+		Columns("*").
+		Asc("{id}").
+		Preload("Parent", "Children").
+		Fetch(&nodes)
+	a.NotError(err).Equal(count, len(nodes))
+
+	a.Nil(nodes[0].Parent).
+		Equal(2, len(nodes[0].Children)).
+		Equal(nodes[0].Children[0].ID, 2).
+		Equal(nodes[0].Children[1].ID, 3)
+	a.Equal(nodes[count-1].Parent.ID, count/2).
+		Equal(0, len(nodes[count-1].Children))
+	a.Equal(nodes[599].Parent.ID, 300).
+		Equal(1, len(nodes[599].Children)).
+		Equal(nodes[599].Children[0].ID, 1200)
+}
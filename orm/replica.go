@@ -0,0 +1,206 @@
+// Copyright 2014 by caixw, All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package orm
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+	"time"
+)
+
+// 从库的健康检测间隔，检测失败的从库在下次检测成功之前不会再被使用。
+var ReplicaCheckInterval = 30 * time.Second
+
+// 单个从库每次健康检测的超时时间，超时即视为检测失败。
+var ReplicaCheckTimeout = 5 * time.Second
+
+// 从库的连接信息，供NewWithReplicas()使用。
+type Replica struct {
+	DSN string
+
+	// 权重，值越大被选中的机会越多，小于等于0时当作1处理。
+	// 所有从库的权重都相同时，相当于轮询。
+	Weight int
+}
+
+type replica struct {
+	db      *sql.DB
+	weight  int
+	current int  // 平滑加权轮询中的当前权重
+	down    bool // 是否未通过健康检测
+}
+
+// 从库的集合，负责选择查询语句使用的从库以及从库的健康检测。
+type replicaSet struct {
+	sync.Mutex
+	items []*replica
+	stop  chan struct{}
+}
+
+func newReplicaSet(driverName string, replicas []Replica, o *options) (*replicaSet, error) {
+	rs := &replicaSet{
+		items: make([]*replica, 0, len(replicas)),
+		stop:  make(chan struct{}),
+	}
+
+	for _, r := range replicas {
+		db, err := sql.Open(driverName, r.DSN)
+		if err != nil {
+			rs.close()
+			return nil, err
+		}
+		o.apply(db)
+
+		weight := r.Weight
+		if weight <= 0 {
+			weight = 1
+		}
+		rs.items = append(rs.items, &replica{db: db, weight: weight})
+	}
+
+	// 第一次检测同步进行，以免在检测完成之前，查询被分配到不可用的从库。
+	rs.check(context.Background())
+	go rs.checkLoop()
+
+	return rs, nil
+}
+
+// 以平滑加权轮询的方式选择一个可用的从库，
+// 所有从库都不可用时返回nil。
+func (rs *replicaSet) next() *sql.DB {
+	rs.Lock()
+	defer rs.Unlock()
+
+	var best *replica
+	total := 0
+	for _, r := range rs.items {
+		if r.down {
+			continue
+		}
+
+		r.current += r.weight
+		total += r.weight
+		if best == nil || r.current > best.current {
+			best = r
+		}
+	}
+
+	if best == nil {
+		return nil
+	}
+	best.current -= total
+	return best.db
+}
+
+// 检测所有从库的状态，返回可用的从库数量。
+func (rs *replicaSet) check(ctx context.Context) int {
+	rs.Lock()
+	items := make([]*replica, len(rs.items))
+	copy(items, rs.items)
+	rs.Unlock()
+
+	// Ping()可能会比较耗时，不能在锁中进行，各从库同时检测。
+	downs := make([]bool, len(items))
+	wg := sync.WaitGroup{}
+	for i, r := range items {
+		wg.Add(1)
+		go func(i int, db *sql.DB) {
+			defer wg.Done()
+			c, cancel := context.WithTimeout(ctx, ReplicaCheckTimeout)
+			defer cancel()
+			downs[i] = db.PingContext(c) != nil
+		}(i, r.db)
+	}
+	wg.Wait()
+
+	rs.Lock()
+	defer rs.Unlock()
+
+	cnt := 0
+	for i, r := range items {
+		r.down = downs[i]
+		if !r.down {
+			cnt++
+		}
+	}
+	return cnt
+}
+
+// 返回所有从库的连接池状态。
+func (rs *replicaSet) stats() []sql.DBStats {
+	rs.Lock()
+	defer rs.Unlock()
+
+	stats := make([]sql.DBStats, 0, len(rs.items))
+	for _, r := range rs.items {
+		stats = append(stats, r.db.Stats())
+	}
+	return stats
+}
+
+// 定时检测从库的状态，直到调用close()。
+func (rs *replicaSet) checkLoop() {
+	ticker := time.NewTicker(ReplicaCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			rs.check(context.Background())
+		case <-rs.stop:
+			return
+		}
+	}
+}
+
+// 关闭所有从库的连接，并停止健康检测。
+func (rs *replicaSet) close() {
+	close(rs.stop)
+
+	rs.Lock()
+	defer rs.Unlock()
+	for _, r := range rs.items {
+		r.db.Close()
+	}
+}
+
+// 返回执行查询语句的sql.DB，优先使用从库，
+// 没有可用的从库或是调用了UsePrimary()时，返回主库。
+func (e *Engine) reader() *sql.DB {
+	if e.replicas == nil || e.primaryOnly {
+		return e.db
+	}
+
+	if db := e.replicas.next(); db != nil {
+		return db
+	}
+	return e.db
+}
+
+// 返回一个所有操作都在主库上执行的Engine，
+// 用于需要读取刚写入的数据的情况，以免从库同步的延迟。
+// 返回的实例与e共享数据库连接，不需要也不能被关闭。
+//  e.Insert(u)
+//  e.UsePrimary().SQL().Table("#user").Where("{id}=?", u.ID).Fetch(u)
+func (e *Engine) UsePrimary() *Engine {
+	if e.replicas == nil || e.primaryOnly {
+		return e
+	}
+
+	inst := *e
+	inst.primaryOnly = true
+	inst.sql = inst.SQL()
+	return &inst
+}
+
+// 立即检测所有从库的状态，返回可用的从库数量。
+// 除了定时的自动检测之外，也可以通过此方法手动检测。
+func (e *Engine) CheckReplicas(ctx context.Context) int {
+	if e.replicas == nil {
+		return 0
+	}
+	return e.replicas.check(ctx)
+}
@@ -0,0 +1,123 @@
+// Copyright 2014 by caixw, All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package orm
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/caixw/lib.go/assert"
+)
+
+// 创建一个包含#user表的sqlite3数据库，name同时作为表中唯一一条记录的name值。
+func newReplicaDB(a *assert.Assertion, name string) {
+	db, err := sql.Open("sqlite3", "./"+name+".db")
+	a.NotError(err).NotNil(db)
+	defer db.Close()
+
+	_, err = db.Exec("CREATE TABLE r_user(id INTEGER PRIMARY KEY, name TEXT, version INTEGER NOT NULL DEFAULT 0)")
+	a.NotError(err)
+	_, err = db.Exec("INSERT INTO r_user(id, name) VALUES(1, ?)", name)
+	a.NotError(err)
+}
+
+func TestNewWithReplicas(t *testing.T) {
+	a := assert.New(t)
+	newDB(a) // 确保sqlite3的dialect已经注册
+
+	names := []string{"replica_p", "replica_r1", "replica_r2"}
+	for _, name := range names {
+		newReplicaDB(a, name)
+	}
+	defer func() {
+		for _, name := range names {
+			a.NotError(os.Remove("./" + name + ".db"))
+		}
+	}()
+
+	e, err := NewWithReplicas("sqlite3", "./replica_p.db", []Replica{
+		{DSN: "./replica_r1.db", Weight: 2},
+		{DSN: "./replica_r2.db", Weight: 1},
+	}, "replica", "r_")
+	a.NotError(err).NotNil(e)
+	defer Close("replica")
+
+	a.Equal(e.CheckReplicas(context.Background()), 2)
+
+	// 按权重分配到各个从库
+	fetchName := func(e *Engine) interface{} {
+		name, err := e.SQL().Table("#user").Columns("{name}").FetchColumn("name")
+		a.NotError(err)
+		return name
+	}
+	a.Equal(fetchName(e), "replica_r1")
+	a.Equal(fetchName(e), "replica_r2")
+	a.Equal(fetchName(e), "replica_r1")
+
+	// 写操作在主库上执行
+	a.NotError(e.Update(&utilUser{ID: 1, Name: "primary"}))
+	a.Equal(fetchName(e.UsePrimary()), "primary")
+	a.Equal(fetchName(e), "replica_r1")
+
+	// 事务在主库上执行
+	tx, err := e.Begin()
+	a.NotError(err)
+	name, err := tx.SQL().Table("#user").Columns("{name}").FetchColumn("name")
+	a.NotError(err).Equal(name, "primary")
+	a.NotError(tx.Commit())
+
+	// 迁移记录只存在于主库，从主库读取
+	a.NotError(e.AddMigrations(&Migration{Version: 1, UpSQL: "UPDATE #user SET {version}={version}+1"}))
+	a.NotError(e.Migrate(-1))
+	ver, err := e.MigrationVersion()
+	a.NotError(err).Equal(ver, 1)
+	a.NotError(e.Migrate(-1)) // 不会重复执行
+	ver, err = e.MigrationVersion()
+	a.NotError(err).Equal(ver, 1)
+
+	// 只缓存主库上的查询
+	c := NewLRUCache(10)
+	e.SetCache(c)
+	fetchCached := func(e *Engine) interface{} {
+		name, err := e.SQL().Table("#user").Columns("{name}").Cache(time.Minute).FetchColumn("name")
+		a.NotError(err)
+		return name
+	}
+	a.NotEqual(fetchCached(e), "primary")
+	a.Equal(c.(*lruCache).list.Len(), 0)
+	a.Equal(fetchCached(e.UsePrimary()), "primary")
+	a.Equal(c.(*lruCache).list.Len(), 1)
+}
+
+func TestReplicasHealthCheck(t *testing.T) {
+	a := assert.New(t)
+	newDB(a) // 确保sqlite3的dialect已经注册
+
+	newReplicaDB(a, "health_r1")
+	defer func() {
+		a.NotError(os.Remove("./health_r1.db"))
+	}()
+
+	e, err := NewWithReplicas("sqlite3", "./health_r1.db", []Replica{
+		{DSN: "./health_r1.db"},
+		{DSN: "./not-exists/health_r2.db"},
+	}, "health", "r_")
+	a.NotError(err).NotNil(e)
+	defer Close("health")
+
+	// 第一次检测在返回之前完成
+	a.False(e.replicas.items[0].down).
+		True(e.replicas.items[1].down)
+
+	// 无法连接的从库被忽略
+	a.Equal(e.CheckReplicas(context.Background()), 1)
+	for i := 0; i < 3; i++ {
+		name, err := e.SQL().Table("#user").Columns("{name}").FetchColumn("name")
+		a.NotError(err).Equal(name, "health_r1")
+	}
+}
@@ -6,11 +6,13 @@ package orm
 
 import (
 	"bytes"
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
 	"reflect"
 	"strings"
+	"time"
 
 	"github.com/caixw/lib.go/orm/core"
 	"github.com/caixw/lib.go/orm/fetch"
@@ -30,6 +32,7 @@ const (
 type SQL struct {
 	db        core.DB
 	tableName string
+	model     *core.Model   // 当前语句对应的Model，用于获取软删除列
 	errors    []error       // 所有的错误缓存
 	buf       *bytes.Buffer // 语句缓存
 
@@ -41,11 +44,27 @@ type SQL struct {
 	cols []string
 	vals []interface{}
 
+	// insert ... on conflict
+	conflictCols []string
+	updateCols   []string
+	doUpdate     bool
+
 	// select
-	join      *bytes.Buffer
-	order     *bytes.Buffer
-	limitSQL  string
-	limitArgs []interface{}
+	distinct   bool
+	join       *bytes.Buffer
+	groupBy    *bytes.Buffer
+	having     *bytes.Buffer
+	havingArgs []interface{}
+	order      *bytes.Buffer
+	orderCols  []string // ORDER BY中的列，供keyset分页使用
+	orderSorts []int    // 与orderCols对应的排序方式
+	limitSQL   string
+	limitArgs  []interface{}
+	preloads   []string // 需要预加载的关联字段
+	joinTables []string // JOIN中的表名，供缓存使用
+
+	withDeleted bool          // 是否包含已经被软删除的数据
+	cacheTTL    time.Duration // 查询结果的缓存时长，为0表示不缓存
 }
 
 // 新建一个SQL实例。
@@ -64,8 +83,11 @@ func newSQL(db core.DB) *SQL {
 		vals: []interface{}{},
 
 		// select
-		join:  bytes.NewBuffer([]byte{}),
-		order: bytes.NewBuffer([]byte{}),
+		join:       bytes.NewBuffer([]byte{}),
+		groupBy:    bytes.NewBuffer([]byte{}),
+		having:     bytes.NewBuffer([]byte{}),
+		havingArgs: []interface{}{},
+		order:      bytes.NewBuffer([]byte{}),
 		// limitArgs: []interface{}{}, // 无需初始化，直接从dialect赋值得到
 	}
 }
@@ -74,6 +96,7 @@ func newSQL(db core.DB) *SQL {
 // 其它属性都将被重围为初始状态。
 func (s *SQL) Reset() *SQL {
 	s.tableName = ""
+	s.model = nil
 	s.errors = s.errors[:0]
 	s.buf.Reset()
 
@@ -85,10 +108,25 @@ func (s *SQL) Reset() *SQL {
 	s.cols = s.cols[:0]
 	s.vals = s.vals[:0]
 
+	// insert ... on conflict
+	s.conflictCols = s.conflictCols[:0]
+	s.updateCols = s.updateCols[:0]
+	s.doUpdate = false
+
 	// select
+	s.distinct = false
 	s.join.Reset()
+	s.groupBy.Reset()
+	s.having.Reset()
+	s.havingArgs = s.havingArgs[:0]
 	s.order.Reset()
+	s.orderCols = s.orderCols[:0]
+	s.orderSorts = s.orderSorts[:0]
 	s.limitArgs = s.limitArgs[:0]
+	s.preloads = s.preloads[:0]
+	s.joinTables = s.joinTables[:0]
+	s.withDeleted = false
+	s.cacheTTL = 0
 
 	return s
 }
@@ -175,17 +213,51 @@ func (s *SQL) OrIsNotNull(col string) *SQL {
 
 // SQL.AndIsNotNull()的别名
 func (s *SQL) IsNotNull(col string) *SQL {
-	return s.AndIsNull(col)
+	return s.AndIsNotNull(col)
+}
+
+// WHERE ... AND (...)
+// 由fn构建一组条件，该组条件作为一个整体，以AND与之前的条件相连。
+//  sql.Where("{age}>?", 18).AndGroup(func(g *SQL) {
+//      g.Where("{name}=?", "abc").Or("{email}=?", "abc")
+//  })
+//  // WHERE({age}>?) AND(({name}=?) OR({email}=?))
+func (s *SQL) AndGroup(fn func(*SQL)) *SQL {
+	return s.group(0, fn)
+}
+
+// WHERE ... OR (...)
+// 由fn构建一组条件，该组条件作为一个整体，以OR与之前的条件相连。
+func (s *SQL) OrGroup(fn func(*SQL)) *SQL {
+	return s.group(1, fn)
+}
+
+// 供AndGroup()和OrGroup()调用。
+func (s *SQL) group(op int, fn func(*SQL)) *SQL {
+	g := newSQL(s.db)
+	fn(g)
+
+	s.errors = append(s.errors, g.errors...)
+	if g.cond.Len() == 0 {
+		return s
+	}
+
+	// g.cond的内容为：" WHERE(a) AND(b)"
+	return s.build(op, strings.TrimPrefix(g.cond.String(), " WHERE"), g.condArgs...)
 }
 
 // 所有SQL子句的构建，最终都调用此方法来写入实例中。
 // op 与前一个语句的连接符号，可以是and或是or常量；
 // cond 条件语句，值只能是占位符，不能直接写值；
-// condArgs 占位符对应的值。
+// condArgs 占位符对应的值，若值为*SQL，则作为子查询替换对应的占位符，
+// 子查询的参数也会合并到当前语句的参数中。
 //  w := newSQL(...)
 //  w.build(0, "username=='abc'") // 错误：不能使用abc，只能使用？占位符。
 //  w.build(1, "username=?", "abc") // 正确，将转换成: and username='abc'
+//  w.build(0, "EXISTS(?)", sub) // 正确，将转换成: and EXISTS(SELECT ...)
 func (s *SQL) build(op int, cond string, args ...interface{}) *SQL {
+	cond, args = s.subquery(cond, args)
+
 	switch {
 	case s.cond.Len() == 0:
 		s.cond.WriteString(" WHERE(")
@@ -205,20 +277,70 @@ func (s *SQL) build(op int, cond string, args ...interface{}) *SQL {
 	return s
 }
 
+// 将args中类型为*SQL的值作为子查询，替换cond中对应位置的占位符，
+// 返回替换之后的cond，以及合并了子查询参数之后的args。
+func (s *SQL) subquery(cond string, args []interface{}) (string, []interface{}) {
+	hasSub := false
+	for _, arg := range args {
+		if _, ok := arg.(*SQL); ok {
+			hasSub = true
+			break
+		}
+	}
+	if !hasSub {
+		return cond, args
+	}
+
+	buf := bytes.NewBuffer(make([]byte, 0, len(cond)))
+	vals := make([]interface{}, 0, len(args))
+	index := 0 // 当前占位符对应的args下标
+	for i := 0; i < len(cond); i++ {
+		if cond[i] != '?' || index >= len(args) {
+			buf.WriteByte(cond[i])
+			continue
+		}
+
+		sub, ok := args[index].(*SQL)
+		index++
+		if !ok {
+			buf.WriteByte('?')
+			vals = append(vals, args[index-1])
+			continue
+		}
+
+		s.errors = append(s.errors, sub.errors...)
+		buf.WriteString(sub.buildSelectSQL())
+		vals = append(vals, sub.selectArgs()...)
+	}
+
+	if index < len(args) { // 参数数量多于占位符的数量，原样保留。
+		vals = append(vals, args[index:]...)
+	}
+
+	return buf.String(), vals
+}
+
 // SQL col in(v1,v2)语句的实现函数，供andIn()和orIn()函数调用。
+// 若args只有一个元素，且为*SQL类型，则产生col IN(SELECT ...)的子查询语句。
 func (s *SQL) in(op int, col string, args ...interface{}) *SQL {
 	if len(args) <= 0 {
 		s.errors = append(s.errors, errors.New("in:args参数不能为空"))
 		return s
 	}
 
+	if len(args) == 1 {
+		if _, ok := args[0].(*SQL); ok {
+			return s.build(op, col+" IN(?)", args...)
+		}
+	}
+
 	cond := bytes.NewBufferString(col)
 	cond.WriteString(" IN(")
-	cond.WriteString(strings.Repeat("?,", len(s.condArgs)))
+	cond.WriteString(strings.Repeat("?,", len(args)))
 	cond.Truncate(cond.Len() - 1) // 去掉最后的逗号
 	cond.WriteByte(')')
 
-	return s.build(op, cond.String(), s.condArgs...)
+	return s.build(op, cond.String(), args...)
 }
 
 // 供andBetween()和orBetween()调用。
@@ -242,6 +364,27 @@ func (s *SQL) Table(name string) *SQL {
 	return s
 }
 
+// 指定当前语句对应的Model，v为对象或是对象指针。
+// 若还没有指定表名，则同时将表名设置为该Model的表名。
+//
+// select语句会根据该Model的软删除列过滤已经被删除的数据。
+// Fetch()和Iterate()在未指定Model时，会以其参数的类型作为Model；
+// 其它的查询方法需要通过此方法指定，才会过滤已删除的数据。
+//  e.SQL().Model(&User{}).Columns("*").Fetch2Maps()
+func (s *SQL) Model(v interface{}) *SQL {
+	m, err := s.db.GetModels().New(v)
+	if err != nil {
+		s.errors = append(s.errors, err)
+		return s
+	}
+
+	s.model = m
+	if len(s.tableName) == 0 {
+		s.tableName = m.Name
+	}
+	return s
+}
+
 // 指定列名。
 // update/insert 语句可以用此方法指定需要更新的列。
 // 若需要指定数据，请使用Data()或是Add()方法；
@@ -272,6 +415,34 @@ func (s *SQL) Add(col string, val interface{}) *SQL {
 	return s
 }
 
+// INSERT ... ON CONFLICT(cols...)
+// 指定insert语句发生冲突时的判断列，一般为主键或是唯一索引的列。
+// 若之后未调用DoUpdate()，则发生冲突时不做任何操作。
+func (s *SQL) OnConflict(cols ...string) *SQL {
+	if len(cols) == 0 {
+		s.errors = append(s.errors, errors.New("OnConflict:cols参数不能为空"))
+		return s
+	}
+
+	if len(s.db.Dialect().OnConflictSQL(cols, nil)) == 0 {
+		s.errors = append(s.errors, errors.New("OnConflict:当前数据库不支持该操作"))
+		return s
+	}
+
+	s.conflictCols = append(s.conflictCols, cols...)
+	return s
+}
+
+// INSERT ... ON CONFLICT(...) DO UPDATE SET ...
+// 指定insert语句发生冲突时需要更新的列，更新的值为insert语句中对应的值。
+// 若未指定cols，则更新除冲突判断列之外的所有列；
+// 若通过Model()指定了Model，其版本号列和软删除列也不会被更新。
+func (s *SQL) DoUpdate(cols ...string) *SQL {
+	s.doUpdate = true
+	s.updateCols = append(s.updateCols, cols...)
+	return s
+}
+
 var joinType = []string{" LEFT JOIN ", " RIGHT JOIN ", " INNER JOIN ", " FULL JOIN "}
 
 // join功能
@@ -284,6 +455,7 @@ func (s *SQL) joinOn(typ int, table string, on string) *SQL {
 	s.join.WriteString(table)
 	s.join.WriteString(" ON ")
 	s.join.WriteString(on)
+	s.joinTables = append(s.joinTables, table)
 
 	return s
 }
@@ -308,17 +480,58 @@ func (s *SQL) FullJoin(table, on string) *SQL {
 	return s.joinOn(3, table, on)
 }
 
-var orderType = []string{"ASC ", "DESC "}
+// SELECT DISTINCT ...
+func (s *SQL) Distinct() *SQL {
+	s.distinct = true
+	return s
+}
+
+// GROUP BY ...
+// 多次调用时，所有的列会依次添加到GROUP BY中。
+func (s *SQL) GroupBy(cols ...string) *SQL {
+	for _, col := range cols {
+		if s.groupBy.Len() == 0 {
+			s.groupBy.WriteString(" GROUP BY ")
+		} else {
+			s.groupBy.WriteByte(',')
+		}
+		s.groupBy.WriteString(col)
+	}
+
+	return s
+}
+
+// HAVING ...
+// 多次调用时，各条件之间以AND相连。
+// args中的*SQL同样会被当作子查询处理。
+func (s *SQL) Having(cond string, args ...interface{}) *SQL {
+	cond, args = s.subquery(cond, args)
+
+	if s.having.Len() == 0 {
+		s.having.WriteString(" HAVING(")
+	} else {
+		s.having.WriteString(" AND(")
+	}
+	s.having.WriteString(cond)
+	s.having.WriteByte(')')
+
+	s.havingArgs = append(s.havingArgs, args...)
+
+	return s
+}
+
+var orderType = []string{" ASC", " DESC"}
 
 // 供Asc()和Desc()使用。
 // sort: 0=asc,1=desc，其它值无效
 func (s *SQL) orderBy(sort int, col string) *SQL {
-	if sort != 1 && sort != 2 {
+	if sort != 0 && sort != 1 {
 		s.errors = append(s.errors, fmt.Errorf("orderBy:错误的sort参数:[%v]", sort))
+		return s
 	}
 
 	if s.order.Len() == 0 {
-		s.order.WriteString("ORDER BY ")
+		s.order.WriteString(" ORDER BY ")
 	} else {
 		s.order.WriteString(", ")
 	}
@@ -326,6 +539,9 @@ func (s *SQL) orderBy(sort int, col string) *SQL {
 	s.order.WriteString(col)
 	s.order.WriteString(orderType[sort])
 
+	s.orderCols = append(s.orderCols, col)
+	s.orderSorts = append(s.orderSorts, sort)
+
 	return s
 }
 
@@ -367,120 +583,254 @@ func (s *SQL) Page(start, size int) *SQL {
 	return s.Limit(size, start*size)
 }
 
+// select语句默认不会返回已经被软删除的数据（需要通过Model()或是Fetch()的参数确定Model），
+// 调用此方法之后，将返回包括已被软删除的所有数据。
+func (s *SQL) WithDeleted() *SQL {
+	s.withDeleted = true
+	return s
+}
+
+// 未指定Model时，以v中对象的类型作为Model，以便selectSQL()能获取到软删除列。
+// v可以是orm/fetch.Obj()中允许的所有类型，不是struct相关的类型时，不作任何处理。
+func (s *SQL) bindModel(v interface{}) error {
+	if s.model != nil {
+		return nil
+	}
+
+	t := objType(v)
+	if t == nil {
+		return nil
+	}
+
+	m, err := s.db.GetModels().New(reflect.New(t).Interface())
+	if err != nil {
+		return err
+	}
+	s.model = m
+	return nil
+}
+
+// 产生select语句的where部分。
+// 若当前Model存在软删除列，会在原有条件之外，加上过滤已删除数据的条件。
+func (s *SQL) selectCond() string {
+	if s.withDeleted || s.model == nil || s.model.SoftDelete == nil {
+		return s.cond.String()
+	}
+
+	cond := tableAlias(s.tableName) + ".{" + s.model.SoftDelete.Name + "}=0"
+	if s.cond.Len() == 0 {
+		return " WHERE(" + cond + ")"
+	}
+
+	// 原有条件可能包含OR，需要整体加上括号：
+	// WHERE(a) OR(b) ==> WHERE((a) OR(b)) AND(deleted=0)
+	return " WHERE(" + strings.TrimPrefix(s.cond.String(), " WHERE") + ") AND(" + cond + ")"
+}
+
+// 返回表名在语句中的引用名称，有别名时返回别名。
+//  {#user} AS u ==> u
+//  {#user} ==> {#user}
+func tableAlias(table string) string {
+	fields := strings.Fields(table)
+	if len(fields) == 0 {
+		return table
+	}
+	return fields[len(fields)-1]
+}
+
 // 产生SELECT语句
 func (s *SQL) selectSQL() string {
+	return s.db.PrepareSQL(s.buildSelectSQL())
+}
+
+// 产生未经过PrepareSQL()处理的SELECT语句，
+// 作为子查询时，由外层语句统一处理。
+func (s *SQL) buildSelectSQL() string {
 	s.buf.Reset()
 
+	s.writeSelect()
+	s.buf.WriteString(s.order.String()) // NOTE(caixw):mysql中若要limit，order字段是必须提供的
+	s.buf.WriteString(s.limitSQL)
+
+	return s.buf.String()
+}
+
+// 将SELECT语句中除ORDER BY和LIMIT之外的部分写入s.buf。
+func (s *SQL) writeSelect() {
+	s.writeSelectCols(s.distinct, strings.Join(s.cols, ","))
+}
+
+// 功能同writeSelect()，但由参数指定是否DISTINCT以及需要获取的列。
+func (s *SQL) writeSelectCols(distinct bool, cols string) {
 	s.buf.WriteString("SELECT ")
-	s.buf.WriteString(strings.Join(s.cols, ","))
+	if distinct {
+		s.buf.WriteString("DISTINCT ")
+	}
+	s.buf.WriteString(cols)
 	s.buf.WriteString(" FROM ")
 	s.buf.WriteString(s.tableName)
 	s.buf.WriteString(s.join.String())
-	s.buf.WriteString(s.cond.String())  // where
-	s.buf.WriteString(s.order.String()) // NOTE(caixw):mysql中若要limit，order字段是必须提供的
-	s.buf.WriteString(s.limitSQL)
+	s.buf.WriteString(s.selectCond()) // where
+	s.buf.WriteString(s.groupBy.String())
+	s.buf.WriteString(s.having.String())
+}
 
-	return s.db.PrepareSQL(s.buf.String())
+// 返回select语句中所有占位符对应的值，
+// 与selectSQL中添加的顺序相同：where，having，limit。
+func (s *SQL) selectArgs() []interface{} {
+	args := make([]interface{}, 0, len(s.condArgs)+len(s.havingArgs)+len(s.limitArgs))
+	args = append(args, s.condArgs...)
+	args = append(args, s.havingArgs...)
+	return append(args, s.limitArgs...)
 }
 
 // 功能同database/sql.DB.Query(...)
 func (s *SQL) Query(args ...interface{}) (*sql.Rows, error) {
+	return s.QueryContext(context.Background(), args...)
+}
+
+// 功能同database/sql.DB.QueryContext(...)
+func (s *SQL) QueryContext(ctx context.Context, args ...interface{}) (*sql.Rows, error) {
 	if s.HasErrors() {
 		return nil, Errors(s.errors)
 	}
 
 	if len(args) == 0 {
-		// 与selectSQL中添加的顺序相同，where在limit之前
-		args = append(s.condArgs, s.limitArgs)
+		args = s.selectArgs()
 	}
 
-	return s.db.Query(s.selectSQL(), args...)
+	return s.db.QueryContext(ctx, s.selectSQL(), args...)
 }
 
 // 功能同data/sql.DB.QueryRow(...)
 func (s *SQL) QueryRow(args ...interface{}) *sql.Row {
+	return s.QueryRowContext(context.Background(), args...)
+}
+
+// 功能同data/sql.DB.QueryRowContext(...)
+func (s *SQL) QueryRowContext(ctx context.Context, args ...interface{}) *sql.Row {
 	if s.HasErrors() {
 		panic("构建语句时发生错误信息")
 	}
 
 	if len(args) == 0 {
-		// 与sqlString中添加的顺序相同，where在limit之前
-		args = append(s.condArgs, s.limitArgs)
+		args = s.selectArgs()
 	}
 
-	return s.db.QueryRow(s.selectSQL(), args...)
+	return s.db.QueryRowContext(ctx, s.selectSQL(), args...)
 }
 
 // 导出数据到map[string]interface{}
 func (s *SQL) Fetch2Map(args ...interface{}) (map[string]interface{}, error) {
-	rows, err := s.Query(args...)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
+	return s.Fetch2MapContext(context.Background(), args...)
+}
+
+// 功能同Fetch2Map()，但可以通过ctx取消查询。
+func (s *SQL) Fetch2MapContext(ctx context.Context, args ...interface{}) (map[string]interface{}, error) {
+	val, err := s.cached("map", args, func() (interface{}, error) {
+		rows, err := s.QueryContext(ctx, args...)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
 
-	data, err := fetch.Map(true, rows)
+		data, err := fetch.Map(true, rows)
+		if err != nil {
+			return nil, err
+		}
+
+		return data[0], nil
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	return data[0], nil
+	return val.(map[string]interface{}), nil
 }
 
 // 导出所有数据到[]map[string]interface{}
 func (s *SQL) Fetch2Maps(args ...interface{}) ([]map[string]interface{}, error) {
-	rows, err := s.Query(args...)
+	return s.Fetch2MapsContext(context.Background(), args...)
+}
+
+// 功能同Fetch2Maps()，但可以通过ctx取消查询。
+func (s *SQL) Fetch2MapsContext(ctx context.Context, args ...interface{}) ([]map[string]interface{}, error) {
+	val, err := s.cached("maps", args, func() (interface{}, error) {
+		rows, err := s.QueryContext(ctx, args...)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+
+		return fetch.Map(false, rows)
+	})
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
 
-	return fetch.Map(false, rows)
+	return val.([]map[string]interface{}), nil
 }
 
 // 返回指定列的第一行内容
 func (s *SQL) FetchColumn(col string, args ...interface{}) (interface{}, error) {
-	rows, err := s.Query(args...)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
+	return s.FetchColumnContext(context.Background(), col, args...)
+}
 
-	data, err := fetch.Column(true, col, rows)
-	if err != nil {
-		return nil, err
-	}
+// 功能同FetchColumn()，但可以通过ctx取消查询。
+func (s *SQL) FetchColumnContext(ctx context.Context, col string, args ...interface{}) (interface{}, error) {
+	return s.cached("column:"+col, args, func() (interface{}, error) {
+		rows, err := s.QueryContext(ctx, args...)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
 
-	return data[0], nil
+		data, err := fetch.Column(true, col, rows)
+		if err != nil {
+			return nil, err
+		}
+
+		return data[0], nil
+	})
 }
 
 // 返回指定列的所有数据
 func (s *SQL) FetchColumns(col string, args ...interface{}) ([]interface{}, error) {
-	rows, err := s.Query(args...)
+	return s.FetchColumnsContext(context.Background(), col, args...)
+}
+
+// 功能同FetchColumns()，但可以通过ctx取消查询。
+func (s *SQL) FetchColumnsContext(ctx context.Context, col string, args ...interface{}) ([]interface{}, error) {
+	val, err := s.cached("columns:"+col, args, func() (interface{}, error) {
+		rows, err := s.QueryContext(ctx, args...)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+
+		return fetch.Column(false, col, rows)
+	})
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
 
-	return fetch.Column(false, col, rows)
+	return val.([]interface{}), nil
 }
 
 // 将当前select语句查询的数据导出到v中
 // v可以是map[string]interface{}，或是orm/fetch.Obj中允许的类型。
 func (s *SQL) Fetch(v interface{}, args ...interface{}) error {
-	rows, err := s.Query(args...)
-	if err != nil {
-		return err
-	}
-	defer rows.Close()
+	return s.FetchContext(context.Background(), v, args...)
+}
 
+// 功能同Fetch()，但可以通过ctx取消查询。
+func (s *SQL) FetchContext(ctx context.Context, v interface{}, args ...interface{}) error {
 	vv := reflect.ValueOf(v)
 	if vv.Kind() == reflect.Ptr {
 		vv = vv.Elem()
 	}
 
-	switch vv.Kind() {
-	case reflect.Map:
+	if vv.Kind() == reflect.Map {
 		if vv.Type().Key().Kind() != reflect.String {
 			return errors.New("map的键名类型只能为string")
 		}
@@ -488,20 +838,100 @@ func (s *SQL) Fetch(v interface{}, args ...interface{}) error {
 			return errors.New("map的键值类型只能为interface{}")
 		}
 
-		mapped, err := s.Fetch2Map(args...)
+		mapped, err := s.Fetch2MapContext(ctx, args...)
 		if err != nil {
 			return err
 		}
 		vv.Set(reflect.ValueOf(mapped))
-	default:
-		return fetch.Obj(v, rows)
+		return nil
+	}
+
+	if err := s.bindModel(v); err != nil {
+		return err
+	}
+
+	// 只缓存struct指针和slice指针，命中时v的内容会被整个替换成缓存的结果。
+	var c Cache
+	var key string
+	if reflect.TypeOf(v).Kind() == reflect.Ptr && (vv.Kind() == reflect.Struct || vv.Kind() == reflect.Slice) {
+		c, key = s.cacheKey("obj:"+typeName(vv.Type())+":"+strings.Join(s.preloads, ","), args)
+	}
+	if c == nil {
+		_, err := s.fetchObj(ctx, v, args)
+		return err
+	}
+
+	val, found := c.Get(key)
+	if !found {
+		// 导出到新声明的值中，只缓存查询的结果，v中原有的内容不会被缓存。
+		ptr := reflect.New(vv.Type())
+		ok, err := s.fetchObj(ctx, ptr.Interface(), args)
+		if err != nil {
+			return err
+		}
+
+		val = reflect.Value{} // 没有符合条件的记录时，缓存一个无效的值。
+		if ok {
+			val = ptr.Elem()
+		}
+		c.Set(key, val, s.cacheTTL, s.cacheTables())
+	}
+
+	if rv := val.(reflect.Value); rv.IsValid() {
+		vv.Set(copyValue(rv))
 	}
 	return nil
 }
 
+// 将查询结果导出到v中。v为struct指针时，ok表示是否存在符合条件的记录，
+// 其它类型ok始终为true。
+func (s *SQL) fetchObj(ctx context.Context, v interface{}, args []interface{}) (ok bool, err error) {
+	rows, err := s.QueryContext(ctx, args...)
+	if err != nil {
+		return false, err
+	}
+
+	ok = true
+	if rv := reflect.ValueOf(v); rv.Kind() == reflect.Ptr && rv.Elem().Kind() == reflect.Struct {
+		ok, err = fetchOne(v, rows)
+	} else {
+		err = fetch.Obj(v, rows)
+	}
+	rows.Close()
+	if err != nil {
+		return false, err
+	}
+
+	if len(s.preloads) > 0 {
+		if err = s.preload(ctx, v); err != nil {
+			return false, err
+		}
+	}
+
+	return ok, afterFetch(s.db, v)
+}
+
+// 导出rows中的第一条记录到struct指针v中，没有记录时，found返回false。
+func fetchOne(v interface{}, rows *sql.Rows) (found bool, err error) {
+	cols, err := rows.Columns()
+	if err != nil {
+		return false, err
+	}
+
+	if !rows.Next() {
+		return false, rows.Err()
+	}
+	return true, fetch.RowColumns(v, cols, rows)
+}
+
 // 将当前语句预编译并缓存到stmts中，方便之后再次使用。
 // action用于指定语句的类型，可以是Insert, Delete, Update或是Select。
 func (s *SQL) Stmt(action int, name string) (*sql.Stmt, error) {
+	return s.StmtContext(context.Background(), action, name)
+}
+
+// 功能同Stmt()，但预编译过程可以通过ctx取消。
+func (s *SQL) StmtContext(ctx context.Context, action int, name string) (*sql.Stmt, error) {
 	var sql string
 	switch action {
 	case Delete:
@@ -516,19 +946,24 @@ func (s *SQL) Stmt(action int, name string) (*sql.Stmt, error) {
 		return nil, fmt.Errorf("无效的的action值[%v]", action)
 	}
 
-	return s.db.GetStmts().AddSQL(name, sql)
+	return s.db.GetStmts().AddSQLContext(ctx, name, sql)
 }
 
 // 执行当前语句。
 // action指定语句类型，可以是Delete,Insert或Update，但不能是Select
 func (s *SQL) Exec(action int, args ...interface{}) (sql.Result, error) {
+	return s.ExecContext(context.Background(), action, args...)
+}
+
+// 功能同Exec()，但可以通过ctx取消执行。
+func (s *SQL) ExecContext(ctx context.Context, action int, args ...interface{}) (sql.Result, error) {
 	switch action {
 	case Delete:
-		return s.Delete(args...)
+		return s.DeleteContext(ctx, args...)
 	case Update:
-		return s.Update(args...)
+		return s.UpdateContext(ctx, args...)
 	case Insert:
-		return s.Insert(args...)
+		return s.InsertContext(ctx, args...)
 	case Select:
 		return nil, errors.New("select语句不能使用Exec()方法执行")
 	default:
@@ -551,6 +986,11 @@ func (s *SQL) deleteSQL() string {
 // 执行DELETE操作。
 // 相当于s.Exec(Delete, args...)
 func (s *SQL) Delete(args ...interface{}) (sql.Result, error) {
+	return s.DeleteContext(context.Background(), args...)
+}
+
+// 功能同Delete()，但可以通过ctx取消执行。
+func (s *SQL) DeleteContext(ctx context.Context, args ...interface{}) (sql.Result, error) {
 	if s.HasErrors() {
 		return nil, Errors(s.errors)
 	}
@@ -559,7 +999,13 @@ func (s *SQL) Delete(args ...interface{}) (sql.Result, error) {
 		args = s.condArgs
 	}
 
-	return s.db.Exec(s.deleteSQL(), args...)
+	r, err := s.db.ExecContext(ctx, s.deleteSQL(), args...)
+	if err != nil {
+		return nil, err
+	}
+
+	invalidateCache(s.db, s.tableName)
+	return r, nil
 }
 
 // 产生update语句
@@ -583,15 +1029,26 @@ func (s *SQL) updateSQL() string {
 // 执行UPDATE操作。
 // 相当于s.Exec(Update, args...)
 func (s *SQL) Update(args ...interface{}) (sql.Result, error) {
+	return s.UpdateContext(context.Background(), args...)
+}
+
+// 功能同Update()，但可以通过ctx取消执行。
+func (s *SQL) UpdateContext(ctx context.Context, args ...interface{}) (sql.Result, error) {
 	if s.HasErrors() {
 		return nil, Errors(s.errors)
 	}
 
 	if len(args) == 0 {
-		args = append(s.vals, s.condArgs)
+		args = append(s.vals, s.condArgs...)
+	}
+
+	r, err := s.db.ExecContext(ctx, s.updateSQL(), args...)
+	if err != nil {
+		return nil, err
 	}
 
-	return s.db.Exec(s.updateSQL(), args...)
+	invalidateCache(s.db, s.tableName)
+	return r, nil
 }
 
 // 产生insert语句
@@ -609,12 +1066,57 @@ func (s *SQL) insertSQL() string {
 	s.buf.WriteString(placeholder[0 : len(placeholder)-1])
 	s.buf.WriteByte(')')
 
+	if len(s.conflictCols) > 0 {
+		s.buf.WriteString(s.db.Dialect().OnConflictSQL(s.conflictCols, s.conflictUpdateCols()))
+	}
+
 	return s.db.PrepareSQL(s.buf.String())
 }
 
+// 返回发生冲突时需要更新的列
+func (s *SQL) conflictUpdateCols() []string {
+	if !s.doUpdate || len(s.updateCols) > 0 {
+		return s.updateCols
+	}
+
+	// 版本号和软删除列不能被覆盖，否则会绕过乐观锁，或是恢复已经被删除的数据。
+	skips := make([]string, 0, 2)
+	if s.model != nil {
+		if s.model.Version != nil {
+			skips = append(skips, s.model.Version.Name)
+		}
+		if s.model.SoftDelete != nil {
+			skips = append(skips, s.model.SoftDelete.Name)
+		}
+	}
+
+	cols := make([]string, 0, len(s.cols))
+LOOP:
+	for _, col := range s.cols {
+		for _, c := range s.conflictCols {
+			if c == col {
+				continue LOOP
+			}
+		}
+		for _, name := range skips {
+			if strings.Trim(col, "{}") == name {
+				continue LOOP
+			}
+		}
+		cols = append(cols, col)
+	}
+
+	return cols
+}
+
 // 执行INSERT操作。
 // 相当于s.Exec(Insert, args...)
 func (s *SQL) Insert(args ...interface{}) (sql.Result, error) {
+	return s.InsertContext(context.Background(), args...)
+}
+
+// 功能同Insert()，但可以通过ctx取消执行。
+func (s *SQL) InsertContext(ctx context.Context, args ...interface{}) (sql.Result, error) {
 	if s.HasErrors() {
 		return nil, Errors(s.errors)
 	}
@@ -623,5 +1125,11 @@ func (s *SQL) Insert(args ...interface{}) (sql.Result, error) {
 		args = s.vals
 	}
 
-	return s.db.Exec(s.insertSQL(), args...)
+	r, err := s.db.ExecContext(ctx, s.insertSQL(), args...)
+	if err != nil {
+		return nil, err
+	}
+
+	invalidateCache(s.db, s.tableName)
+	return r, nil
 }
@@ -5,6 +5,7 @@
 package orm
 
 import (
+	"context"
 	"testing"
 
 	"github.com/caixw/lib.go/assert"
@@ -69,6 +70,39 @@ func TestInsert(t *testing.T) {
 		Add("password", "password")
 
 	a.StringEqual(sql.insertSQL(), "INSERT INTO prefix_user(email,[group],password) VALUES(?,?,?)", style)
+
+	// ON CONFLICT ... DO NOTHING
+	sql.OnConflict("email")
+	a.StringEqual(sql.insertSQL(), "INSERT INTO prefix_user(email,[group],password) VALUES(?,?,?) ON CONFLICT(email) DO NOTHING", style)
+
+	// 未指定更新列，更新除冲突列之外的所有列。
+	sql.DoUpdate()
+	a.StringEqual(sql.insertSQL(), "INSERT INTO prefix_user(email,[group],password) VALUES(?,?,?) ON CONFLICT(email) DO UPDATE SET [group]=EXCLUDED.[group],password=EXCLUDED.password", style)
+
+	sql.Reset().
+		Table("#user").
+		Add("email", "admin@example.com").
+		Add("password", "password").
+		OnConflict("email").
+		DoUpdate("password")
+	a.StringEqual(sql.insertSQL(), "INSERT INTO prefix_user(email,password) VALUES(?,?) ON CONFLICT(email) DO UPDATE SET password=EXCLUDED.password", style)
+	// 不更新版本号和软删除列
+	sql.Reset().
+		Model(&utilUser{}).
+		Add("{id}", 1).
+		Add("{name}", "n").
+		Add("{version}", 0).
+		OnConflict("{id}").
+		DoUpdate()
+	a.StringEqual(sql.insertSQL(), "INSERT INTO prefix_user([id],[name],[version]) VALUES(?,?,?) ON CONFLICT([id]) DO UPDATE SET [name]=EXCLUDED.[name]", style)
+
+	sql.Reset().
+		Model(&sqlSoftUser{}).
+		Add("{id}", 1).
+		Add("{deleted}", 0).
+		OnConflict("{id}").
+		DoUpdate()
+	a.StringEqual(sql.insertSQL(), "INSERT INTO prefix_soft([id],[deleted]) VALUES(?,?) ON CONFLICT([id]) DO NOTHING", style)
 }
 
 func TestSelect(t *testing.T) {
@@ -78,4 +112,120 @@ func TestSelect(t *testing.T) {
 
 	sql := db.SQL()
 	sql.Table("#user")
+
+	sql.Columns("{gid}", "COUNT(*) AS cnt").
+		Distinct().
+		Where("{age}>?", 18).
+		GroupBy("{gid}").
+		Having("COUNT(*)>?", 5).
+		Having("MAX({age})<?", 60).
+		Desc("cnt").
+		Limit(10, 0)
+	a.StringEqual(sql.selectSQL(), "SELECT DISTINCT [gid],COUNT(*) AS cnt FROM prefix_user WHERE([age]>?) GROUP BY [gid] HAVING(COUNT(*)>?) AND(MAX([age])<?) ORDER BY cnt DESC LIMIT ? OFFSET ?", style).
+		Equal(sql.selectArgs(), []interface{}{18, 5, 60, 10, 0})
+}
+
+func TestQueryContext(t *testing.T) {
+	a := assert.New(t)
+	newDB(a) // 确保sqlite3的dialect已经注册
+
+	db, err := New("sqlite3", "./test.db", "context", "prefix_")
+	a.NotError(err).NotNil(db)
+	defer Close("context")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	rows, err := db.SQL().
+		Table("sqlite_master").
+		Columns("*").
+		QueryContext(ctx)
+	a.Equal(err, context.Canceled).Nil(rows)
+
+	_, err = db.SQL().
+		Table("#user").
+		Add("email", "admin@example.com").
+		InsertContext(ctx)
+	a.Equal(err, context.Canceled)
+}
+
+type sqlSoftUser struct {
+	ID      int64 `orm:"name(id);pk"`
+	Deleted int64 `orm:"name(deleted);softdelete"`
+}
+
+func (u *sqlSoftUser) Meta() string {
+	return "name(#soft)"
+}
+
+func TestSelectSoftDelete(t *testing.T) {
+	a := assert.New(t)
+	db := newDB(a)
+
+	sql := db.SQL().Model(&sqlSoftUser{}).Columns("*")
+	a.False(sql.HasErrors())
+	a.StringEqual(sql.selectSQL(), "SELECT * FROM prefix_soft WHERE(prefix_soft.[deleted]=0)", style)
+
+	sql.Where("id=?", 1).Or("id=?", 2)
+	a.StringEqual(sql.selectSQL(), "SELECT * FROM prefix_soft WHERE((id=?) OR(id=?)) AND(prefix_soft.[deleted]=0)", style)
+
+	sql.WithDeleted()
+	a.StringEqual(sql.selectSQL(), "SELECT * FROM prefix_soft WHERE(id=?) OR(id=?)", style)
+
+	// 带别名的表名
+	sql = db.SQL().Table("{#soft} AS s").Model(&sqlSoftUser{}).Columns("*")
+	a.StringEqual(sql.selectSQL(), "SELECT * FROM [prefix_soft] AS s WHERE(s.[deleted]=0)", style)
+
+	// 未指定Model
+	sql = db.SQL().Table("#soft").Columns("*")
+	a.StringEqual(sql.selectSQL(), "SELECT * FROM prefix_soft", style)
+
+	// Reset()会清除Model
+	sql = db.SQL().Model(&sqlSoftUser{}).Columns("*")
+	sql.Reset().Table("#soft").Columns("*")
+	a.StringEqual(sql.selectSQL(), "SELECT * FROM prefix_soft", style)
+}
+
+func TestSubquery(t *testing.T) {
+	a := assert.New(t)
+	db := newDB(a)
+	defer db.close()
+
+	sub := db.SQL().Table("#group").Columns("{id}").Where("{name}=?", "admin")
+
+	// In()
+	sql := db.SQL().Table("#user").Columns("*").Where("{age}>?", 18).In("{gid}", sub)
+	a.StringEqual(sql.selectSQL(), "SELECT * FROM prefix_user WHERE([age]>?) AND([gid] IN(SELECT [id] FROM prefix_group WHERE([name]=?)))", style).
+		Equal(sql.condArgs, []interface{}{18, "admin"})
+
+	// EXISTS，子查询前后都有参数
+	sql = db.SQL().Table("#user").Columns("*").Where("{age}>? AND EXISTS(?) AND {gid}<>?", 18, sub, 5)
+	a.StringEqual(sql.selectSQL(), "SELECT * FROM prefix_user WHERE([age]>? AND EXISTS(SELECT [id] FROM prefix_group WHERE([name]=?)) AND [gid]<>?)", style).
+		Equal(sql.condArgs, []interface{}{18, "admin", 5})
+
+	// 子查询中的错误会合并到外层语句
+	sub = db.SQL().Table("#group").Columns("{id}").In("{id}")
+	sql = db.SQL().Table("#user").Columns("*").In("{gid}", sub)
+	a.True(sql.HasErrors())
+}
+
+func TestGroup(t *testing.T) {
+	a := assert.New(t)
+	db := newDB(a)
+	defer db.close()
+
+	sql := db.SQL().Table("#user").Columns("*").
+		Where("{age}>?", 18).
+		AndGroup(func(g *SQL) {
+			g.Where("{name}=?", "abc").Or("{email}=?", "abc")
+		}).
+		OrGroup(func(g *SQL) {
+			g.IsNull("{name}").AndIn("{id}", 1, 2)
+		})
+	a.StringEqual(sql.selectSQL(), "SELECT * FROM prefix_user WHERE([age]>?) AND(([name]=?) OR([email]=?)) OR(([name] IS NULL) AND([id] IN(?,?)))", style).
+		Equal(sql.condArgs, []interface{}{18, "abc", "abc", 1, 2})
+
+	// 空的条件组
+	sql = db.SQL().Table("#user").Columns("*").AndGroup(func(*SQL) {})
+	a.StringEqual(sql.selectSQL(), "SELECT * FROM prefix_user", style)
 }
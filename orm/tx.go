@@ -5,7 +5,9 @@
 package orm
 
 import (
+	"context"
 	"database/sql"
+	"strconv"
 
 	"github.com/caixw/lib.go/orm/core"
 )
@@ -15,6 +17,13 @@ type Tx struct {
 	engine *Engine
 	tx     *sql.Tx
 	sql    *SQL
+
+	// 嵌套事务
+	parent    *Tx    // 父事务，为nil表示顶层事务
+	savepoint string // 嵌套事务对应的保存点名称
+	count     int    // 已经创建的保存点数量，仅顶层事务使用
+
+	tables []string // 事务中执行过写操作的表，提交之后清除其缓存，仅顶层事务使用
 }
 
 func (t *Tx) Name() string {
@@ -25,6 +34,10 @@ func (t *Tx) GetStmts() *core.Stmts {
 	return t.engine.GetStmts()
 }
 
+func (t *Tx) GetModels() *core.Models {
+	return t.engine.GetModels()
+}
+
 func (t *Tx) PrepareSQL(sql string) string {
 	return t.engine.PrepareSQL(sql)
 }
@@ -34,18 +47,34 @@ func (t *Tx) Dialect() core.Dialect {
 }
 
 func (t *Tx) Exec(sql string, args ...interface{}) (sql.Result, error) {
-	return t.tx.Exec(sql, args...)
+	return execContext(context.Background(), t.engine.logger, t.tx, t.engine.d.ReplacePlaceholders(sql), args)
 }
 
 func (t *Tx) Query(sql string, args ...interface{}) (*sql.Rows, error) {
-	return t.tx.Query(sql, args...)
+	return queryContext(context.Background(), t.engine.logger, t.tx, t.engine.d.ReplacePlaceholders(sql), args)
 }
 func (t *Tx) QueryRow(sql string, args ...interface{}) *sql.Row {
-	return t.tx.QueryRow(sql, args...)
+	return queryRowContext(context.Background(), t.engine.logger, t.tx, t.engine.d.ReplacePlaceholders(sql), args)
 }
 
 func (t *Tx) Prepare(sql string) (*sql.Stmt, error) {
-	return t.tx.Prepare(sql)
+	return prepareContext(context.Background(), t.engine.logger, t.tx, t.engine.d.ReplacePlaceholders(sql))
+}
+
+func (t *Tx) ExecContext(ctx context.Context, sql string, args ...interface{}) (sql.Result, error) {
+	return execContext(ctx, t.engine.logger, t.tx, t.engine.d.ReplacePlaceholders(sql), args)
+}
+
+func (t *Tx) QueryContext(ctx context.Context, sql string, args ...interface{}) (*sql.Rows, error) {
+	return queryContext(ctx, t.engine.logger, t.tx, t.engine.d.ReplacePlaceholders(sql), args)
+}
+
+func (t *Tx) QueryRowContext(ctx context.Context, sql string, args ...interface{}) *sql.Row {
+	return queryRowContext(ctx, t.engine.logger, t.tx, t.engine.d.ReplacePlaceholders(sql), args)
+}
+
+func (t *Tx) PrepareContext(ctx context.Context, sql string) (*sql.Stmt, error) {
+	return prepareContext(ctx, t.engine.logger, t.tx, t.engine.d.ReplacePlaceholders(sql))
 }
 
 // 关闭当前的db
@@ -56,16 +85,99 @@ func (t *Tx) close() {
 
 // 提交事务
 // 提交之后，整个Tx对象将不再有效。
+// 嵌套事务的提交只是释放其对应的保存点，最终是否生效由顶层事务决定。
 func (t *Tx) Commit() (err error) {
-	if err = t.tx.Commit(); err == nil {
+	if t.parent != nil {
+		err = t.execSavepoint(context.Background(), core.SavepointRelease)
+	} else {
+		err = t.tx.Commit()
+	}
+
+	if err == nil {
+		t.invalidateCache()
 		t.close()
 	}
 	return
 }
 
 // 回滚事务
-func (t *Tx) Rollback() {
-	t.tx.Rollback()
+// 嵌套事务只回滚到其对应的保存点，不影响父事务中的其它操作。
+func (t *Tx) Rollback() error {
+	if t.parent != nil {
+		return t.execSavepoint(context.Background(), core.SavepointRollback)
+	}
+	return t.tx.Rollback()
+}
+
+// 开始一个嵌套事务，通过保存点实现。
+// 嵌套事务与t共享同一个数据库事务，在嵌套事务结束之前，不应该再使用t。
+func (t *Tx) Begin() (*Tx, error) {
+	return t.BeginContext(context.Background())
+}
+
+// 功能同Begin()，但可以通过ctx取消操作。
+func (t *Tx) BeginContext(ctx context.Context) (*Tx, error) {
+	root := t
+	for root.parent != nil {
+		root = root.parent
+	}
+	root.count++
+
+	ret := &Tx{
+		engine:    t.engine,
+		tx:        t.tx,
+		parent:    t,
+		savepoint: "sp_" + strconv.Itoa(root.count),
+	}
+	ret.sql = ret.SQL()
+
+	if err := ret.execSavepoint(ctx, core.SavepointBegin); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// 执行保存点相关的语句，dialect不支持的操作会被忽略。
+func (t *Tx) execSavepoint(ctx context.Context, action int) error {
+	sql := t.Dialect().SavepointSQL(action, t.savepoint)
+	if len(sql) == 0 {
+		return nil
+	}
+
+	_, err := t.ExecContext(ctx, sql)
+	return err
+}
+
+// 在嵌套事务中执行fn，规则与Engine.Transaction()相同。
+func (t *Tx) Transaction(fn func(*Tx) error) error {
+	return t.TransactionContext(context.Background(), fn)
+}
+
+// 功能同Transaction()，但可以通过ctx取消操作。
+func (t *Tx) TransactionContext(ctx context.Context, fn func(*Tx) error) error {
+	tx, err := t.BeginContext(ctx)
+	if err != nil {
+		return err
+	}
+	return transaction(tx, fn)
+}
+
+// 在事务tx中执行fn。fn返回错误或是发生panic时回滚事务，否则提交事务。
+// panic在回滚之后会被继续抛出。
+func transaction(tx *Tx, fn func(*Tx) error) (err error) {
+	defer func() {
+		if msg := recover(); msg != nil {
+			tx.Rollback()
+			panic(msg)
+		}
+	}()
+
+	if err = fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
 }
 
 // 查找缓存的sql.Stmt，在未找到的情况下，第二个参数返回false
@@ -78,6 +190,16 @@ func (t *Tx) Stmt(name string) (*sql.Stmt, bool) {
 	return t.tx.Stmt(stmt), true
 }
 
+// 功能同Stmt()，返回的sql.Stmt实例在ctx取消时会被关闭。
+func (t *Tx) StmtContext(ctx context.Context, name string) (*sql.Stmt, bool) {
+	stmt, found := t.engine.Stmt(name)
+	if !found {
+		return nil, false
+	}
+
+	return t.tx.StmtContext(ctx, stmt), true
+}
+
 func (t *Tx) SQL() *SQL {
 	return newSQL(t)
 }
@@ -89,17 +211,82 @@ func (t *Tx) Where(cond string, args ...interface{}) *SQL {
 // 插入一个或多个数据
 // v可以是对象或是对象数组
 func (t *Tx) Insert(v interface{}) error {
-	return insertMult(t.sql, v)
+	return t.InsertContext(context.Background(), v)
+}
+
+// 功能同Insert()，但可以通过ctx取消操作。
+func (t *Tx) InsertContext(ctx context.Context, v interface{}) error {
+	return insertMult(ctx, t.sql, v, false)
+}
+
+// 以多行VALUES的insert语句批量插入数据，返回每一批次实际插入的行数。
+// v为对象数组；batchSize为每条语句插入的最大行数，
+// 同时受限于数据库允许的占位符数量和VALUES的行数，小于等于0时只受后两者限制。
+// 不支持多行VALUES的数据库，比如oracle，会逐行插入。
+// 自增列的值为零时由数据库生成，但生成的值不会写入对象中；同一批次中的值不能部分为零。
+func (t *Tx) InsertBatch(v interface{}, batchSize int) ([]int64, error) {
+	return t.InsertBatchContext(context.Background(), v, batchSize)
+}
+
+// 功能同InsertBatch()，但可以通过ctx取消操作。
+func (t *Tx) InsertBatchContext(ctx context.Context, v interface{}, batchSize int) ([]int64, error) {
+	return insertBatch(ctx, t, v, batchSize)
+}
+
+// 插入或是更新一个或多个数据。
+// 若数据的主键或唯一索引已经存在，则更新该记录的其它列，否则插入新记录。
+// v可以是对象或是对象数组
+func (t *Tx) Upsert(v interface{}) error {
+	return t.UpsertContext(context.Background(), v)
+}
+
+// 功能同Upsert()，但可以通过ctx取消操作。
+func (t *Tx) UpsertContext(ctx context.Context, v interface{}) error {
+	return insertMult(ctx, t.sql, v, true)
+}
+
+// 根据v的主键或是唯一索引的值，读取该记录的所有列到v中。
+// v只能是struct指针，记录不存在时返回sql.ErrNoRows。
+//  u := &User{ID: 1}
+//  err := t.Select(u)
+func (t *Tx) Select(v interface{}) error {
+	return t.SelectContext(context.Background(), v)
+}
+
+// 功能同Select()，但可以通过ctx取消操作。
+func (t *Tx) SelectContext(ctx context.Context, v interface{}) error {
+	return selectOne(ctx, t.sql, v)
 }
 
 // 更新一个或多个类型。
 // 更新依据为每个对象的主键或是唯一索引列。
 // 若不存在此两个类型的字段，则返回错误信息。
 func (t *Tx) Update(v interface{}) error {
-	return updateMult(t.sql, v)
+	return t.UpdateContext(context.Background(), v)
+}
+
+// 功能同Update()，但可以通过ctx取消操作。
+func (t *Tx) UpdateContext(ctx context.Context, v interface{}) error {
+	return updateMult(ctx, t.sql, v)
 }
 
 // 删除指定的数据对象。
+// 若对象存在软删除列，则只是标记为删除，并不会真正从数据库中删除。
 func (t *Tx) Delete(v interface{}) error {
-	return deleteMult(t.sql, v)
+	return t.DeleteContext(context.Background(), v)
+}
+
+// 功能同Delete()，但可以通过ctx取消操作。
+func (t *Tx) DeleteContext(ctx context.Context, v interface{}) error {
+	return deleteMult(ctx, t.sql, v, false)
+}
+
+// 删除指定的数据对象，即使对象存在软删除列，也会从数据库中真正删除。
+func (t *Tx) ForceDelete(v interface{}) error {
+	return t.ForceDeleteContext(context.Background(), v)
+}
+
+// 功能同ForceDelete()，但可以通过ctx取消操作。
+func (t *Tx) ForceDeleteContext(ctx context.Context, v interface{}) error {
+	return deleteMult(ctx, t.sql, v, true)
 }
@@ -0,0 +1,96 @@
+// Copyright 2014 by caixw, All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+package orm
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/caixw/lib.go/assert"
+)
+
+// 返回#user表中所有的id
+func userIDs(a *assert.Assertion, db *Engine) []interface{} {
+	ids, err := db.SQL().Table("#user").Columns("{id}").Asc("{id}").FetchColumns("id")
+	a.NotError(err)
+	return ids
+}
+
+func TestTxBegin(t *testing.T) {
+	a := assert.New(t)
+	e := newUtilDB(a, "savepoint")
+	defer closeUtilDB(a, "savepoint")
+
+	tx, err := e.Begin()
+	a.NotError(err)
+	a.NotError(tx.Insert(&utilUser{ID: 1}))
+
+	// 提交嵌套事务
+	tx1, err := tx.Begin()
+	a.NotError(err).Equal(tx1.savepoint, "sp_1")
+	a.NotError(tx1.Insert(&utilUser{ID: 2}))
+
+	// 回滚多层嵌套的事务
+	tx2, err := tx1.Begin()
+	a.NotError(err).Equal(tx2.savepoint, "sp_2")
+	a.NotError(tx2.Insert(&utilUser{ID: 3}))
+	a.NotError(tx2.Rollback())
+	a.NotError(tx1.Commit())
+
+	// 回滚嵌套事务
+	tx3, err := tx.Begin()
+	a.NotError(err).Equal(tx3.savepoint, "sp_3")
+	a.NotError(tx3.Insert(&utilUser{ID: 4}))
+	a.NotError(tx3.Rollback())
+
+	a.NotError(tx.Commit())
+	a.Equal(userIDs(a, e), []interface{}{1, 2})
+}
+
+func TestEngineTransaction(t *testing.T) {
+	a := assert.New(t)
+	e := newUtilDB(a, "transaction")
+	defer closeUtilDB(a, "transaction")
+
+	// 正常提交，包含一个回滚的嵌套事务
+	err := e.Transaction(func(tx *Tx) error {
+		if err := tx.Insert(&utilUser{ID: 1}); err != nil {
+			return err
+		}
+
+		err := tx.Transaction(func(tx *Tx) error {
+			if err := tx.Insert(&utilUser{ID: 2}); err != nil {
+				return err
+			}
+			return errors.New("rollback")
+		})
+		a.Error(err)
+
+		return tx.Transaction(func(tx *Tx) error {
+			return tx.Insert(&utilUser{ID: 3})
+		})
+	})
+	a.NotError(err)
+	a.Equal(userIDs(a, e), []interface{}{1, 3})
+
+	// 返回错误
+	err = e.Transaction(func(tx *Tx) error {
+		if err := tx.Insert(&utilUser{ID: 4}); err != nil {
+			return err
+		}
+		return errors.New("rollback")
+	})
+	a.Error(err)
+	a.Equal(userIDs(a, e), []interface{}{1, 3})
+
+	// panic
+	a.Panic(func() {
+		e.Transaction(func(tx *Tx) error {
+			a.NotError(tx.Insert(&utilUser{ID: 5}))
+			panic("panic")
+		})
+	})
+	a.Equal(userIDs(a, e), []interface{}{1, 3})
+}
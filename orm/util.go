@@ -5,9 +5,16 @@
 package orm
 
 import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"reflect"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/caixw/lib.go/orm/core"
 )
@@ -16,93 +23,310 @@ import (
 
 // 插入一个对象到数据库
 // v.Kind()必须是reflect.Struct
-func insertOne(sql *SQL, v interface{}) error {
-	rval := reflect.ValueOf(v)
+// upsert为true时，若主键或唯一索引已经存在，则更新该记录的其它列。
+func insertOne(ctx context.Context, sql *SQL, v interface{}, upsert bool) error {
+	v = hookObj(v)
+	rval := reflect.Indirect(reflect.ValueOf(v))
 
-	m, err := core.NewModel(v)
+	m, err := sql.db.GetModels().New(v)
 	if err != nil {
 		return err
 	}
 
-	sql.Reset().Table(m.Name)
+	if h, ok := v.(BeforeInserter); ok {
+		if err = h.BeforeInsert(sql.db); err != nil {
+			return err
+		}
+	}
 
+	sql.Reset().Model(v)
+
+	// 值为零的自增列由数据库生成，不能出现在insert语句中，
+	// 比如sql server不允许向IDENTITY列显式插入值。
+	var ai *core.Column
 	for name, col := range m.Cols {
-		sql.Add(name, rval.FieldByName(col.GoType.Name()).Interface())
+		if col.IsAI() && rval.FieldByName(col.GoName).IsZero() {
+			ai = col
+			continue
+		}
+
+		val, err := colValue(col, rval)
+		if err != nil {
+			return err
+		}
+		sql.Add("{"+name+"}", val)
+	}
+
+	if upsert {
+		cols := keyCols(m)
+		if len(cols) == 0 {
+			return errors.New("不存在主键或是唯一索引，无法判断冲突")
+		}
+		for _, col := range cols {
+			sql.OnConflict("{" + col.Name + "}")
+		}
+		sql.DoUpdate()
 	}
 
-	_, err = sql.Insert()
-	return err
+	result, err := sql.InsertContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	// upsert在冲突时更新的是已有记录，LastInsertId()的值不可信。
+	if ai != nil && !upsert && sql.db.Dialect().SupportLastInsertId() {
+		setAIValue(ai, rval, result)
+	}
+
+	if h, ok := v.(AfterInserter); ok {
+		return h.AfterInsert(sql.db)
+	}
+	return nil
 }
 
-// 更新一个对象
-func updateOne(sql *SQL, v interface{}) error {
-	rval := reflect.ValueOf(v)
+// 将数据库生成的自增值写入rval中自增列对应的字段，驱动不支持LastInsertId()时忽略。
+func setAIValue(col *core.Column, rval reflect.Value, result sql.Result) {
+	id, err := result.LastInsertId()
+	if err != nil {
+		return
+	}
 
-	m, err := core.NewModel(v)
+	field := rval.FieldByName(col.GoName)
+	if !field.CanSet() {
+		return
+	}
+
+	switch field.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		field.SetInt(id)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		field.SetUint(uint64(id))
+	}
+}
+
+// 获取列col在rval中对应字段的值，JSON列会被转换成JSON字符串。
+func colValue(col *core.Column, rval reflect.Value) (interface{}, error) {
+	field := rval.FieldByName(col.GoName)
+	if !col.JSON {
+		return field.Interface(), nil
+	}
+
+	data, err := json.Marshal(field.Interface())
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+// 返回能唯一确定一条记录的列：主键或是唯一索引。
+// 两者都不存在时，返回nil。
+func keyCols(m *core.Model) []*core.Column {
+	if len(m.PK) > 0 {
+		return m.PK
+	}
+
+	// 按名称取第一个唯一索引，保证每次返回的结果都相同。
+	var name string
+	for n := range m.UniqueIndexes {
+		if len(name) == 0 || n < name {
+			name = n
+		}
+	}
+	return m.UniqueIndexes[name]
+}
+
+// 根据主键或是唯一索引，为sql添加where部分的语句。
+func whereByKey(sql *SQL, m *core.Model, rval reflect.Value) error {
+	cols := keyCols(m)
+	if len(cols) == 0 {
+		return errors.New("无法产生where部分语句")
+	}
+
+	for _, col := range cols {
+		sql.And("{"+col.Name+"}=?", rval.FieldByName(col.GoName).Interface())
+	}
+	return nil
+}
+
+// 更新一个对象
+//
+// 若对象存在版本号列，则只有在数据库中的版本号与对象的版本号相同时才会更新，
+// 更新成功之后，数据库和对象中的版本号都会加1，所以此时v只能是指针；
+// 版本号不相同时，返回*ConflictError。
+// 所有的列都是主键时，没有需要更新的内容，不执行任何操作。
+func updateOne(ctx context.Context, sql *SQL, v interface{}) error {
+	m, err := sql.db.GetModels().New(v)
 	if err != nil {
 		return err
 	}
 
+	if m.Version != nil && reflect.TypeOf(v).Kind() != reflect.Ptr {
+		return fmt.Errorf("[%v]存在版本号列，只能以指针的形式更新", m.Name)
+	}
+
+	v = hookObj(v)
+	rval := reflect.Indirect(reflect.ValueOf(v))
+
+	if h, ok := v.(BeforeUpdater); ok {
+		if err = h.BeforeUpdate(sql.db); err != nil {
+			return err
+		}
+	}
+
 	sql.Reset().Table(m.Name)
 
-	switch {
-	case len(m.PK) != 0:
-		for _, col := range m.PK {
-			sql.Where(col.Name+"=?", rval.FieldByName(col.GoType.Name()).Interface())
+	if err = whereByKey(sql, m, rval); err != nil {
+		return err
+	}
+
+	// 主键或唯一索引的列已经作为where条件，不需要再更新。
+	// 复合主键中的列也是如此，且sql server不允许更新自增列。
+	keys := keyCols(m)
+	cnt := 0              // 需要更新的列数量
+	var ver reflect.Value // 版本号字段
+COLS:
+	for name, col := range m.Cols {
+		for _, key := range keys {
+			if key == col {
+				continue COLS
+			}
 		}
-	case len(m.UniqueIndexes) != 0:
-		for _, cols := range m.UniqueIndexes {
-			for _, col := range cols {
-				sql.Where(col.Name+"=?", rval.FieldByName(col.GoType.Name()).Interface())
+		cnt++
+
+		field := rval.FieldByName(col.GoName)
+		if col != m.Version {
+			val, err := colValue(col, rval)
+			if err != nil {
+				return err
 			}
-			break // 只取一个UniqueIndex就可以了
+			sql.Add("{"+name+"}", val)
+			continue
 		}
-	default:
-		return errors.New("无法产生where部分语句")
+
+		ver = field
+		sql.And("{"+name+"}=?", ver.Interface())
+		sql.Add("{"+name+"}", nextVersion(ver))
 	}
 
-	for name, col := range m.Cols {
-		sql.Add(name, rval.FieldByName(col.GoType.Name()).Interface())
+	if cnt == 0 { // 所有的列都是主键，比如多对多的关联表，没有需要更新的内容
+		if h, ok := v.(AfterUpdater); ok {
+			return h.AfterUpdate(sql.db)
+		}
+		return nil
+	}
+
+	result, err := sql.UpdateContext(ctx)
+	if err != nil {
+		return err
 	}
 
-	_, err = sql.Update()
-	return err
+	if ver.IsValid() {
+		affected, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if affected == 0 {
+			return &ConflictError{Table: m.Name, Version: ver.Interface()}
+		}
+
+		ver.Set(reflect.ValueOf(nextVersion(ver)).Convert(ver.Type()))
+	}
+
+	if h, ok := v.(AfterUpdater); ok {
+		return h.AfterUpdate(sql.db)
+	}
+	return nil
+}
+
+// 返回版本号字段的下一个值
+func nextVersion(ver reflect.Value) interface{} {
+	switch ver.Kind() {
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return ver.Uint() + 1
+	default: // core.Model已经保证版本号只能是整数
+		return ver.Int() + 1
+	}
 }
 
 // 删除单个对象的内容
-func deleteOne(sql *SQL, v interface{}) error {
-	rval := reflect.ValueOf(v)
+// 若对象存在软删除列，则只是将该列设置为当前时间戳，除非force为true。
+func deleteOne(ctx context.Context, sql *SQL, v interface{}, force bool) error {
+	v = hookObj(v)
+	rval := reflect.Indirect(reflect.ValueOf(v))
 
-	m, err := core.NewModel(v)
+	m, err := sql.db.GetModels().New(v)
 	if err != nil {
 		return err
 	}
 
+	if h, ok := v.(BeforeDeleter); ok {
+		if err = h.BeforeDelete(sql.db); err != nil {
+			return err
+		}
+	}
+
 	sql.Reset().Table(m.Name)
 
-	switch {
-	case len(m.PK) != 0:
-		for _, col := range m.PK {
-			sql.Where(col.Name+"=?", rval.FieldByName(col.GoType.Name()).Interface())
-		}
-	case len(m.UniqueIndexes) != 0:
-		for _, cols := range m.UniqueIndexes {
-			for _, col := range cols {
-				sql.Where(col.Name+"=?", rval.FieldByName(col.GoType.Name()).Interface())
-			}
-			break // 只取一个UniqueIndex就可以了
+	if err = whereByKey(sql, m, rval); err != nil {
+		return err
+	}
+
+	if force || m.SoftDelete == nil {
+		_, err = sql.DeleteContext(ctx)
+	} else {
+		now := time.Now().Unix()
+		_, err = sql.Add("{"+m.SoftDelete.Name+"}", now).UpdateContext(ctx)
+		if field := rval.FieldByName(m.SoftDelete.GoName); err == nil && field.CanSet() {
+			field.Set(reflect.ValueOf(now).Convert(field.Type()))
 		}
-	default:
-		return errors.New("无法产生where部分语句")
+	}
+	if err != nil {
+		return err
 	}
 
-	_, err = sql.Delete()
-	return err
+	if h, ok := v.(AfterDeleter); ok {
+		return h.AfterDelete(sql.db)
+	}
+	return nil
+}
+
+// 根据v的主键或是唯一索引的值，从数据库中读取该记录的其它列到v中，
+// v只能是struct指针。记录不存在时，返回sql.ErrNoRows。
+func selectOne(ctx context.Context, s *SQL, v interface{}) error {
+	rval := reflect.ValueOf(v)
+	if rval.Kind() != reflect.Ptr || rval.Elem().Kind() != reflect.Struct {
+		return errors.New("v只能是struct指针")
+	}
+
+	m, err := s.db.GetModels().New(v)
+	if err != nil {
+		return err
+	}
+
+	s.Reset().Model(v).Columns("*")
+	if err = whereByKey(s, m, rval.Elem()); err != nil {
+		return err
+	}
+
+	cur, err := s.CursorContext(ctx)
+	if err != nil {
+		return err
+	}
+	defer cur.Close()
+
+	if !cur.Next() {
+		if err = cur.Err(); err != nil {
+			return err
+		}
+		return sql.ErrNoRows
+	}
+	return cur.Scan(v)
 }
 
 // 插入一个或多个数据
 // v可以是对象或是对象数组
-func insertMult(sql *SQL, v interface{}) error {
+// upsert为true时，若主键或唯一索引已经存在，则更新该记录的其它列。
+func insertMult(ctx context.Context, sql *SQL, v interface{}, upsert bool) error {
 	rval := reflect.ValueOf(v)
 	if rval.Kind() == reflect.Ptr {
 		rval = rval.Elem()
@@ -110,14 +334,17 @@ func insertMult(sql *SQL, v interface{}) error {
 
 	switch rval.Kind() {
 	case reflect.Struct:
-		return insertOne(sql, v)
+		return insertOne(ctx, sql, v, upsert)
 	case reflect.Slice, reflect.Array:
-		if rval.Elem().Kind() != reflect.Struct {
+		if !isStructElem(rval.Type()) {
 			return errors.New("数组元素类型不正确")
 		}
+		if err := checkNilElem(rval); err != nil {
+			return err
+		}
 
 		for i := 0; i < rval.Len(); i++ {
-			if err := insertOne(sql, rval.Index(i).Interface()); err != nil {
+			if err := insertOne(ctx, sql, elemObj(rval.Index(i)), upsert); err != nil {
 				return err
 			}
 		}
@@ -128,10 +355,171 @@ func insertMult(sql *SQL, v interface{}) error {
 	return nil
 }
 
+// 以多行VALUES的insert语句批量插入数据，返回每一批次插入的行数。
+// v只能是对象数组；batchSize为每条语句插入的最大行数，
+// 同时受限于Dialect.MaxPlaceholders()和Dialect.MaxInsertRows()，小于等于0时，只受后两者限制。
+// 同一批次中自增列的值需要全部为零或是全部不为零，为零时由数据库生成，不会回写到对象中。
+func insertBatch(ctx context.Context, db core.DB, v interface{}, batchSize int) ([]int64, error) {
+	rval := reflect.ValueOf(v)
+	if rval.Kind() == reflect.Ptr {
+		rval = rval.Elem()
+	}
+
+	if rval.Kind() != reflect.Slice && rval.Kind() != reflect.Array {
+		return nil, fmt.Errorf("v的类型[%v]无效", rval.Kind())
+	}
+	if !isStructElem(rval.Type()) {
+		return nil, errors.New("数组元素类型不正确")
+	}
+	if rval.Len() == 0 {
+		return nil, nil
+	}
+	if err := checkNilElem(rval); err != nil {
+		return nil, err
+	}
+
+	m, err := db.GetModels().New(elemObj(rval.Index(0)))
+	if err != nil {
+		return nil, err
+	}
+
+	// 列的顺序需要固定，才能保证每一行的值与列相对应。
+	cols := make([]*core.Column, 0, len(m.Cols))
+	names := make([]string, 0, len(m.Cols))
+	for name := range m.Cols {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		cols = append(cols, m.Cols[name])
+	}
+
+	max := db.Dialect().MaxPlaceholders() / len(cols)
+	if max == 0 {
+		return nil, fmt.Errorf("列数量[%v]超过了数据库允许的占位符数量", len(cols))
+	}
+	if rows := db.Dialect().MaxInsertRows(); rows > 0 && max > rows {
+		max = rows
+	}
+	if batchSize <= 0 || batchSize > max {
+		batchSize = max
+	}
+
+	rows := make([]int64, 0, rval.Len()/batchSize+1)
+	for start := 0; start < rval.Len(); start += batchSize {
+		end := start + batchSize
+		if end > rval.Len() {
+			end = rval.Len()
+		}
+
+		objs := make([]interface{}, 0, end-start)
+		for i := start; i < end; i++ {
+			obj := hookObj(elemObj(rval.Index(i)))
+			if h, ok := obj.(BeforeInserter); ok {
+				if err = h.BeforeInsert(db); err != nil {
+					return rows, err
+				}
+			}
+			objs = append(objs, obj)
+		}
+
+		batchCols, batchNames, err := batchInsertCols(m, cols, names, objs)
+		if err != nil {
+			return rows, err
+		}
+
+		args := make([]interface{}, 0, len(objs)*len(batchCols))
+		for _, obj := range objs {
+			elem := reflect.Indirect(reflect.ValueOf(obj))
+			for _, col := range batchCols {
+				val, err := colValue(col, elem)
+				if err != nil {
+					return rows, err
+				}
+				args = append(args, val)
+			}
+		}
+
+		result, err := db.ExecContext(ctx, batchInsertSQL(db, m.Name, batchNames, len(objs)), args...)
+		if err != nil {
+			return rows, err
+		}
+		invalidateCache(db, m.Name)
+		n, err := result.RowsAffected()
+		if err != nil {
+			return rows, err
+		}
+		rows = append(rows, n)
+
+		for _, obj := range objs {
+			if h, ok := obj.(AfterInserter); ok {
+				if err = h.AfterInsert(db); err != nil {
+					return rows, err
+				}
+			}
+		}
+	}
+
+	return rows, nil
+}
+
+// 返回objs在同一条insert语句中需要插入的列。
+// 自增列的值全部为零时，由数据库生成，不出现在语句中；
+// 部分为零时无法在同一条语句中表示，返回错误。
+func batchInsertCols(m *core.Model, cols []*core.Column, names []string, objs []interface{}) ([]*core.Column, []string, error) {
+	if m.AI == nil {
+		return cols, names, nil
+	}
+
+	zero := 0
+	for _, obj := range objs {
+		if reflect.Indirect(reflect.ValueOf(obj)).FieldByName(m.AI.Col.GoName).IsZero() {
+			zero++
+		}
+	}
+	switch zero {
+	case 0:
+		return cols, names, nil
+	case len(objs):
+	default:
+		return nil, nil, fmt.Errorf("自增列[%v]的值不能部分为零", m.AI.Col.Name)
+	}
+
+	retCols := make([]*core.Column, 0, len(cols)-1)
+	retNames := make([]string, 0, len(names)-1)
+	for i, col := range cols {
+		if !col.IsAI() {
+			retCols = append(retCols, col)
+			retNames = append(retNames, names[i])
+		}
+	}
+	return retCols, retNames, nil
+}
+
+// 产生插入count行数据的insert语句：
+//  INSERT INTO table(col1,col2) VALUES(?,?),(?,?)
+func batchInsertSQL(db core.DB, table string, cols []string, count int) string {
+	buf := bytes.NewBufferString("INSERT INTO ")
+	buf.WriteString(table)
+	buf.WriteString("({")
+	buf.WriteString(strings.Join(cols, "},{"))
+	buf.WriteString("}) VALUES")
+
+	row := "(" + strings.Repeat("?,", len(cols)-1) + "?)"
+	for i := 0; i < count; i++ {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		buf.WriteString(row)
+	}
+
+	return db.PrepareSQL(buf.String())
+}
+
 // 更新一个或多个类型。
 // 更新依据为每个对象的主键或是唯一索引列。
 // 若不存在此两个类型的字段，则返回错误信息。
-func updateMult(sql *SQL, v interface{}) error {
+func updateMult(ctx context.Context, sql *SQL, v interface{}) error {
 	rval := reflect.ValueOf(v)
 	if rval.Kind() == reflect.Ptr {
 		rval = rval.Elem()
@@ -139,14 +527,17 @@ func updateMult(sql *SQL, v interface{}) error {
 
 	switch rval.Kind() {
 	case reflect.Struct:
-		return updateOne(sql, v)
+		return updateOne(ctx, sql, v)
 	case reflect.Array, reflect.Slice:
-		if rval.Elem().Kind() != reflect.Struct {
+		if !isStructElem(rval.Type()) {
 			return errors.New("数组元素类型不正确")
 		}
+		if err := checkNilElem(rval); err != nil {
+			return err
+		}
 
 		for i := 0; i < rval.Len(); i++ {
-			if err := updateOne(sql, rval.Index(i).Interface()); err != nil {
+			if err := updateOne(ctx, sql, elemObj(rval.Index(i))); err != nil {
 				return err
 			}
 		}
@@ -158,7 +549,8 @@ func updateMult(sql *SQL, v interface{}) error {
 }
 
 // 删除指定的数据对象。
-func deleteMult(sql *SQL, v interface{}) error {
+// force为true时，即使对象存在软删除列，也会从数据库中删除。
+func deleteMult(ctx context.Context, sql *SQL, v interface{}, force bool) error {
 	rval := reflect.ValueOf(v)
 	if rval.Kind() == reflect.Ptr {
 		rval = rval.Elem()
@@ -166,14 +558,17 @@ func deleteMult(sql *SQL, v interface{}) error {
 
 	switch rval.Kind() {
 	case reflect.Struct:
-		return deleteOne(sql, v)
+		return deleteOne(ctx, sql, v, force)
 	case reflect.Array, reflect.Slice:
-		if rval.Elem().Kind() != reflect.Struct {
+		if !isStructElem(rval.Type()) {
 			return errors.New("数组元素类型不正确")
 		}
+		if err := checkNilElem(rval); err != nil {
+			return err
+		}
 
 		for i := 0; i < rval.Len(); i++ {
-			if err := deleteOne(sql, rval.Index(i).Interface()); err != nil {
+			if err := deleteOne(ctx, sql, elemObj(rval.Index(i)), force); err != nil {
 				return err
 			}
 		}
@@ -183,3 +578,57 @@ func deleteMult(sql *SQL, v interface{}) error {
 
 	return nil
 }
+
+// 数组或是slice的元素是否为struct或是struct指针。
+func isStructElem(t reflect.Type) bool {
+	elem := t.Elem()
+	if elem.Kind() == reflect.Ptr {
+		elem = elem.Elem()
+	}
+
+	return elem.Kind() == reflect.Struct
+}
+
+// 检测数组中是否存在值为nil的元素，存在时返回错误。
+func checkNilElem(rval reflect.Value) error {
+	if rval.Type().Elem().Kind() != reflect.Ptr {
+		return nil
+	}
+
+	for i := 0; i < rval.Len(); i++ {
+		if rval.Index(i).IsNil() {
+			return fmt.Errorf("第%v个元素的值为nil", i)
+		}
+	}
+	return nil
+}
+
+// 返回数组元素对应的对象，尽可能返回指针，
+// 以便core.Model能获取到指针上的Meta()方法，以及修改对象中的值。
+func elemObj(elem reflect.Value) interface{} {
+	if elem.Kind() != reflect.Ptr && elem.CanAddr() {
+		return elem.Addr().Interface()
+	}
+
+	return elem.Interface()
+}
+
+// 获取v中元素的struct类型，v可以是orm/fetch.Obj()中允许的所有类型。
+// 若不是struct相关的类型，返回nil。
+func objType(v interface{}) reflect.Type {
+	t := reflect.TypeOf(v)
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() == reflect.Slice || t.Kind() == reflect.Array {
+		t = t.Elem()
+	}
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	if t.Kind() != reflect.Struct {
+		return nil
+	}
+	return t
+}
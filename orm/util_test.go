@@ -8,9 +8,12 @@ import (
 	"database/sql"
 	"fmt"
 	"os"
+	"strings"
 	"testing"
 
 	"github.com/caixw/lib.go/assert"
+	"github.com/caixw/lib.go/orm/core"
+	"github.com/caixw/lib.go/orm/dialect"
 )
 
 const testDBFile = "./test.db"
@@ -66,6 +69,499 @@ func closeDB(db *sql.DB, a *assert.Assertion) {
 		FileNotExists(testDBFile)
 }
 
+type utilUser struct {
+	ID      int64  `orm:"name(id);pk"`
+	Name    string `orm:"name(name)"`
+	Version int64  `orm:"name(version);version"`
+}
+
+func (u *utilUser) Meta() string {
+	return "name(#user)"
+}
+
+// 声明一个带user表的Engine实例，name同时作为数据库的文件名。
+func newUtilDB(a *assert.Assertion, name string) *Engine {
+	newDB(a) // 确保sqlite3的dialect已经注册
+
+	e, err := New("sqlite3", "./"+name+".db", name, "util_")
+	a.NotError(err).NotNil(e)
+
+	sql := "CREATE TABLE #user({id} INTEGER PRIMARY KEY, {name} TEXT, {version} INTEGER NOT NULL)"
+	_, err = e.Exec(e.PrepareSQL(sql))
+	a.NotError(err)
+
+	return e
+}
+
+// 关闭由newUtilDB()声明的Engine，并删除数据库文件。
+func closeUtilDB(a *assert.Assertion, name string) {
+	Close(name)
+	a.NotError(os.Remove("./" + name + ".db"))
+}
+
 func TestDeleteOne(t *testing.T) {
 	a := assert.New(t)
+	e := newUtilDB(a, "delete")
+	defer closeUtilDB(a, "delete")
+
+	a.NotError(e.Insert([]*utilUser{{ID: 1, Name: "u1"}, {ID: 2, Name: "u2"}}))
+	a.NotError(e.Delete(&utilUser{ID: 1}))
+
+	ids, err := e.SQL().Table("#user").Columns("{id}").FetchColumns("id")
+	a.NotError(err).Equal(ids, []interface{}{2})
+}
+
+func TestInsertOneUpsert(t *testing.T) {
+	a := assert.New(t)
+	e := newUtilDB(a, "upsert")
+	defer closeUtilDB(a, "upsert")
+
+	a.NotError(e.Upsert(&utilUser{ID: 1, Name: "u1"}))
+	a.NotError(e.Upsert([]*utilUser{{ID: 1, Name: "u1-1"}, {ID: 2, Name: "u2"}}))
+
+	names, err := e.SQL().Table("#user").Columns("{name}").Asc("{id}").FetchColumns("name")
+	a.NotError(err).Equal(names, []interface{}{"u1-1", "u2"})
+
+	// 不会覆盖数据库中的版本号
+	a.NotError(e.Update(&utilUser{ID: 1, Name: "u1-2"}))
+	a.NotError(e.Upsert(&utilUser{ID: 1, Name: "u1-3"}))
+	u := &utilUser{ID: 1}
+	a.NotError(e.Select(u))
+	a.Equal(u.Name, "u1-3").Equal(u.Version, 1)
+
+	// 不存在主键和唯一索引
+	a.Error(e.Upsert(&struct {
+		Name string `orm:"name(name)"`
+	}{Name: "u3"}))
+}
+
+func TestUpdateOneVersion(t *testing.T) {
+	a := assert.New(t)
+	e := newUtilDB(a, "version")
+	defer closeUtilDB(a, "version")
+
+	a.NotError(e.Insert(&utilUser{ID: 1, Name: "u1"}))
+
+	u1 := &utilUser{ID: 1, Name: "u1-1"}
+	u2 := &utilUser{ID: 1, Name: "u1-2"}
+
+	a.NotError(e.Update(u1))
+	a.Equal(u1.Version, 1)
+
+	// u2的版本号已经失效
+	err := e.Update(u2)
+	a.Error(err)
+	conflict, ok := err.(*ConflictError)
+	a.True(ok).Equal(conflict.Version, 0)
+	a.Equal(u2.Version, 0)
+
+	name, err := e.SQL().Table("#user").Columns("{name}").FetchColumn("name")
+	a.NotError(err).Equal(name, "u1-1")
+
+	// 更新版本号之后可以正常更新
+	u2.Version = u1.Version
+	a.NotError(e.Update(u2))
+	a.Equal(u2.Version, 2)
+
+	// slice中的元素同样会更新版本号
+	users := []utilUser{{ID: 1, Name: "u1-3", Version: 2}}
+	a.NotError(e.Update(users))
+	a.Equal(users[0].Version, 3)
+
+	// 存在版本号列时，不能以值的形式更新
+	a.Error(e.Update(utilUser{ID: 1, Name: "u1-4", Version: 3}))
+	a.Error(e.Update([1]utilUser{{ID: 1, Name: "u1-4", Version: 3}}))
+	name, err = e.SQL().Table("#user").Columns("{name}").FetchColumn("name")
+	a.NotError(err).Equal(name, "u1-3")
+}
+
+type utilSoftUser struct {
+	ID      int64  `orm:"name(id);pk"`
+	Name    string `orm:"name(name)"`
+	Deleted int64  `orm:"name(deleted);softdelete"`
+}
+
+func (u *utilSoftUser) Meta() string {
+	return "name(#soft_user)"
+}
+
+func TestDeleteOneSoftDelete(t *testing.T) {
+	a := assert.New(t)
+	e := newUtilDB(a, "softdelete")
+	defer closeUtilDB(a, "softdelete")
+
+	sql := "CREATE TABLE #soft_user({id} INTEGER PRIMARY KEY, {name} TEXT, {deleted} INTEGER NOT NULL)"
+	_, err := e.Exec(e.PrepareSQL(sql))
+	a.NotError(err)
+
+	users := []*utilSoftUser{{ID: 1, Name: "u1"}, {ID: 2, Name: "u2"}, {ID: 3, Name: "u3"}}
+	a.NotError(e.Insert(users))
+
+	// 软删除，只设置deleted字段
+	a.NotError(e.Delete(users[0]))
+	a.True(users[0].Deleted > 0)
+
+	fetched := []*utilSoftUser{}
+	a.NotError(e.SQL().Table("#soft_user").Columns("*").Asc("{id}").Fetch(&fetched))
+	a.Equal(2, len(fetched)).Equal(fetched[0].ID, 2)
+
+	// 包含OR的条件也不会返回已删除的数据
+	fetched = fetched[:0]
+	a.NotError(e.SQL().Table("#soft_user").Columns("*").Where("{id}=?", 1).Or("{id}=?", 2).Fetch(&fetched))
+	a.Equal(1, len(fetched)).Equal(fetched[0].ID, 2)
+
+	// 非Fetch()的查询需要通过Model()指定
+	maps, err := e.SQL().Model(&utilSoftUser{}).Columns("*").Fetch2Maps()
+	a.NotError(err).Equal(2, len(maps))
+
+	// WithDeleted()
+	fetched = fetched[:0]
+	a.NotError(e.SQL().Table("#soft_user").Columns("*").WithDeleted().Fetch(&fetched))
+	a.Equal(3, len(fetched))
+
+	// ForceDelete()
+	a.NotError(e.ForceDelete(users[0]))
+	fetched = fetched[:0]
+	a.NotError(e.SQL().Table("#soft_user").Columns("*").WithDeleted().Fetch(&fetched))
+	a.Equal(2, len(fetched))
+}
+
+// 限制了VALUES行数的Dialect
+type maxRowsDialect struct {
+	core.Dialect
+	rows int
+}
+
+func (d *maxRowsDialect) MaxInsertRows() int {
+	return d.rows
+}
+
+// 以oracle的形式替换?占位符的Dialect，sqlite3同样支持:1形式的占位符。
+type placeholderDialect struct {
+	core.Dialect
+}
+
+func (d *placeholderDialect) ReplacePlaceholders(sql string) string {
+	return (&dialect.Oracle{}).ReplacePlaceholders(sql)
+}
+
+func TestReplacePlaceholders(t *testing.T) {
+	a := assert.New(t)
+	e := newUtilDB(a, "placeholder")
+	defer closeUtilDB(a, "placeholder")
+
+	e.d = &placeholderDialect{Dialect: e.d}
+	l := &testLogger{}
+	e.SetLogger(l)
+
+	a.NotError(e.Insert(&utilUser{ID: 1, Name: "u1"}))
+	a.NotError(e.Update(&utilUser{ID: 1, Name: "u2"}))
+
+	names, err := e.Where("{id}=? AND {name}<>'?'", 1).Table("#user").Columns("{name}").FetchColumns("name")
+	a.NotError(err).Equal(names, []interface{}{"u2"})
+
+	a.NotError(e.Transaction(func(tx *Tx) error {
+		return tx.Delete(&utilUser{ID: 1})
+	}))
+
+	a.True(len(l.infos) > 0)
+	for _, info := range l.infos {
+		a.False(strings.Contains(info.SQL, "?") && !strings.Contains(info.SQL, "'?'"), info.SQL)
+	}
+	a.True(strings.Contains(l.infos[len(l.infos)-1].SQL, ":1"))
+}
+
+func TestInsertBatch(t *testing.T) {
+	a := assert.New(t)
+	e := newUtilDB(a, "batch")
+	defer closeUtilDB(a, "batch")
+
+	users := make([]*utilUser, 0, 5)
+	for i := 1; i <= 5; i++ {
+		users = append(users, &utilUser{ID: int64(i), Name: fmt.Sprintf("u%d", i)})
+	}
+
+	rows, err := e.InsertBatch(users, 2)
+	a.NotError(err).Equal(rows, []int64{2, 2, 1})
+
+	ids, err := e.SQL().Table("#user").Columns("{id}").Asc("{id}").FetchColumns("id")
+	a.NotError(err).Equal(ids, []interface{}{1, 2, 3, 4, 5})
+
+	// 受占位符数量的限制，sqlite3每条语句最多插入999/3行。
+	users = users[:0]
+	for i := 6; i <= 1005; i++ {
+		users = append(users, &utilUser{ID: int64(i)})
+	}
+	rows, err = e.InsertBatch(users, 0)
+	a.NotError(err).Equal(rows, []int64{333, 333, 333, 1})
+
+	// 同时受限于Dialect.MaxInsertRows()
+	d := e.d
+	e.d = &maxRowsDialect{Dialect: d, rows: 2}
+	rows, err = e.InsertBatch([]utilUser{{ID: 1006}, {ID: 1007}, {ID: 1008}}, 0)
+	a.NotError(err).Equal(rows, []int64{2, 1})
+	e.d = &maxRowsDialect{Dialect: d, rows: 1}
+	rows, err = e.InsertBatch([]utilUser{{ID: 1009}, {ID: 1010}}, 10)
+	a.NotError(err).Equal(rows, []int64{1, 1})
+	e.d = d
+
+	// 在事务中执行，回滚之后数据不存在。
+	tx, err := e.Begin()
+	a.NotError(err)
+	rows, err = tx.InsertBatch([]utilUser{{ID: 2000}, {ID: 2001}}, 10)
+	a.NotError(err).Equal(rows, []int64{2})
+	tx.Rollback()
+
+	cnt, err := e.SQL().Table("#user").Columns("{id}").Where("{id}>=?", 2000).FetchColumns("id")
+	a.NotError(err).Empty(cnt)
+
+	// 任意一批失败时，所有批次都被回滚
+	rows, err = e.InsertBatch([]utilUser{{ID: 2000}, {ID: 2001}, {ID: 1}}, 2)
+	a.Error(err).Nil(rows)
+	cnt, err = e.SQL().Table("#user").Columns("{id}").Where("{id}>=?", 2000).FetchColumns("id")
+	a.NotError(err).Empty(cnt)
+
+	// 值为nil的元素
+	rows, err = e.InsertBatch([]*utilUser{{ID: 2000}, nil}, 10)
+	a.Error(err).Nil(rows)
+	a.Error(e.Insert([]*utilUser{{ID: 2000}, nil}))
+	a.Error(e.Update([]*utilUser{nil}))
+	a.Error(e.Delete([]*utilUser{nil}))
+
+	// 非数组类型
+	_, err = e.InsertBatch(&utilUser{ID: 3000}, 10)
+	a.Error(err)
+}
+
+type utilJSONUser struct {
+	ID      int64             `orm:"name(id);pk"`
+	Tags    []string          `orm:"name(tags);json"`
+	Profile map[string]string `orm:"name(profile);json"`
+}
+
+func (u *utilJSONUser) Meta() string {
+	return "name(#json_user)"
+}
+
+func TestJSONColumn(t *testing.T) {
+	a := assert.New(t)
+	e := newUtilDB(a, "json")
+	defer closeUtilDB(a, "json")
+
+	sql := "CREATE TABLE #json_user({id} INTEGER PRIMARY KEY, {tags} TEXT, {profile} TEXT)"
+	_, err := e.Exec(e.PrepareSQL(sql))
+	a.NotError(err)
+
+	u := &utilJSONUser{ID: 1, Tags: []string{"a", "b"}, Profile: map[string]string{"city": "x"}}
+	a.NotError(e.Insert(u))
+
+	tags, err := e.SQL().Table("#json_user").Columns("{tags}").FetchColumn("tags")
+	a.NotError(err).Equal(tags, `["a","b"]`)
+
+	u.Tags = append(u.Tags, "c")
+	a.NotError(e.Update(u))
+
+	fetched := &utilJSONUser{}
+	a.NotError(e.SQL().Table("#json_user").Columns("*").Fetch(fetched))
+	a.Equal(fetched, &utilJSONUser{ID: 1, Tags: []string{"a", "b", "c"}, Profile: map[string]string{"city": "x"}})
+}
+
+// 复合主键
+type utilMember struct {
+	GroupID int64  `orm:"name(gid);pk"`
+	UserID  int64  `orm:"name(uid);pk"`
+	Role    string `orm:"name(role)"`
+}
+
+func (m *utilMember) Meta() string {
+	return "name(#member);fk(fk_user,uid,#user,id)"
+}
+
+func TestCompositePK(t *testing.T) {
+	a := assert.New(t)
+	e := newUtilDB(a, "composite")
+	defer closeUtilDB(a, "composite")
+
+	a.NotError(e.Create(&utilMember{}))
+	a.NotError(e.Insert([]*utilMember{
+		{GroupID: 1, UserID: 1, Role: "admin"},
+		{GroupID: 1, UserID: 2, Role: "user"},
+		{GroupID: 2, UserID: 1, Role: "user"},
+	}))
+
+	m := &utilMember{GroupID: 1, UserID: 2}
+	a.NotError(e.Select(m)).Equal(m.Role, "user")
+
+	m = &utilMember{GroupID: 2, UserID: 2}
+	a.Equal(e.Select(m), sql.ErrNoRows)
+
+	// 只更新主键对应的记录
+	a.NotError(e.Update(&utilMember{GroupID: 2, UserID: 1, Role: "admin"}))
+	roles, err := e.SQL().Table("#member").Columns("{role}").Asc("{gid}", "{uid}").FetchColumns("role")
+	a.NotError(err).Equal(roles, []interface{}{"admin", "user", "admin"})
+
+	// 只删除主键对应的记录
+	a.NotError(e.Delete(&utilMember{GroupID: 1, UserID: 1}))
+	roles, err = e.SQL().Table("#member").Columns("{role}").Asc("{gid}", "{uid}").FetchColumns("role")
+	a.NotError(err).Equal(roles, []interface{}{"user", "admin"})
+
+	// Tx.Select
+	a.NotError(e.Transaction(func(tx *Tx) error {
+		m := &utilMember{GroupID: 2, UserID: 1}
+		if err := tx.Select(m); err != nil {
+			return err
+		}
+		a.Equal(m.Role, "admin")
+		return nil
+	}))
+
+	a.Error(e.Select(utilMember{}))
+}
+
+// 所有的列都是主键
+type utilGroupUser struct {
+	GroupID int64 `orm:"name(gid);pk"`
+	UserID  int64 `orm:"name(uid);pk"`
+}
+
+func (m *utilGroupUser) Meta() string {
+	return "name(#group_user)"
+}
+
+func TestUpdateAllPK(t *testing.T) {
+	a := assert.New(t)
+	e := newUtilDB(a, "allpk")
+	defer closeUtilDB(a, "allpk")
+
+	a.NotError(e.Create(&utilGroupUser{}))
+	a.NotError(e.Insert(&utilGroupUser{GroupID: 1, UserID: 1}))
+
+	// 没有需要更新的列，不执行任何操作
+	a.NotError(e.Update(&utilGroupUser{GroupID: 1, UserID: 1}))
+	a.NotError(e.Update(&utilGroupUser{GroupID: 2, UserID: 2}))
+
+	cnt, err := e.SQL().Table("#group_user").Count()
+	a.NotError(err).Equal(cnt, 1)
+}
+
+type utilAIUser struct {
+	ID   int64  `orm:"name(id);ai"`
+	Name string `orm:"name(name);len(20)"`
+}
+
+func (m *utilAIUser) Meta() string {
+	return "name(#aiu)"
+}
+
+func TestInsertAI(t *testing.T) {
+	a := assert.New(t)
+	e := newUtilDB(a, "ai")
+	defer closeUtilDB(a, "ai")
+
+	_, err := e.Exec(e.PrepareSQL("CREATE TABLE #aiu({id} INTEGER PRIMARY KEY AUTOINCREMENT, {name} TEXT)"))
+	a.NotError(err)
+
+	// 未指定自增列的值，由数据库生成并回写到对象中
+	u := &utilAIUser{Name: "u1"}
+	a.NotError(e.Insert(u))
+	a.Equal(u.ID, 1)
+	a.NotError(e.Insert(utilAIUser{Name: "u2"}))
+
+	// 指定了自增列的值
+	a.NotError(e.Insert(&utilAIUser{ID: 10, Name: "u10"}))
+	u = &utilAIUser{Name: "u11"}
+	a.NotError(e.Insert(u))
+	a.Equal(u.ID, 11)
+
+	// 批量插入，未指定自增列的值
+	rows, err := e.InsertBatch([]utilAIUser{{Name: "u12"}, {Name: "u13"}, {Name: "u14"}}, 2)
+	a.NotError(err).Equal(rows, []int64{2, 1})
+
+	// 同一批次中的自增列部分为零
+	_, err = e.InsertBatch([]utilAIUser{{ID: 20, Name: "u20"}, {Name: "u21"}}, 10)
+	a.Error(err)
+	rows, err = e.InsertBatch([]utilAIUser{{ID: 20, Name: "u20"}, {Name: "u21"}}, 1)
+	a.NotError(err).Equal(rows, []int64{1, 1})
+
+	ids, err := e.SQL().Table("#aiu").Columns("{id}").Asc("{id}").FetchColumns("id")
+	a.NotError(err).Equal(ids, []interface{}{1, 2, 10, 11, 12, 13, 14, 20, 21})
+}
+
+func TestEngineWithPrefix(t *testing.T) {
+	a := assert.New(t)
+	e := newUtilDB(a, "prefix")
+	defer closeUtilDB(a, "prefix")
+
+	t42 := e.WithPrefix("t42_")
+	a.NotNil(t42).
+		Equal(t42.PrepareSQL("SELECT * FROM #user"), "SELECT * FROM t42_user").
+		Equal(e.PrepareSQL("SELECT * FROM #user"), "SELECT * FROM util_user").
+		True(t42.GetModels() == e.GetModels())
+
+	sql := "CREATE TABLE #user({id} INTEGER PRIMARY KEY, {name} TEXT, {version} INTEGER NOT NULL)"
+	_, err := t42.Exec(t42.PrepareSQL(sql))
+	a.NotError(err)
+
+	a.NotError(e.Insert(&utilUser{ID: 1, Name: "u1"}))
+	a.NotError(t42.Insert(&utilUser{ID: 2, Name: "u2"}))
+
+	ids, err := e.SQL().Table("#user").Columns("{id}").FetchColumns("id")
+	a.NotError(err).Equal(ids, []interface{}{1})
+	ids, err = t42.SQL().Table("#user").Columns("{id}").FetchColumns("id")
+	a.NotError(err).Equal(ids, []interface{}{2})
+
+	// 事务继承前缀
+	tx, err := t42.Begin()
+	a.NotError(err)
+	a.Equal(tx.PrepareSQL("#user"), "t42_user")
+	a.NotError(tx.Insert(&utilUser{ID: 3, Name: "u3"}))
+	a.NotError(tx.Commit())
+	ids, err = t42.SQL().Table("#user").Columns("{id}").FetchColumns("id")
+	a.NotError(err).Equal(ids, []interface{}{2, 3})
+
+	// sql.Stmt缓存按前缀区分
+	_, err = e.SQL().Table("#user").Columns("{id}").Stmt(Select, "ids")
+	a.NotError(err)
+	_, found := t42.Stmt("ids")
+	a.False(found)
+	_, err = t42.SQL().Table("#user").Columns("{id}").Stmt(Select, "ids")
+	a.NotError(err)
+	a.True(e.WithPrefix("t42_").GetStmts() == t42.GetStmts()).
+		True(e.GetStmts() != t42.GetStmts())
+
+	stmt, found := t42.Stmt("ids")
+	a.True(found)
+	rows, err := stmt.Query()
+	a.NotError(err)
+	ids = ids[:0]
+	for rows.Next() {
+		var id int
+		a.NotError(rows.Scan(&id))
+		ids = append(ids, id)
+	}
+	a.NotError(rows.Close())
+	a.Equal(ids, []interface{}{2, 3})
+}
+
+func TestEngineModels(t *testing.T) {
+	a := assert.New(t)
+	e1 := newUtilDB(a, "models1")
+	defer closeUtilDB(a, "models1")
+	e2 := newUtilDB(a, "models2")
+	defer closeUtilDB(a, "models2")
+
+	a.NotNil(e1.GetModels()).
+		True(e1.GetModels() != e2.GetModels())
+
+	// 各Engine分别缓存Model
+	m1, err := e1.GetModels().New(&sqlSoftUser{})
+	a.NotError(err)
+	m2, err := e2.GetModels().New(&sqlSoftUser{})
+	a.NotError(err)
+	a.True(m1 != m2)
+
+	// 释放全局的缓存不影响Engine
+	core.FreeModels()
+	m, err := e1.GetModels().New(&sqlSoftUser{})
+	a.NotError(err).True(m == m1)
 }